@@ -2,38 +2,124 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
 	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	httpauth "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/infosecstreams/StreamStatus/internal/gitops"
+	"github.com/infosecstreams/StreamStatus/internal/render"
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
 	"github.com/nicklaw5/helix"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
+)
+
+const (
+	// updateQueueSize is the number of status changes that can wait for git operations.
+	updateQueueSize = 100
+	// maxPushAttempts is how many times a push is tried when the remote
+	// branch has moved on.
+	maxPushAttempts = 3
+	// defaultMaxBodyBytes caps the size of webhook request bodies unless
+	// max_body_bytes is configured.
+	defaultMaxBodyBytes = 1 << 20
+	// shutdownTimeout is how long to wait for in-flight work when exiting.
+	shutdownTimeout = 25 * time.Second
+
+	// Limits applied to the public HTTP server so slow or oversized
+	// requests can't tie up connections.
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 10 * time.Second
+	writeTimeout      = 10 * time.Second
+	idleTimeout       = 60 * time.Second
+	maxHeaderBytes    = 16 << 10
 )
 
 // StreamersRepo struct represents fields to hold various data while updating status.
 type StreamersRepo struct {
-	auth          *httpauth.BasicAuth
-	indexFilePath string
-	indexMdText   string
-	online        bool
-	repo          *git.Repository
-	repoPath      string
-	streamer      string
-	url           string
+	applied          []notification
+	auth             transport.AuthMethod
+	authorEmail      string
+	authorName       string
+	autoAddRows      bool
+	avatarDir        string
+	branch           string
+	cloneDepth       int
+	cloneTimeout     time.Duration
+	contents         *contentsAPI
+	dataFilePath     string
+	eventID          string
+	footer           *template.Template
+	footerLocation   *time.Location
+	gitTimeout       time.Duration
+	gpgSignKey       *openpgp.Entity
+	inMemory         bool
+	inactiveFilePath string
+	inactiveMdText   string
+	indexFilePath    string
+	indexMdText      string
+	issues           *issueReporter
+	live             map[string]map[string]bool
+	lock             *gitops.CloneLock
+	logger           *log.Entry
+	newRow           *template.Template
+	notFound         []notification
+	offlineMessage   *template.Template
+	onlineMessage    *template.Template
+	pages            *render.Templates
+	pending          []notification
+	platformApplied  []notification
+	pullRequests     *pullRequester
+	repo             *git.Repository
+	repoPath         string
+	retry            retryPolicy
+	singleBranch     bool
+	sshSigner        ssh.Signer
+	statsFilePath    string
+	style            render.Style
+	url              string
 }
 
+var (
+	// ErrNoChangeNeeded is matched by every NoChangeNeededError.
+	ErrNoChangeNeeded = errors.New("no change needed")
+	// ErrStreamerNotFound is the cause of a NoChangeNeededError for a
+	// streamer without a row.
+	ErrStreamerNotFound = errors.New("streamer not found")
+)
+
 // NoChangeNeededError is a struct for a custom error handler
-// when no changes are needed to the git repository.
+// when no changes are needed to the git repository. It matches
+// ErrNoChangeNeeded, and its cause if it has one.
 type NoChangeNeededError struct {
-	err string
+	err   string
+	cause error
 }
 
 // Error returns a string for the NoChangeNeededError struct.
@@ -41,62 +127,229 @@ func (e *NoChangeNeededError) Error() string {
 	return e.err
 }
 
+// Is reports whether target is ErrNoChangeNeeded.
+func (e *NoChangeNeededError) Is(target error) bool {
+	return target == ErrNoChangeNeeded
+}
+
+// Unwrap returns the cause of the error, if there is one.
+func (e *NoChangeNeededError) Unwrap() error {
+	return e.cause
+}
+
 // gitPush pushes the repository to github and return and error.
 func (s *StreamersRepo) gitPush() error {
-	err := s.repo.Push(&git.PushOptions{
+	opts := &git.PushOptions{
 		RemoteName: "origin",
 		Auth:       s.auth,
+	}
+	// In pull request mode the local branch is force pushed to the status
+	// branch instead of its upstream.
+	var head *plumbing.Reference
+	if s.pullRequests != nil {
+		var err error
+		head, err = s.repo.Head()
+		if err != nil {
+			return err
+		}
+		opts.RefSpecs = []gitconfig.RefSpec{
+			gitconfig.RefSpec(fmt.Sprintf("+%s:refs/heads/%s", head.Name(), s.pullRequests.branch)),
+		}
+	}
+	err := gitops.WithTimeout("push", s.gitTimeout, func(ctx context.Context) error {
+		return s.repo.PushContext(ctx, opts)
 	})
+	// Pull request mode force pushes, which the remote doesn't reject.
+	if err != nil && s.pullRequests == nil && gitops.PushRejected(s.gitClone(), err) {
+		return &gitops.PushRejectedError{Err: err}
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("pushing to origin: %w", err)
+	}
+	s.logger.Println("remote repo updated.", s.indexFilePath)
+
+	if s.pullRequests != nil {
+		pr, err := s.pullRequests.ensurePullRequest(head.Name().Short(), "🤖 Stream status updates")
+		if err != nil {
+			return err
+		}
+		s.logger.Printf("status changes are in pull request #%d: %s\n", pr.Number, pr.HTMLURL)
 	}
-	log.Println("remote repo updated.", s.indexFilePath)
 	return nil
 }
 
-// gitCommit makes a commit to the repository and returns an error.
+// gitCommit commits the applied status changes to the repository and returns
+// an error. It returns a NoChangeNeededError rather than commit a clean
+// worktree.
 func (s *StreamersRepo) gitCommit() error {
+	commitMessage, err := s.commitMessage()
+	if err != nil {
+		return err
+	}
+	return s.commit(commitMessage)
+}
+
+// commit commits the staged changes with the message, returning a
+// NoChangeNeededError if the worktree is clean.
+func (s *StreamersRepo) commit(message string) error {
 	w, err := s.repo.Worktree()
 	if err != nil {
 		return err
 	}
-	commitMessage := ""
-	if s.online {
-		commitMessage = fmt.Sprintf("🟢 %s has gone online! [no ci]", s.streamer)
-	} else {
-		commitMessage = fmt.Sprintf("☠️  %s has gone offline! [no ci]", s.streamer)
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+	if status.IsClean() {
+		return &NoChangeNeededError{err: "no changes to commit"}
 	}
-	_, err = w.Commit(commitMessage, &git.CommitOptions{
+	_, err = w.Commit(message, &git.CommitOptions{
 		Author: &object.Signature{
-			Name:  "🤖 STATUSS (Seriously Totally Automated Twitch Updating StreamStatus)",
-			Email: "goproslowyo+statuss@users.noreply.github.com",
+			Name:  s.authorName,
+			Email: s.authorEmail,
 			When:  time.Now(),
 		},
+		// A nil key leaves the commit unsigned.
+		SignKey: s.gpgSignKey,
 	})
 	if err != nil {
 		return err
 	}
+	if s.sshSigner != nil {
+		err = s.signHeadSSH()
+		if err != nil {
+			return err
+		}
+	}
 	commit, err := s.getHeadCommit()
 	if err != nil {
 		return err
 	}
-	log.Println(commit)
+	s.logger.Println(commit)
 	return nil
 }
 
-// gitAdd adds the index file to the repository and returns an error.
+// commitMessage renders the commit message for the applied status changes,
+// one line per change. Changes that only changed a platform column are
+// rendered with whether the streamer is live on that platform.
+func (s *StreamersRepo) commitMessage() (string, error) {
+	var lines []string
+	for _, n := range append(s.applied, s.platformApplied...) {
+		tmpl := s.offlineMessage
+		if n.Online {
+			tmpl = s.onlineMessage
+		}
+		line, err := renderTemplate(tmpl, n)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// gitAdd adds the index file, and the stats page, data file, cached avatars
+// and inactive page if there are any, to the repository and returns an error.
 func (s *StreamersRepo) gitAdd() error {
-	w, err := s.repo.Worktree()
+	err := s.addFile(s.indexFilePath)
 	if err != nil {
 		return err
 	}
-	_, err = w.Add(strings.Split(s.indexFilePath, "/")[1])
+	if s.statsFilePath != "" {
+		err = s.addFile(s.statsFilePath)
+		if err != nil {
+			return err
+		}
+	}
+	if s.dataFilePath != "" {
+		err = s.addFile(s.dataFilePath)
+		if err != nil {
+			return err
+		}
+	}
+	if s.avatarDir != "" && s.hasRepoFile(s.avatarDir) {
+		err = s.addFile(s.avatarDir)
+		if err != nil {
+			return err
+		}
+	}
+	if s.hasInactivePage() {
+		return s.addFile(s.inactiveFilePath)
+	}
+	return nil
+}
+
+// addFile stages the file at path in the worktree.
+func (s *StreamersRepo) addFile(path string) error {
+	w, err := s.repo.Worktree()
 	if err != nil {
 		return err
 	}
+	_, err = w.Add(path)
+	return err
+}
+
+// loadCommitTemplates sets the commit author and parses the commit message
+// templates and the new row template from cfg.
+func (s *StreamersRepo) loadCommitTemplates(cfg *config) error {
+	var err error
+	s.authorName = cfg.CommitAuthorName
+	s.authorEmail = cfg.CommitAuthorEmail
+	s.onlineMessage, err = template.New("online").Parse(cfg.CommitOnlineTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing online commit template: %w", err)
+	}
+	s.offlineMessage, err = template.New("offline").Parse(cfg.CommitOfflineTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing offline commit template: %w", err)
+	}
+	s.newRow, err = template.New("row").Parse(cfg.NewRowTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing new row template: %w", err)
+	}
+	s.autoAddRows = cfg.AutoAddRows
+	s.footer = nil
+	if cfg.LastUpdated {
+		s.footer, err = template.New("footer").Parse(cfg.LastUpdatedTemplate)
+		if err != nil {
+			return fmt.Errorf("error parsing last updated template: %w", err)
+		}
+		s.footerLocation, err = time.LoadLocation(cfg.LastUpdatedTimezone)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// lastUpdated sets the last updated line at the bottom of text to now, if
+// there is a footer template.
+func (s *StreamersRepo) lastUpdated(text string, now time.Time) (string, error) {
+	if s.footer == nil {
+		return text, nil
+	}
+	var b strings.Builder
+	err := s.footer.Execute(&b, struct{ Time time.Time }{now.In(s.footerLocation)})
+	if err != nil {
+		return "", err
+	}
+	return render.SetFooter(text, b.String()), nil
+}
+
+// validateAuth lists the remote references to check the credentials are accepted.
+func (s *StreamersRepo) validateAuth() error {
+	remote, err := s.repo.Remote("origin")
+	if err != nil {
+		return err
+	}
+	return gitops.WithTimeout("list", s.gitTimeout, func(ctx context.Context) error {
+		_, err := remote.ListContext(ctx, &git.ListOptions{
+			Auth: s.auth,
+		})
+		return err
+	})
+}
+
 // getHeadCommit gets the commit at HEAD.
 func (s *StreamersRepo) getHeadCommit() (string, error) {
 	// Get repo head.
@@ -111,183 +364,639 @@ func (s *StreamersRepo) getHeadCommit() (string, error) {
 	return commit.String(), nil
 }
 
-// getRepo clones a repo to pwd and returns an error.
+// getRepo clones a repo to pwd, or into memory when inMemory is set, and
+// returns an error. The repository is only cloned or opened once and kept
+// for the life of the process.
 func (s *StreamersRepo) getRepo() error {
-	directory := strings.SplitN(s.url, "/", 5)[4]
-	repo, err := git.PlainClone(directory, false, &git.CloneOptions{
+	if s.repo != nil {
+		return nil
+	}
+	options := &git.CloneOptions{
 		// The intended use of a GitHub personal access token is in replace of your password
 		// because access tokens can easily be revoked.
 		// https://help.github.com/articles/creating-a-personal-access-token-for-the-command-line/
-		Auth: s.auth,
-		URL:  s.url,
+		Auth:         s.auth,
+		Depth:        s.cloneDepth,
+		SingleBranch: s.singleBranch,
+		URL:          s.url,
 		// We're discarding the stdout out here. If you'd like to see it toggle
 		// `Progress` to something like os.Stdout.
 		Progress: ioutil.Discard,
-	})
+	}
+	if s.branch != "" {
+		options.ReferenceName = plumbing.NewBranchReferenceName(s.branch)
+	}
+	repo, err := s.clone(options)
+	if errors.Is(err, git.NoMatchingRefSpecError{}) && s.branch != "" {
+		err = s.createBranch()
+		if err == nil {
+			repo, err = s.clone(options)
+		}
+	}
 
 	if err == nil {
 		s.repo = repo
 		return nil
 	}
 	// Check if the error is that the repo exists and if it is on disk open it.
-	errStr := fmt.Sprint(err)
 	// Otherwise return error
-	if !strings.Contains(errStr, "exists") {
-		return err
+	if !errors.Is(err, git.ErrRepositoryAlreadyExists) {
+		return fmt.Errorf("cloning repository: %w", err)
 	}
 	repo, err = git.PlainOpen(s.repoPath)
 	if err != nil {
 		return err
 	}
-	log.Warn("Doing git pull")
-	w, err := repo.Worktree()
+	s.repo = repo
+	return nil
+}
+
+// clone clones the repository to disk, or into memory when inMemory is set.
+func (s *StreamersRepo) clone(options *git.CloneOptions) (*git.Repository, error) {
+	var repo *git.Repository
+	err := gitops.WithTimeout("clone", s.cloneTimeout, func(ctx context.Context) error {
+		var err error
+		if s.inMemory {
+			repo, err = git.CloneContext(ctx, memory.NewStorage(), memfs.New(), options)
+		} else {
+			repo, err = git.PlainCloneContext(ctx, s.repoPath, false, options)
+		}
+		return err
+	})
+	return repo, err
+}
+
+// createBranch creates the configured branch on origin from the default branch.
+func (s *StreamersRepo) createBranch() error {
+	s.logger.Warnf("branch %s doesn't exist, creating it from the default branch", s.branch)
+	return gitops.WithTimeout("branch creation", s.cloneTimeout, func(ctx context.Context) error {
+		repo, err := git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
+			Auth:         s.auth,
+			Depth:        1,
+			SingleBranch: true,
+			URL:          s.url,
+		})
+		if err != nil {
+			return err
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return err
+		}
+		return repo.PushContext(ctx, &git.PushOptions{
+			RemoteName: "origin",
+			Auth:       s.auth,
+			RefSpecs: []gitconfig.RefSpec{
+				gitconfig.RefSpec(fmt.Sprintf("%s:refs/heads/%s", head.Name(), s.branch)),
+			},
+		})
+	})
+}
+
+// syncRepo makes sure the repository is cloned and then brings it up to date
+// with origin, discarding anything left over from a previous update. A clone
+// that can't be brought up to date is thrown away and cloned again.
+func (s *StreamersRepo) syncRepo() error {
+	err := s.getRepo()
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		s.logger.Warn("clone on disk is broken, cloning again")
+		return s.reclone()
+	}
 	if err != nil {
 		return err
 	}
-	w.Pull(&git.PullOptions{
-		Force:         true,
-		ReferenceName: "HEAD",
-		RemoteName:    "origin",
-	})
-	s.repo = repo
+	err = s.fetch()
+	// Missing local objects mean the clone is broken, or is shallow, which
+	// go-git can't fetch into once the remote history has moved on.
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		s.logger.Warn("clone can't be updated, cloning again")
+		return s.reclone()
+	}
+	if err != nil {
+		return err
+	}
+	err = s.resetToOrigin()
+	if err != nil {
+		s.logger.Warnf("can't reset clone to origin, cloning again: %s", err)
+		return s.reclone()
+	}
 	return nil
 }
 
-// writeFile writes given text and returns an error.
-func (s *StreamersRepo) writefile(text string) error {
-	bytesToWrite := []byte(text)
-	return ioutil.WriteFile(s.indexFilePath, bytesToWrite, 0644)
-}
-
-// updateStreamStatus toggles the streamers status online/offline based on the boolean online.
-// this function returns the strings in text replaced or an error.
-func (s *StreamersRepo) updateStreamStatus() error {
-	streamerLower := strings.ToLower(s.streamer)
-	if s.online {
-		var offlineTextSearch string
-		if strings.Contains(s.indexMdText, s.streamer) {
-			offlineTextSearch = fmt.Sprintf("&nbsp; | `%s`", s.streamer)
-		} else {
-			offlineTextSearch = fmt.Sprintf("&nbsp; | `%s`", streamerLower)
+// reclone discards the current clone and clones the repository again.
+func (s *StreamersRepo) reclone() error {
+	s.repo = nil
+	if !s.inMemory {
+		err := os.RemoveAll(s.repoPath)
+		if err != nil {
+			return err
 		}
-		onlineText := fmt.Sprintf("🟢 | `%s`", s.streamer)
-		onlineTextLower := fmt.Sprintf("🟢 | `%s`", streamerLower)
-		if strings.Contains(s.indexMdText, onlineText) || strings.Contains(s.indexMdText, onlineTextLower) {
-			err := &NoChangeNeededError{}
-			err.err = fmt.Sprintf("no change needed for: %s, online: %v", s.streamer, s.online)
+	}
+	return s.getRepo()
+}
+
+// writeFile writes given text to the worktree and returns an error.
+func (s *StreamersRepo) writefile(text string) error {
+	if s.dataFilePath != "" {
+		err := s.writeDataFile(text)
+		if err != nil {
 			return err
 		}
-		s.indexMdText = strings.Replace(s.indexMdText, offlineTextSearch, onlineText, 1)
-	} else {
-		var onlineTextSearch string
-		if strings.Contains(s.indexMdText, s.streamer) {
-			onlineTextSearch = fmt.Sprintf("🟢 | `%s`", s.streamer)
-		} else {
-			onlineTextSearch = fmt.Sprintf("🟢 | `%s`", streamerLower)
+	}
+	text, err := s.layout(s.indexFilePath, text)
+	if err != nil {
+		return err
+	}
+	text, err = s.lastUpdated(text, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.writeRepoFile(s.indexFilePath, text)
+}
+
+// layout renders the page at path from the rows in text with the page
+// templates, keeping what's outside the managed region, or returns text as it
+// is without them. A page that isn't in the repository yet is laid out whole,
+// and a page without the markers is left as it is.
+func (s *StreamersRepo) layout(path, text string) (string, error) {
+	if s.pages == nil {
+		return text, nil
+	}
+	page := "index.md"
+	if path == s.inactiveFilePath {
+		page = "inactive.md"
+	}
+	managed := render.Managed(text)
+	rendered, err := s.pages.Render(page, render.Headings(managed), render.ParseRows(managed))
+	if err != nil {
+		return "", err
+	}
+	if s.contents == nil && !s.hasRepoFile(path) {
+		return rendered, nil
+	}
+	spliced, err := render.Splice(text, rendered)
+	if errors.Is(err, render.ErrNoRegion) {
+		s.logger.Warnf("%s has no managed region, leaving its layout alone: %s", path, err)
+		return text, nil
+	}
+	return spliced, err
+}
+
+// writeRepoFile writes text to the file at path in the worktree.
+func (s *StreamersRepo) writeRepoFile(path, text string) error {
+	w, err := s.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	// A clone in memory can't be left half written by a crash.
+	if s.inMemory {
+		return util.WriteFile(w.Filesystem, path, []byte(text), 0644)
+	}
+	return gitops.WriteFileAtomic(filepath.Join(w.Filesystem.Root(), path), []byte(text))
+}
+
+// readRepoFile returns the contents of the file at path in the worktree.
+func (s *StreamersRepo) readRepoFile(path string) ([]byte, error) {
+	w, err := s.repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	return util.ReadFile(w.Filesystem, path)
+}
+
+// hasRepoFile reports whether the file at path exists in the worktree.
+func (s *StreamersRepo) hasRepoFile(path string) bool {
+	w, err := s.repo.Worktree()
+	if err != nil {
+		return false
+	}
+	_, err = w.Filesystem.Stat(path)
+	return err == nil
+}
+
+// updateStreamStatus sets the status of the streamer's row to online or
+// offline and renders their display name in it. The row is found by login,
+// ignoring case, or by display name for rows written with one.
+func (s *StreamersRepo) updateStreamStatus(n notification) error {
+	// Only Twitch changes have the display name.
+	rename := n.Platform == "" || n.Platform == platformTwitch
+	text, found, changed := render.SetStatus(s.indexMdText, n.Login, n.Streamer, n.Online, rename, s.style)
+	if !found {
+		return &NoChangeNeededError{err: fmt.Sprintf("no row for %s in %s", n.Streamer, s.indexFilePath), cause: ErrStreamerNotFound}
+	}
+	if !changed {
+		return &NoChangeNeededError{err: fmt.Sprintf("no change needed for: %s, online: %v", n.Streamer, n.Online)}
+	}
+	s.indexMdText = text
+	return nil
+}
+
+// applyChanges updates indexMdText with each pending change and records the
+// ones that changed the streamer's status in applied, the ones that only
+// changed a platform column in platformApplied, and the ones for streamers
+// without a row in notFound. It returns a NoChangeNeededError if none changed
+// it, caused by ErrStreamerNotFound if none of the streamers had a row.
+func (s *StreamersRepo) applyChanges() error {
+	s.applied = nil
+	s.platformApplied = nil
+	s.notFound = nil
+	for _, n := range s.pending {
+		// The row shows whether the streamer is live on any platform.
+		live := n.Online
+		n.Online = s.setLive(n.Login, n.Platform, n.Online)
+		if n.Online && s.inactiveFilePath != "" && s.restoreFromInactive(n.Login) {
+			s.logger.Printf("moved %s back from %s\n", n.Streamer, s.inactiveFilePath)
+		}
+		var added bool
+		var err error
+		if s.autoAddRows {
+			added, err = s.addRow(n)
+			if err != nil {
+				return err
+			}
 		}
-		offlineText := fmt.Sprintf("&nbsp; | `%s`", s.streamer)
-		offlineTextOnline := fmt.Sprintf("&nbsp; | `%s`", streamerLower)
-		if strings.Contains(s.indexMdText, offlineText) || strings.Contains(s.indexMdText, offlineTextOnline) {
-			err := &NoChangeNeededError{}
-			err.err = fmt.Sprintf("no change needed for: %s, online: %v", s.streamer, s.online)
+		if added {
+			s.logger.Printf("added a row for %s to %s\n", n.Streamer, s.indexFilePath)
+		}
+		err = s.updateStreamStatus(n)
+		platformChanged := s.setPlatformStatus(n.Login, n.Platform, live)
+		if errors.Is(err, ErrStreamerNotFound) && !platformChanged {
+			s.notFound = append(s.notFound, n)
+			continue
+		}
+		if errors.Is(err, ErrNoChangeNeeded) {
+			if platformChanged && !added {
+				// The row's status stays as they're live on another platform.
+				n.Online = live
+				s.platformApplied = append(s.platformApplied, n)
+				continue
+			}
+			// A row added for an offline streamer is already up to date.
+			if !added {
+				s.logger.Warnf("index.md doesn't need to be changed for %s", n.Streamer)
+				continue
+			}
+		} else if err != nil {
 			return err
 		}
-		s.indexMdText = strings.Replace(s.indexMdText, onlineTextSearch, offlineText, 1)
+		s.applied = append(s.applied, n)
+	}
+	if len(s.applied) == 0 && len(s.platformApplied) == 0 {
+		if len(s.notFound) == len(s.pending) {
+			return &NoChangeNeededError{err: "no row for any streamer", cause: ErrStreamerNotFound}
+		}
+		return &NoChangeNeededError{err: "no change needed for any streamer"}
 	}
 	return nil
 }
 
-// readFile reads in a slice of bytes from the provided path and returns a string or an error.
+// streamerNotFound reports that the change for a streamer without a row
+// couldn't be applied, counting it and opening an issue for it if enabled.
+// It's called once the change is final, as applyChanges runs again when a
+// push is retried.
+func (s *StreamersRepo) streamerNotFound(n notification) {
+	s.logger.Errorf("no row for %s in %s, the change can't be applied", n.Streamer, s.indexFilePath)
+	platform := n.Platform
+	if platform == "" {
+		platform = platformTwitch
+	}
+	streamersNotFound.Inc(platform)
+	if s.issues == nil {
+		return
+	}
+	err := s.issues.reportNotFound(n, s.indexFilePath, s.logger)
+	if err != nil {
+		s.logger.Printf("error opening issue for %s: %s\n", n.Streamer, err)
+	}
+}
+
+// wasNotFound returns the change for the login and true if it couldn't be
+// applied as the streamer has no row.
+func (s *StreamersRepo) wasNotFound(login string) (notification, bool) {
+	for _, n := range s.notFound {
+		if n.Login == login {
+			return n, true
+		}
+	}
+	return notification{}, false
+}
+
+// wasApplied reports whether a change for the login was applied to index.md.
+func (s *StreamersRepo) wasApplied(login string) bool {
+	for _, n := range append(s.applied, s.platformApplied...) {
+		if n.Login == login {
+			return true
+		}
+	}
+	return false
+}
+
+// readFile reads index.md, and the inactive page if there is one, from the
+// worktree and returns an error.
 func (s *StreamersRepo) readFile() error {
-	markdownText, err := os.ReadFile(s.indexFilePath)
+	if s.repo == nil {
+		return fmt.Errorf("repo not cloned")
+	}
+	w, err := s.repo.Worktree()
 	if err != nil {
 		return err
-	} else {
-		s.indexMdText = string(markdownText)
+	}
+	markdownText, err := util.ReadFile(w.Filesystem, s.indexFilePath)
+	if err != nil {
+		return err
+	}
+	s.indexMdText = string(markdownText)
+	if s.inactiveFilePath == "" {
 		return nil
 	}
+	// The inactive page is created when the first streamer is moved to it.
+	inactiveText, err := util.ReadFile(w.Filesystem, s.inactiveFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.inactiveMdText = string(inactiveText)
+	return nil
+}
+
+// writeFiles writes index.md, and the inactive page if there is one, to the
+// worktree.
+func (s *StreamersRepo) writeFiles() error {
+	err := s.writefile(s.indexMdText)
+	if err != nil {
+		return err
+	}
+	if !s.hasInactivePage() {
+		return nil
+	}
+	text, err := s.layout(s.inactiveFilePath, s.inactiveMdText)
+	if err != nil {
+		return err
+	}
+	return s.writeRepoFile(s.inactiveFilePath, text)
+}
+
+// hasInactivePage reports whether there is an inactive page to write, which
+// is only created once a streamer is moved to it.
+func (s *StreamersRepo) hasInactivePage() bool {
+	if s.inactiveFilePath == "" {
+		return false
+	}
+	return s.inactiveMdText != "" || s.hasRepoFile(s.inactiveFilePath)
 }
 
 // updateMarkdown reads index.md, updates the streamer's status,
 // then writes the change back to index.md and returns an error.
 func updateMarkdown(repo *StreamersRepo) error {
-	err := repo.getRepo()
+	// Updating a stale clone can't be pushed, so fail and let the change be
+	// retried instead.
+	err := repo.retry.do(repo.logger, "sync", repo.syncRepo)
 	if err != nil {
-		log.Printf("error during repo clone: %s\n", err)
+		repo.logger.Printf("error syncing repo: %s\n", err)
+		reportChangeError(err, "sync", repo)
+		return fmt.Errorf("syncing repo: %w", err)
 	}
 
 	err = repo.readFile()
 	if err != nil {
-		log.Printf("error reading file: %+s\n", err)
-		os.Exit(-1)
+		repo.logger.Printf("error reading file: %s\n", err)
+		reportChangeError(err, "read", repo)
+		return fmt.Errorf("reading %s: %w", repo.indexFilePath, err)
 	}
 
-	err = repo.updateStreamStatus()
+	err = repo.applyChanges()
+	if errors.Is(err, ErrNoChangeNeeded) {
+		return err
+	}
 	if err != nil {
-		if fmt.Sprintf("%T", err) == "*main.NoChangeNeededError" {
-			return err
-		}
-		log.Printf("error updating status: %s\n", err)
+		repo.logger.Printf("error updating status: %s\n", err)
+		return fmt.Errorf("updating status: %w", err)
 	}
-	err = repo.writefile(repo.indexMdText)
+	err = repo.writeFiles()
 	if err != nil {
-		log.Printf("error writing file: %s\n", err)
+		repo.logger.Printf("error writing file: %s\n", err)
+		return fmt.Errorf("writing %s: %w", repo.indexFilePath, err)
 	}
 	return nil
 }
 
-// updateRepo adds and commits the chanages to the repository.
-func updateRepo(repo *StreamersRepo) {
+// updateRepo adds and commits the chanages to the repository. It returns a
+// NoChangeNeededError if there was nothing to commit.
+func updateRepo(repo *StreamersRepo) error {
 	err := repo.gitAdd()
 	if err != nil {
-		log.Printf("error git adding file: error: %s\n", err)
+		repo.logger.Printf("error git adding file: error: %s\n", err)
+		return fmt.Errorf("adding files: %w", err)
 	}
 
 	err = repo.gitCommit()
+	if errors.Is(err, ErrNoChangeNeeded) {
+		repo.logger.Warn("index.md is unchanged, nothing to commit")
+		return err
+	}
+	if err != nil {
+		repo.logger.Printf("error making commit: %s\n", err)
+		return fmt.Errorf("committing: %w", err)
+	}
+	return nil
+}
+
+// withCloneLock calls fn holding the lock on the clone, if it has one.
+func (s *StreamersRepo) withCloneLock(fn func() error) error {
+	if s.lock == nil {
+		return fn()
+	}
+	err := s.lock.Acquire(s.logger)
+	if err != nil {
+		return err
+	}
+	defer s.lock.Release()
+	return fn()
+}
+
+// gitClone returns the clone as checked against origin.
+func (s *StreamersRepo) gitClone() *gitops.Clone {
+	return &gitops.Clone{Repo: s.repo, Remote: "origin", Auth: s.auth, Timeout: s.gitTimeout}
+}
+
+// fetch fetches origin and returns an error.
+func (s *StreamersRepo) fetch() error {
+	err := gitops.WithTimeout("fetch", s.gitTimeout, func(ctx context.Context) error {
+		return s.repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: "origin",
+			Auth:       s.auth,
+			Depth:      s.cloneDepth,
+		})
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) || errors.Is(err, transport.ErrEmptyUploadPackRequest) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching origin: %w", err)
+	}
+	return nil
+}
+
+// resetToOrigin hard resets the current branch to its remote counterpart,
+// discarding local commits and changes.
+func (s *StreamersRepo) resetToOrigin() error {
+	head, err := s.repo.Head()
+	if err != nil {
+		return err
+	}
+	if s.branch != "" && head.Name() != plumbing.NewBranchReferenceName(s.branch) {
+		return fmt.Errorf("clone is on %s rather than %s", head.Name().Short(), s.branch)
+	}
+	remoteRef, err := s.repo.Reference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), true)
+	if err != nil {
+		return err
+	}
+	if gitops.HasDiverged(s.gitClone(), head.Hash(), remoteRef.Hash()) {
+		s.logger.Warnf("local %s has diverged from origin, discarding local commits", head.Name().Short())
+	}
+	w, err := s.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return w.Reset(&git.ResetOptions{
+		Commit: remoteRef.Hash(),
+		Mode:   git.HardReset,
+	})
+}
+
+// reapplyChange resets to the remote branch and makes the current status
+// change again on top of it.
+func (s *StreamersRepo) reapplyChange() error {
+	err := s.syncRepo()
+	if err != nil {
+		return err
+	}
+	err = s.readFile()
 	if err != nil {
-		log.Printf("error making commit: %s\n", err)
+		return err
+	}
+	err = s.applyChanges()
+	if err != nil {
+		return err
+	}
+	err = s.writeFiles()
+	if err != nil {
+		return err
 	}
+	err = s.gitAdd()
+	if err != nil {
+		return err
+	}
+	return s.gitCommit()
 }
 
-// pushRepo pushes the committed changes to GitHub.
-func pushRepo(repo *StreamersRepo) {
-	err := repo.gitPush()
+// pushRepo pushes the committed changes to GitHub and returns an error if
+// they couldn't be pushed, or a NoChangeNeededError if the remote already has
+// them.
+func pushRepo(repo *StreamersRepo) error {
+	err := repo.retry.do(repo.logger, "push", repo.gitPush)
+	// If someone else pushed in the meantime, replay the change on top of
+	// their commits and try again.
+	for attempt := 1; errors.Is(err, gitops.ErrPushRejected) && attempt < maxPushAttempts; attempt++ {
+		repo.logger.Warnf("remote has new commits, re-applying change and retrying push (attempt %d)", attempt+1)
+		err = repo.reapplyChange()
+		if errors.Is(err, ErrNoChangeNeeded) {
+			repo.logger.Warn("remote already has the changes")
+			return &NoChangeNeededError{err: "remote already has the changes"}
+		}
+		if err == nil {
+			err = repo.retry.do(repo.logger, "push", repo.gitPush)
+		}
+	}
 	if err != nil {
-		log.Printf("error pushing repo to GitHub: %s\n", err)
+		repo.logger.Printf("error pushing repo to GitHub: %s\n", err)
+		reportChangeError(err, "push", repo)
 	}
+	return err
 }
 
-// eventSubNotification is a struct to hold the eventSub webhook request from Twitch.
-type eventSubNotification struct {
-	Challenge    string                     `json:"challenge"`
-	Event        json.RawMessage            `json:"event"`
-	Subscription helix.EventSubSubscription `json:"subscription"`
+// webhookHandler receives EventSub webhook requests and queues the resulting status changes.
+type webhookHandler struct {
+	// mu guards the settings that are reloaded, broadcasters and liveOnly.
+	mu           sync.RWMutex
+	broadcasters *broadcasterFilter
+	// liveOnly ignores online events for streams that aren't live, such as reruns.
+	liveOnly bool
+	// limiter, if set, refuses requests over the configured rate limits.
+	limiter      *server.RateLimiter
+	maxBodyBytes int64
+	queue        *updateQueue
+	secret       string
+	// secondarySecret, if set, is accepted as well as secret so the secret
+	// can be rotated.
+	secondarySecret string
+	// verifyFailures counts consecutive signature verification failures.
+	verifyFailures int32
+}
+
+// settings returns the broadcaster filter and whether only live streams count.
+func (h *webhookHandler) settings() (*broadcasterFilter, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.broadcasters, h.liveOnly
+}
+
+// setSettings replaces the broadcaster filter and whether only live streams
+// count.
+func (h *webhookHandler) setSettings(broadcasters *broadcasterFilter, liveOnly bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcasters, h.liveOnly = broadcasters, liveOnly
 }
 
 // eventsubStatus takes and http Request and ResponseWriter to handle the incoming webhook request.
-func (s *StreamersRepo) eventsubStatus(w http.ResponseWriter, r *http.Request) {
-	// Read the request body.
-	body, err := ioutil.ReadAll(r.Body)
+func (h *webhookHandler) eventsubStatus(w http.ResponseWriter, r *http.Request) {
+	// Tag every log line for this event so it can be traced through processing.
+	eventID := r.Header.Get("Twitch-Eventsub-Message-Id")
+	logger := log.WithFields(log.Fields{"event_id": eventID, "client_ip": server.ClientIP(r)})
+
+	// Refuse floods before spending any time on the body or its signature.
+	if h.limiter != nil && !h.limiter.Allow(server.ClientIP(r)) {
+		logger.Println("rate limited request")
+		w.Header().Set("Retry-After", "1")
+		server.WriteError(w, http.StatusTooManyRequests, "too many requests")
+		return
+	}
+
+	// Read the request body, refusing anything larger than the configured cap.
+	// One byte more than the cap is read to tell a body at the cap from a
+	// larger one.
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, h.maxBodyBytes+1))
 	if err != nil {
-		log.Println(err)
+		logger.Println(err)
+		server.WriteError(w, http.StatusBadRequest, "error reading request body")
 		return
 	}
 	defer r.Body.Close()
+	if int64(len(body)) > h.maxBodyBytes {
+		logger.Printf("request body larger than %d bytes\n", h.maxBodyBytes)
+		server.WriteError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
 
 	// Verify that the notification came from twitch using the secret.
-	if !helix.VerifyEventSubNotification(os.Getenv("SS_SECRETKEY"), r.Header, string(body)) {
-		log.Println("invalid signature on message")
+	if !twitch.Verify(r.Header, string(body), h.secret, h.secondarySecret) {
+		logger.Println("invalid signature on message")
+		reportVerifyFailures(atomic.AddInt32(&h.verifyFailures, 1), r)
+		server.WriteError(w, http.StatusForbidden, "invalid signature")
 		return
 	} else {
-		log.Println("verified signature on message")
+		logger.Println("verified signature on message")
+		atomic.StoreInt32(&h.verifyFailures, 0)
 	}
+	// Only payloads from Twitch are dumped, so others can't fill the logs.
+	debugPayload(logger, r.Header, body)
 
-	// Read the request into eventSubNotification struct.
-
-	var vals eventSubNotification
+	// Read the request into a twitch.Notification struct.
+	var vals twitch.Notification
 	err = json.NewDecoder(bytes.NewReader(body)).Decode(&vals)
 	if err != nil {
-		log.Println(err)
+		logger.Println(err)
+		server.WriteError(w, http.StatusBadRequest, "malformed notification")
 		return
 	}
 
@@ -297,81 +1006,568 @@ func (s *StreamersRepo) eventsubStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if vals.Subscription.Type == "stream.offline" {
-		var offlineEvent helix.EventSubStreamOfflineEvent
-		_ = json.NewDecoder(bytes.NewReader(vals.Event)).Decode(&offlineEvent)
-		log.Printf("got offline event for: %s\n", offlineEvent.BroadcasterUserName)
+	// Revocations carry the subscription but no event, so only notifications
+	// are handled as events.
+	switch messageType := r.Header.Get("Twitch-Eventsub-Message-Type"); messageType {
+	case twitch.MessageTypeNotification:
+	case twitch.MessageTypeRevocation:
+		h.subscriptionRevoked(logger, vals.Subscription)
 		w.WriteHeader(200)
 		w.Write([]byte("ok"))
-		s.streamer = offlineEvent.BroadcasterUserName
-		s.online = false
-		err := updateMarkdown(s)
-		if err == nil {
-			updateRepo(s)
-			pushRepo(s)
+		return
+	default:
+		logger.Errorf("error: unsupported message type %q", messageType)
+		server.WriteError(w, http.StatusBadRequest, fmt.Sprintf("unsupported message type: %s", messageType))
+		return
+	}
+
+	broadcasters, liveOnly := h.settings()
+	var change statusChange
+	if vals.Subscription.Type == "stream.offline" || vals.Subscription.Type == "stream.online" {
+		event, err := twitch.DecodeStreamEvent(vals)
+		if err != nil {
+			logger.Println(err)
+			server.WriteError(w, http.StatusBadRequest, "malformed event")
+			return
+		}
+		if event.Online {
+			logger.Printf("got online event for: %s\n", event.UserName)
 		} else {
-			log.Warnf("index.md doesn't need to be changed for %s", s.streamer)
+			logger.Printf("got offline event for: %s\n", event.UserName)
+		}
+		if liveOnly && event.Online && event.Type != "live" {
+			logger.Printf("ignoring %s stream for %s\n", event.Type, event.UserName)
+			w.WriteHeader(200)
+			w.Write([]byte("ignored"))
+			return
+		}
+		change = statusChange{
+			id:           eventID,
+			login:        event.UserLogin,
+			online:       event.Online,
+			streamer:     event.UserName,
+			userID:       event.UserID,
+			notification: body,
+		}
+	} else if vals.Subscription.Type == "user.update" {
+		var userEvent helix.EventSubUserUpdateEvent
+		err = json.NewDecoder(bytes.NewReader(vals.Event)).Decode(&userEvent)
+		if err != nil {
+			logger.Println(err)
+			server.WriteError(w, http.StatusBadRequest, "malformed event")
+			return
 		}
-	} else if vals.Subscription.Type == "stream.online" {
-		var onlineEvent helix.EventSubStreamOnlineEvent
-		_ = json.NewDecoder(bytes.NewReader(vals.Event)).Decode(&onlineEvent)
-		log.Printf("got online event for: %s\n", onlineEvent.BroadcasterUserName)
+		logger.Printf("got user update event for: %s\n", userEvent.UserName)
+		h.renameStreamer(w, logger, userEvent)
+		return
+	} else if vals.Subscription.Type == "user.authorization.revoke" {
+		var revokeEvent helix.EventSubUserAuthenticationRevokeEvent
+		err = json.NewDecoder(bytes.NewReader(vals.Event)).Decode(&revokeEvent)
+		if err != nil {
+			logger.Println(err)
+			server.WriteError(w, http.StatusBadRequest, "malformed event")
+			return
+		}
+		h.revokeAuthorization(logger, eventID, revokeEvent)
 		w.WriteHeader(200)
 		w.Write([]byte("ok"))
-		s.streamer = onlineEvent.BroadcasterUserName
-		s.online = true
-		err := updateMarkdown(s)
-		if err == nil {
-			updateRepo(s)
-			pushRepo(s)
-		} else {
-			log.Warnf("index.md doesn't need to be changed for %s", s.streamer)
+		return
+	} else if vals.Subscription.Type == "channel.update" {
+		var channelEvent helix.EventSubChannelUpdateEvent
+		err = json.NewDecoder(bytes.NewReader(vals.Event)).Decode(&channelEvent)
+		if err != nil {
+			logger.Println(err)
+			server.WriteError(w, http.StatusBadRequest, "malformed event")
+			return
+		}
+		logger.Printf("got channel update event for: %s\n", channelEvent.BroadcasterUserName)
+		// Streamers often change their schedule along with their channel.
+		allowed := broadcasters == nil || broadcasters.allows(channelEvent.BroadcasterUserLogin, channelEvent.BroadcasterUserID)
+		if h.queue.scheduleInterval > 0 && h.queue.twitch != nil && allowed {
+			h.queue.scheduleTask("next stream of "+channelEvent.BroadcasterUserName, func() error {
+				return h.queue.updateSchedules(channelEvent.BroadcasterUserLogin)
+			})
 		}
+		w.WriteHeader(200)
+		w.Write([]byte("ok"))
+		return
 	} else {
-		log.Errorf("error: event type %s has not been implemented -- pull requests welcome!", r.Header.Get("Twitch-Eventsub-Subscription-Type"))
+		logger.Errorf("error: event type %s has not been implemented -- pull requests welcome!", vals.Subscription.Type)
+		server.WriteError(w, http.StatusBadRequest, fmt.Sprintf("unsupported event type: %s", vals.Subscription.Type))
+		return
+	}
+
+	// Acknowledge events for other broadcasters so Twitch doesn't retry them.
+	if broadcasters != nil && !broadcasters.allows(change.login, change.userID) {
+		logger.Printf("ignoring event for %s, not an allowed broadcaster\n", change.streamer)
+		w.WriteHeader(200)
+		w.Write([]byte("ignored"))
+		return
+	}
+
+	// Queue the change so git operations happen one at a time and can be
+	// drained on shutdown. Ask Twitch to retry if it can't be accepted.
+	if !h.queue.enqueue(change) {
+		server.WriteError(w, http.StatusServiceUnavailable, "update queue unavailable")
+		return
+	}
+	w.WriteHeader(200)
+	w.Write([]byte("ok"))
+}
+
+// renameStreamer schedules the rows and stored state of the streamer in a
+// user.update event to be rewritten for its new names. Renames need the old
+// login from the status database and commit to a clone, so without them the
+// event is only acknowledged.
+func (h *webhookHandler) renameStreamer(w http.ResponseWriter, logger *log.Entry, e helix.EventSubUserUpdateEvent) {
+	if h.queue.twitch != nil {
+		h.queue.twitch.forgetUser(e.UserID)
 	}
+	broadcasters, _ := h.settings()
+	if broadcasters != nil && !broadcasters.allows(e.UserLogin, e.UserID) {
+		logger.Printf("ignoring event for %s, not an allowed broadcaster\n", e.UserName)
+	} else if h.queue.statuses == nil || h.queue.repo.contents != nil {
+		logger.Warnf("ignoring rename of %s, renames need the status database and the git backend", e.UserName)
+	} else if !h.queue.scheduleRename(e.UserID, e.UserLogin, e.UserName, 1) {
+		// Twitch retries the event, possibly on the instance taking changes.
+		server.WriteError(w, http.StatusServiceUnavailable, "update queue unavailable")
+		return
+	}
+	w.WriteHeader(200)
+	w.Write([]byte("ok"))
 }
 
 // main do the work.
 func main() {
-	// Setup file and repo paths.
-	var repoUrl string
-	if len(os.Getenv("SS_GH_REPO")) == 0 {
-		log.Warn("warning: no SS_GH_REPO specified in environment, defaulting to: https://github.com/infosecstreams/infosecstreams.github.io")
-		repoUrl = "https://github.com/infosecstreams/infosecstreams.github.io"
+	// Flags override the environment, which overrides the env file.
+	args, flagNames, err := applyFlags(os.Args[1:])
+	if err != nil {
+		log.Fatalf("error applying flags: %s", err)
+	}
+	err = loadEnvFile()
+	if err != nil {
+		log.Fatalf("error loading env file: %s", err)
+	}
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
-	repoPath := strings.Split(repoUrl, "/")[4]
-	filePath := repoPath + "/index.md"
 
-	// Setup auth.
-	if len(os.Getenv("SS_USERNAME")) == 0 || len(os.Getenv("SS_TOKEN")) == 0 || len(os.Getenv("SS_SECRETKEY")) == 0 {
-		log.Fatalln("error: no SS_USERNAME and/or SS_TOKEN and/or SS_SECRETKEY specified in environment!")
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("error loading config: %s", err)
 	}
-	auth := &httpauth.BasicAuth{
-		Username: os.Getenv("SS_USERNAME"),
-		Password: os.Getenv("SS_TOKEN"),
+	err = checkFlags(flagNames)
+	if err != nil {
+		log.Fatalf("error loading config: %s", err)
+	}
+	err = setupLogging(cfg)
+	if err != nil {
+		log.Fatalf("error setting up logging: %s", err)
+	}
+	err = setupSentry(cfg)
+	if err != nil {
+		log.Fatalf("error setting up sentry: %s", err)
+	}
+	defer sentry.Flush(sentryFlushTimeout)
+
+	err = cmd(cfg, args)
+	if err != nil {
+		log.Fatalf("error running %s: %s", name, err)
+	}
+}
+
+// newQueue sets up the site repo and the queue of changes to it, with the
+// stores, clients and notifiers configured.
+func newQueue(cfg *config) *updateQueue {
+	// Setup file and repo paths.
+	repoPath := repoDirectory(cfg.RepoURL)
+
+	// Setup auth.
+	auth, err := newGitAuth(cfg)
+	if err != nil {
+		log.Fatalf("error setting up git auth: %s", err)
 	}
 
 	// Create StreamersRepo object
 	var repo = StreamersRepo{
-		auth:          auth,
-		indexFilePath: filePath,
-		repoPath:      repoPath,
-		url:           repoUrl,
+		auth:             auth,
+		branch:           cfg.Branch,
+		cloneDepth:       int(cfg.CloneDepth),
+		inMemory:         cfg.CloneStorage == "memory",
+		singleBranch:     cfg.CloneSingleBranch,
+		indexFilePath:    "index.md",
+		statsFilePath:    cfg.StatsFilePath,
+		dataFilePath:     cfg.DataFilePath,
+		avatarDir:        cfg.AvatarDir,
+		inactiveFilePath: cfg.InactiveFilePath,
+		style:            render.Styles[cfg.StatusStyle],
+		lock:             gitops.NewCloneLock(repoPath, cfg.CloneStorage == "memory"),
+		logger:           log.NewEntry(log.StandardLogger()),
+		repoPath:         repoPath,
+		url:              cfg.RepoURL,
+	}
+	repo.retry, err = newRetryPolicy(cfg)
+	if err != nil {
+		log.Fatalf("error loading retry policy: %s", err)
+	}
+	repo.cloneTimeout, err = time.ParseDuration(cfg.GitCloneTimeout)
+	if err != nil {
+		log.Fatalf("error parsing git clone timeout: %s", err)
+	}
+	repo.gitTimeout, err = time.ParseDuration(cfg.GitTimeout)
+	if err != nil {
+		log.Fatalf("error parsing git timeout: %s", err)
+	}
+	repo.contents, err = newContentsAPI(cfg, auth)
+	if err != nil {
+		log.Fatalf("error setting up github api backend: %s", err)
+	}
+	repo.pullRequests, err = newPullRequester(cfg, auth)
+	if err != nil {
+		log.Fatalf("error setting up pull request mode: %s", err)
+	}
+	repo.issues, err = newIssueReporter(cfg, auth)
+	if err != nil {
+		log.Fatalf("error setting up issues for missing streamers: %s", err)
+	}
+	err = repo.loadCommitTemplates(cfg)
+	if err != nil {
+		log.Fatalf("error loading commit templates: %s", err)
+	}
+	if cfg.PageTemplates {
+		repo.pages, err = render.LoadTemplates(cfg.PageTemplateDir)
+		if err != nil {
+			log.Fatalf("error loading page templates: %s", err)
+		}
+	}
+	err = repo.loadSigningKey(cfg)
+	if err != nil {
+		log.Fatalf("error loading commit signing key: %s", err)
+	}
+	queue := newUpdateQueue(&repo, updateQueueSize)
+	queue.batchWindow, err = time.ParseDuration(cfg.BatchWindow)
+	if err != nil {
+		log.Fatalf("error parsing batch window: %s", err)
 	}
+	queue.failed, err = newRetryQueue(cfg)
+	if err != nil {
+		log.Fatalf("error opening retry queue: %s", err)
+	}
+	queue.deadLetters = newDeadLetterLog(cfg)
+	queue.statuses, err = newStatusStore(cfg)
+	if err != nil {
+		log.Fatalf("error opening status database: %s", err)
+	}
+	if queue.statuses != nil {
+		err = queue.loadStatuses()
+		if err != nil {
+			log.Fatalf("error reading status database: %s", err)
+		}
+	}
+	queue.ciSkipMarker = ciSkipMarkers[cfg.Provider]
+	queue.summaryFilePath = cfg.SummaryFilePath
+	queue.inactiveAfter, err = time.ParseDuration(cfg.InactiveAfter)
+	if err != nil {
+		log.Fatalf("error parsing inactivity period: %s", err)
+	}
+	queue.twitch, err = newTwitchClient(cfg, repo.retry)
+	if err != nil {
+		log.Printf("error setting up twitch client, stream details unavailable: %s\n", err)
+	}
+	if queue.twitch != nil {
+		queue.twitch.costWarning = int(*cfg.SubscriptionCostWarning)
+	}
+	queue.verifyStatus = cfg.VerifyStatus
+	queue.pushAlertAfter = int(cfg.PushFailureAlert)
+	queue.calendar = newCalendar(cfg)
+	if cfg.ScheduleInterval != "" {
+		queue.scheduleInterval, err = time.ParseDuration(cfg.ScheduleInterval)
+		if err != nil {
+			log.Fatalf("error parsing schedule interval: %s", err)
+		}
+	}
+	if cfg.LastLiveInterval != "" {
+		queue.lastLiveInterval, err = time.ParseDuration(cfg.LastLiveInterval)
+		if err != nil {
+			log.Fatalf("error parsing last live interval: %s", err)
+		}
+	}
+	if cfg.TwitchTeam != "" {
+		queue.team = &teamRoster{name: cfg.TwitchTeam, callbackURL: cfg.CallbackURL, secret: cfg.SecretKey}
+		queue.team.interval, err = time.ParseDuration(cfg.TwitchTeamInterval)
+		if err != nil {
+			log.Fatalf("error parsing team sync interval: %s", err)
+		}
+	}
+	queue.notifiers, err = newNotifiers(cfg)
+	if err != nil {
+		log.Fatalf("error setting up notifiers: %s", err)
+	}
+	return queue
+}
 
-	port := ":8080"
-	// Google Cloud Run defaults to 8080. Their platform
-	// sets the $PORT ENV var if you override it with, e.g.:
-	// `gcloud run services update <service-name> --port <port>`.
-	if os.Getenv("PORT") != "" {
-		port = ":" + os.Getenv("PORT")
-	} else if os.Getenv("SS_PORT") != "" {
-		port = ":" + os.Getenv("SS_PORT")
+// serve receives webhooks and applies the status changes until it's signalled
+// to stop.
+func serve(cfg *config, args []string) error {
+	queue := newQueue(cfg)
+	repo := queue.repo
+	var err error
+	queue.redis, err = newRedisQueue(cfg)
+	if err != nil {
+		log.Fatalf("error connecting to redis: %s", err)
 	}
+	if queue.redis != nil {
+		goWorker("redis queue", func() { queue.redis.run(queue) })
+	}
+	summaryDay, err := parseWeekday(cfg.SummaryDay)
+	if err != nil {
+		log.Fatalf("error parsing summary day: %s", err)
+	}
+	streamers, err := loadRoster(cfg)
+	if err != nil {
+		log.Fatalf("error loading roster: %s", err)
+	}
+	queue.setRoster(streamers)
+	pollInterval, err := time.ParseDuration(cfg.PollInterval)
+	if err != nil {
+		log.Fatalf("error parsing poll interval: %s", err)
+	}
+	subscriptionCheckInterval, err := time.ParseDuration(cfg.SubscriptionCheckInterval)
+	if err != nil {
+		log.Fatalf("error parsing subscription check interval: %s", err)
+	}
+	var sources []statusSource
+	if youtube := newYouTubeSource(cfg, repo.retry); youtube != nil {
+		sources = append(sources, youtube)
+	}
+	if kick := newKickSource(cfg, repo.retry); kick != nil {
+		sources = append(sources, kick)
+	}
+	if trovo := newTrovoSource(cfg, repo.retry); trovo != nil {
+		sources = append(sources, trovo)
+	}
+	for _, source := range newURLSources(cfg, repo.retry) {
+		sources = append(sources, source)
+	}
+	port := ":" + cfg.Port
+
+	// Clone the repo and validate credentials in the background so the
+	// health endpoints can answer while it happens, then start processing
+	// queued changes and the workers scheduling tasks.
+	ready := &readiness{}
+	ready.setSecretPresent(cfg.SecretKey != "")
+	queue.ready = ready
+	go func() {
+		if !checkReadiness(repo, ready) {
+			goWorker("readiness checks", func() { recheckReadiness(repo, ready, queue.done) })
+		}
+		go queue.run()
+		if queue.currentRoster().hasLinks() && repo.contents == nil {
+			queue.scheduleTask("roster links", queue.updateRosterLinks)
+		}
+		if queue.failed != nil {
+			goWorker("retry queue", func() { queue.failed.run(queue) })
+		}
+		if queue.summaryFilePath != "" {
+			goWorker("summaries", func() { queue.runSummaries(summaryDay) })
+		}
+		if repo.inactiveFilePath != "" {
+			goWorker("inactive checks", queue.runInactiveChecks)
+		}
+		if queue.twitch != nil && cfg.CallbackURL != "" {
+			go func() {
+				err := queue.twitch.subscribeRevocations(cfg.CallbackURL, cfg.SecretKey, log.WithField("event_id", "revocations"))
+				if err != nil {
+					log.Printf("error subscribing to authorization revocations: %s\n", err)
+				}
+			}()
+		}
+		if queue.team != nil && queue.twitch != nil {
+			goWorker("team sync", queue.runTeamSync)
+		}
+		if queue.scheduleInterval > 0 && queue.twitch != nil {
+			goWorker("schedule updates", func() { queue.runScheduleUpdates(queue.scheduleInterval) })
+		}
+		if queue.lastLiveInterval > 0 {
+			goWorker("last live updates", func() { queue.runLastLiveUpdates(queue.lastLiveInterval) })
+		}
+		if queue.twitch != nil {
+			goWorker("subscription monitor", func() { queue.twitch.monitorSubscriptions(subscriptionCheckInterval, queue.done) })
+		}
+		for _, source := range sources {
+			source := source
+			goWorker("poller "+source.platform(), func() { queue.runPoller(source, pollInterval) })
+		}
+	}()
+	handler := &webhookHandler{
+		broadcasters:    newBroadcasterFilter(cfg),
+		limiter:         server.NewRateLimiter(float64(cfg.WebhookRateLimit), float64(cfg.WebhookRateBurst), float64(cfg.WebhookIPRateLimit), float64(cfg.WebhookIPRateBurst)),
+		liveOnly:        cfg.LiveOnly,
+		maxBodyBytes:    cfg.MaxBodyBytes,
+		queue:           queue,
+		secret:          cfg.SecretKey,
+		secondarySecret: cfg.SecondarySecretKey,
+	}
+
+	reloader := &reloader{handler: handler, queue: queue}
 
 	// Listen and serve.
-	log.Printf("server starting on %s\n", port)
-	http.HandleFunc("/webhook/callbacks", repo.eventsubStatus)
-	log.Fatal(http.ListenAndServe(port, nil))
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.WebhookPath, handler.eventsubStatus)
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", ready.readyz)
+	mux.HandleFunc("/metrics", server.ServeMetrics)
+	openAPI, err := newOpenAPIHandler(cfg.WebhookPath)
+	if err != nil {
+		log.Fatalf("error rendering openapi document: %s", err)
+	}
+	mux.HandleFunc("/openapi.json", openAPI.serve)
+	if queue.calendar != nil {
+		mux.HandleFunc("/calendar.ics", queue.calendar.serve)
+	}
+	if cfg.AdminToken != "" {
+		admin := &adminHandler{
+			deadLetters: queue.deadLetters,
+			queue:       queue,
+			statuses:    queue.statuses,
+			reloader:    reloader,
+			token:       cfg.AdminToken,
+			webhook:     handler,
+			callbackURL: cfg.CallbackURL,
+		}
+		mux.HandleFunc("/admin/reload", admin.reloadConfig)
+		mux.HandleFunc("/dashboard", admin.dashboard)
+		if queue.twitch != nil {
+			mux.HandleFunc("/admin/subscriptions", admin.subscriptions)
+			if repo.contents == nil {
+				mux.HandleFunc("/admin/streamers", admin.streamers)
+				mux.HandleFunc("/admin/reconcile", admin.reconcile)
+			}
+		}
+		if admin.deadLetters != nil {
+			mux.HandleFunc("/admin/dead-letters", admin.listDeadLetters)
+			mux.HandleFunc("/admin/dead-letters/replay", admin.replayDeadLetters)
+		}
+		if admin.statuses != nil {
+			mux.HandleFunc("/history", admin.history)
+			mux.HandleFunc("/admin/revocations", admin.revocations)
+			graphQL, err := newGraphQLHandler(admin)
+			if err != nil {
+				log.Fatalf("error parsing graphql schema: %s", err)
+			}
+			mux.HandleFunc("/graphql", graphQL.serve)
+		}
+		if cfg.DebugSimulate {
+			mux.HandleFunc("/debug/simulate", admin.simulate)
+		}
+	}
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("error parsing trusted proxies: %s", err)
+	}
+	httpServer := &http.Server{
+		Addr:              port,
+		Handler:           proxies.handler(sentryHandler(server.RecoverHandler(mux))),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+	// Terminate TLS ourselves when domains are configured, answering ACME
+	// challenges on a second plain HTTP listener.
+	var challengeServer *http.Server
+	if len(cfg.TLSDomains) > 0 {
+		certManager := newCertManager(cfg)
+		httpServer.TLSConfig = certManager.TLSConfig()
+		challengeServer = newChallengeServer(cfg, certManager)
+		go func() {
+			log.Printf("acme challenge server starting on %s\n", challengeServer.Addr)
+			err := challengeServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != "" {
+		queue.watchers = newStatusWatchers()
+		grpcServer = newGRPCServer(cfg, queue, httpServer.TLSConfig)
+		go serveGRPC(grpcServer, ":"+cfg.GRPCPort)
+	}
+	go func() {
+		log.Printf("server starting on %s\n", port)
+		var err error
+		if httpServer.TLSConfig != nil {
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Reload the settings that can change on SIGHUP.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			err := reloader.reload()
+			if err != nil {
+				log.Printf("error reloading config: %s\n", err)
+			}
+		}
+	}()
+
+	// Wait for a signal then stop accepting webhooks and finish any queued
+	// git operations before exiting.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Printf("received %s, shutting down\n", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Printf("error shutting down server: %s\n", err)
+	}
+	if challengeServer != nil {
+		err = challengeServer.Shutdown(ctx)
+		if err != nil {
+			log.Printf("error shutting down acme challenge server: %s\n", err)
+		}
+	}
+	if grpcServer != nil {
+		queue.watchers.close()
+		grpcServer.GracefulStop()
+	}
+	if queue.redis != nil {
+		queue.redis.shutdown()
+	}
+	err = queue.shutdown(ctx)
+	if err != nil {
+		log.Printf("error draining update queue: %s\n", err)
+	}
+	if queue.redis != nil {
+		err = queue.redis.close()
+		if err != nil {
+			log.Printf("error closing redis queue: %s\n", err)
+		}
+	}
+	closeNotifiers(queue.notifiers)
+	queue.closeStores()
+	log.Println("shutdown complete.")
+	return nil
 }
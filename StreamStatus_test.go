@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+)
+
+const (
+	testSecret          = "testsecret"
+	testSecondarySecret = "oldtestsecret"
+)
+
+// newTestRequest builds a webhook request of the message type signed with
+// secret.
+func newTestRequest(secret, messageType, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/callbacks", strings.NewReader(body))
+	id := "e76c6bd4-55c9-4987-8304-da1588d8988b"
+	timestamp := "2021-07-24T08:09:34.816454134Z"
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + timestamp + body))
+	req.Header.Set("Twitch-Eventsub-Message-Id", id)
+	req.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+	req.Header.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("Twitch-Eventsub-Message-Type", messageType)
+	return req
+}
+
+// newTestHandler returns a handler with an unstarted queue of the given size.
+func newTestHandler(queueSize int) *webhookHandler {
+	return &webhookHandler{
+		maxBodyBytes:    defaultMaxBodyBytes,
+		queue:           newUpdateQueue(&StreamersRepo{}, queueSize),
+		secret:          testSecret,
+		secondarySecret: testSecondarySecret,
+	}
+}
+
+const onlineBody = `{
+  "subscription": {"id": "607e9634-8600-450c-948e-8cc1380fa9fe", "type": "stream.online", "version": "1"},
+  "event": {"broadcaster_user_id": "555942272", "broadcaster_user_login": "goproslowyo", "broadcaster_user_name": "GoProSlowYo", "type": "live"}
+}`
+
+const revocationBody = `{
+  "subscription": {"id": "f1c2a387-161a-49f9-a165-0f21d7a4e1c4", "status": "authorization_revoked", "type": "stream.online", "version": "1", "condition": {"broadcaster_user_id": "555942272"}}
+}`
+
+func TestEventsubStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		secret      string
+		messageType string
+		body        string
+		queueSize   int
+		status      int
+		errorBody   bool
+		response    string
+	}{
+		{"bad signature", "wrong", "notification", onlineBody, 1, http.StatusForbidden, true, ""},
+		{"malformed json", testSecret, "notification", `{"subscription":`, 1, http.StatusBadRequest, true, ""},
+		{"unsupported type", testSecret, "notification", `{"subscription": {"type": "channel.follow"}, "event": {}}`, 1, http.StatusBadRequest, true, ""},
+		{"unsupported message type", testSecret, "keepalive", onlineBody, 1, http.StatusBadRequest, true, ""},
+		{"oversized body", testSecret, "notification", strings.Repeat("a", defaultMaxBodyBytes+1), 1, http.StatusRequestEntityTooLarge, true, ""},
+		{"challenge", testSecret, "webhook_callback_verification", `{"challenge": "pogchamp-kappa-360noscope-vohiyo"}`, 1, http.StatusOK, false, "pogchamp-kappa-360noscope-vohiyo"},
+		{"online event", testSecret, "notification", onlineBody, 1, http.StatusOK, false, "ok"},
+		{"secondary secret", testSecondarySecret, "notification", onlineBody, 1, http.StatusOK, false, "ok"},
+		{"revocation", testSecret, "revocation", revocationBody, 1, http.StatusOK, false, "ok"},
+		{"queue full", testSecret, "notification", onlineBody, 0, http.StatusServiceUnavailable, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(tt.queueSize)
+			rec := httptest.NewRecorder()
+			h.eventsubStatus(rec, newTestRequest(tt.secret, tt.messageType, tt.body))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.errorBody {
+				if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q, want application/json", ct)
+				}
+				var resp server.ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("error decoding error body: %s", err)
+				}
+				if resp.Status != tt.status || resp.Error == "" {
+					t.Errorf("error body = %+v", resp)
+				}
+			} else if rec.Body.String() != tt.response {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.response)
+			}
+		})
+	}
+}
+
+func TestEventsubStatusQueuesChange(t *testing.T) {
+	h := newTestHandler(1)
+	rec := httptest.NewRecorder()
+	h.eventsubStatus(rec, newTestRequest(testSecret, "notification", onlineBody))
+
+	select {
+	case c := <-h.queue.changes:
+		if c.streamer != "GoProSlowYo" || !c.online {
+			t.Errorf("queued change = %+v", c)
+		}
+	default:
+		t.Fatal("no change queued")
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// adminHandler serves the admin endpoints, which need the admin token as a
+// bearer token.
+type adminHandler struct {
+	deadLetters *deadLetterLog
+	queue       *updateQueue
+	statuses    *statusStore
+	token       string
+	// reloader applies changed settings.
+	reloader *reloader
+	// webhook handles simulated events.
+	webhook *webhookHandler
+	// callbackURL is the webhook that added streamers are subscribed for.
+	callbackURL string
+}
+
+// reconcileResponse is the JSON body returned after reconciling index.md.
+type reconcileResponse struct {
+	Queued int `json:"queued"`
+}
+
+// streamerResponse is the JSON body returned after adding or removing a
+// streamer. Changed is false if index.md already matched.
+type streamerResponse struct {
+	UserID   string `json:"user_id"`
+	Login    string `json:"login"`
+	Streamer string `json:"streamer"`
+	Changed  bool   `json:"changed"`
+}
+
+// replayResponse is the JSON body returned after replaying dead letters.
+type replayResponse struct {
+	Replayed int `json:"replayed"`
+	Rejected int `json:"rejected"`
+}
+
+// authorize checks the request's bearer token, writing an error response and
+// returning false if it doesn't match.
+func (h *adminHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	got := []byte(r.Header.Get("Authorization"))
+	want := []byte("Bearer " + h.token)
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		server.WriteError(w, http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+	return true
+}
+
+// authorizeBrowser is authorize for pages opened in a browser, which also
+// accepts the admin token as the password of basic auth and asks for it.
+func (h *adminHandler) authorizeBrowser(w http.ResponseWriter, r *http.Request) bool {
+	_, password, basic := r.BasicAuth()
+	if !basic && strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return h.authorize(w, r)
+	}
+	if basic && subtle.ConstantTimeCompare([]byte(password), []byte(h.token)) == 1 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="StreamStatus"`)
+	server.WriteError(w, http.StatusUnauthorized, "invalid admin token")
+	return false
+}
+
+// listDeadLetters returns the dead-lettered changes as JSON.
+func (h *adminHandler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	entries, err := h.deadLetters.list()
+	if err != nil {
+		log.Printf("error reading dead letters: %s\n", err)
+		server.WriteError(w, http.StatusInternalServerError, "error reading dead letters")
+		return
+	}
+	if entries == nil {
+		entries = []deadLetter{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// replayDeadLetters queues the dead-lettered changes for the event in the id
+// query parameter, or all of them without one, rebuilt from the notifications
+// they came from. Changes that can't be rebuilt or that the queue can't accept
+// are kept in the dead-letter log.
+func (h *adminHandler) replayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	entries, err := h.deadLetters.take(r.URL.Query().Get("id"))
+	if err != nil {
+		log.Printf("error reading dead letters: %s\n", err)
+		server.WriteError(w, http.StatusInternalServerError, "error reading dead letters")
+		return
+	}
+	var resp replayResponse
+	var rejected []statusChange
+	for _, e := range entries {
+		c, err := e.replayChange()
+		if err != nil {
+			log.WithField("event_id", c.id).Printf("error rebuilding dead-lettered change for %s: %s\n", c.streamer, err)
+			h.queue.deadLetter([]statusChange{c}, err, log.NewEntry(log.StandardLogger()))
+			resp.Rejected++
+			continue
+		}
+		log.WithField("event_id", c.id).Warnf("replaying dead-lettered change for %s", c.streamer)
+		if !h.queue.enqueue(c) {
+			rejected = append(rejected, c)
+			continue
+		}
+		resp.Replayed++
+	}
+	if len(rejected) > 0 {
+		resp.Rejected += len(rejected)
+		h.queue.deadLetter(rejected, fmt.Errorf("update queue unavailable"), log.NewEntry(log.StandardLogger()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// history returns the processed events as JSON, newest first. The streamer
+// query parameter limits them to one streamer, since to those processed from
+// an RFC 3339 time (by default a day ago), and limit to that many (by default
+// 100).
+func (h *adminHandler) history(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	since := time.Now().Add(-24 * time.Hour)
+	if v := query.Get("since"); v != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			server.WriteError(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+	}
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > 1000 {
+			server.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+	}
+	events, err := h.statuses.history(query.Get("streamer"), since, limit)
+	if err != nil {
+		log.Printf("error reading event history: %s\n", err)
+		server.WriteError(w, http.StatusInternalServerError, "error reading event history")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// streamers adds the streamer with the login query parameter on POST,
+// subscribing to their stream events and committing a row for them, or on
+// DELETE deletes their subscriptions and rows, moving their row to the
+// inactive page instead when archive is true. It waits for the commit.
+func (h *adminHandler) streamers(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	login := query.Get("login")
+	if login == "" {
+		server.WriteError(w, http.StatusBadRequest, "login is required")
+		return
+	}
+	archive := false
+	if v := query.Get("archive"); v != "" {
+		var err error
+		archive, err = strconv.ParseBool(v)
+		if err != nil {
+			server.WriteError(w, http.StatusBadRequest, "archive must be true or false")
+			return
+		}
+	}
+	if r.Method == http.MethodPost && h.callbackURL == "" {
+		server.WriteError(w, http.StatusNotImplemented, "adding streamers needs SS_CALLBACK_URL")
+		return
+	}
+	logger := log.WithField("event_id", "admin-streamers")
+	users, err := h.queue.twitch.getUsersByLogin([]string{login}, logger)
+	if err != nil {
+		logger.Printf("error looking up %s: %s\n", login, err)
+		server.WriteError(w, http.StatusBadGateway, "error looking up streamer")
+		return
+	}
+	if len(users) == 0 {
+		server.WriteError(w, http.StatusNotFound, "no such streamer")
+		return
+	}
+	user := users[0]
+	err = h.queue.runTask(r.Context(), func() error {
+		if r.Method == http.MethodPost {
+			return h.queue.addStreamer(user, h.callbackURL, h.webhook.secret)
+		}
+		return h.queue.removeStreamer(user, archive)
+	})
+	noChange := errors.Is(err, ErrNoChangeNeeded)
+	if err != nil && !noChange {
+		logger.Printf("error updating %s: %s\n", user.Login, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNotLeading) || errors.Is(err, errQueueClosed) {
+			status = http.StatusServiceUnavailable
+		}
+		server.WriteError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(streamerResponse{
+		UserID:   user.ID,
+		Login:    user.Login,
+		Streamer: user.DisplayName,
+		Changed:  !noChange,
+	})
+}
+
+// reconcile looks up who is live on Twitch and queues changes for the rows of
+// index.md that disagree, returning how many were queued once it's done.
+func (h *adminHandler) reconcile(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var resp reconcileResponse
+	err := h.queue.runTask(r.Context(), func() error {
+		h.queue.repo.logger = log.WithField("event_id", "admin-reconcile")
+		var err error
+		resp.Queued, err = h.queue.reconcile()
+		return err
+	})
+	if err != nil {
+		log.Printf("error reconciling: %s\n", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNotLeading) || errors.Is(err, errQueueClosed) {
+			status = http.StatusServiceUnavailable
+		}
+		server.WriteError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
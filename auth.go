@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	httpauth "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// isSSHURL reports whether url is an ssh:// or scp-like git@host:path remote.
+func isSSHURL(url string) bool {
+	endpoint, err := transport.NewEndpoint(url)
+	return err == nil && endpoint.Protocol == "ssh"
+}
+
+// repoDirectory returns the local directory name for the remote url, which is
+// the last path element without any .git suffix.
+func repoDirectory(url string) string {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(path.Base(endpoint.Path), ".git")
+}
+
+// newGitAuth returns the auth method for the configured remote: an SSH key for
+// SSH remotes, a GitHub App installation token when an app is configured,
+// otherwise HTTP basic auth with a personal access token.
+func newGitAuth(cfg *config) (transport.AuthMethod, error) {
+	if !isSSHURL(cfg.RepoURL) && cfg.GitHubAppID != "" {
+		return newGitHubAppAuth(cfg)
+	}
+	if !isSSHURL(cfg.RepoURL) {
+		return &httpauth.BasicAuth{
+			Username: cfg.Username,
+			Password: cfg.Token,
+		}, nil
+	}
+
+	var keys *ssh.PublicKeys
+	var err error
+	if cfg.SSHKey != "" {
+		keys, err = ssh.NewPublicKeys("git", []byte(cfg.SSHKey), cfg.SSHKeyPassphrase)
+	} else {
+		keys, err = ssh.NewPublicKeysFromFile("git", cfg.SSHKeyPath, cfg.SSHKeyPassphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Without an explicit file the default ~/.ssh/known_hosts is used.
+	if cfg.SSHKnownHosts != "" {
+		keys.HostKeyCallback, err = ssh.NewKnownHostsCallback(cfg.SSHKnownHosts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
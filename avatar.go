@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// avatarIndexFile, in the avatar directory, records the profile image URL each
+// cached avatar was downloaded from.
+const avatarIndexFile = "avatars.json"
+
+// avatarHeading is the heading of the index.md column avatars are rendered in.
+const avatarHeading = "Avatar"
+
+// maxAvatarBytes is the largest profile image downloaded.
+const maxAvatarBytes = 1 << 20
+
+// updateAvatars caches the profile images of the streamers whose rows changed
+// in the avatar directory, downloading them again when their URL changes, and
+// renders them in index.md's avatar column if it has one.
+func (q *updateQueue) updateAvatars(repo *StreamersRepo) error {
+	indexPath := path.Join(repo.avatarDir, avatarIndexFile)
+	urls := map[string]string{}
+	data, err := repo.readRepoFile(indexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &urls)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %s", indexPath, err)
+		}
+	}
+	downloaded := false
+	for _, n := range repo.applied {
+		user, err := q.twitch.getUser(n.UserID, repo.logger)
+		if err != nil {
+			return err
+		}
+		if user.ProfileImageURL == "" {
+			continue
+		}
+		login := strings.ToLower(user.Login)
+		file := path.Join(repo.avatarDir, login+path.Ext(user.ProfileImageURL))
+		if urls[login] != user.ProfileImageURL || !repo.hasRepoFile(file) {
+			image, err := downloadAvatar(user.ProfileImageURL)
+			if err != nil {
+				return err
+			}
+			err = repo.writeRepoFile(file, string(image))
+			if err != nil {
+				return err
+			}
+			repo.logger.Printf("cached the avatar of %s in %s\n", n.Streamer, file)
+			urls[login] = user.ProfileImageURL
+			downloaded = true
+		}
+		cell := fmt.Sprintf(`<img src="%s" alt="" width="28" height="28">`, file)
+		repo.indexMdText, _ = render.SetCell(repo.indexMdText, n.Login, avatarHeading, cell)
+	}
+	if downloaded {
+		data, err = json.MarshalIndent(urls, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = repo.writeRepoFile(indexPath, string(data)+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return repo.writefile(repo.indexMdText)
+}
+
+// downloadAvatar returns the profile image at url.
+func downloadAvatar(url string) ([]byte, error) {
+	resp, err := notifyClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode, host: resp.Request.URL.Host, status: resp.Status}
+	}
+	image, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAvatarBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(image) > maxAvatarBytes {
+		return nil, fmt.Errorf("avatar larger than %d bytes: %s", maxAvatarBytes, url)
+	}
+	return image, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultBlueskyServer is the PDS used when none is configured.
+	defaultBlueskyServer = "https://bsky.social"
+	// defaultBlueskyTemplate is the post text used when no template is configured.
+	defaultBlueskyTemplate = "{{.Streamer}} is live: {{.Title}} {{.URL}}"
+	// blueskyRefreshMargin refreshes the session this long before its access
+	// token expires.
+	blueskyRefreshMargin = 5 * time.Minute
+	// blueskyAccessLifetime is how long an access token is assumed to last
+	// when its expiry can't be read from it.
+	blueskyAccessLifetime = time.Hour
+)
+
+// blueskyNotifier posts go-live announcements with a link card to Bluesky.
+type blueskyNotifier struct {
+	server     string
+	identifier string
+	password   string
+	template   *template.Template
+
+	// mu guards session, which is reused until its access token is about to
+	// expire and then refreshed.
+	mu      sync.Mutex
+	session *blueskySession
+	expires time.Time
+}
+
+// newBlueskyNotifier returns a notifier for the configured Bluesky account,
+// or nil if none is configured.
+func newBlueskyNotifier(cfg *config) (*blueskyNotifier, error) {
+	if cfg.BlueskyIdentifier == "" || cfg.BlueskyPassword == "" {
+		return nil, nil
+	}
+	server := cfg.BlueskyServer
+	if server == "" {
+		server = defaultBlueskyServer
+	}
+	text := cfg.BlueskyTemplate
+	if text == "" {
+		text = defaultBlueskyTemplate
+	}
+	tmpl, err := template.New("bluesky").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing bluesky template: %s", err)
+	}
+	return &blueskyNotifier{
+		server:     strings.TrimRight(server, "/"),
+		identifier: cfg.BlueskyIdentifier,
+		password:   cfg.BlueskyPassword,
+		template:   tmpl,
+	}, nil
+}
+
+// blueskySession is the response to com.atproto.server.createSession and
+// com.atproto.server.refreshSession.
+type blueskySession struct {
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+	DID        string `json:"did"`
+}
+
+// blueskyPost is an app.bsky.feed.post record.
+type blueskyPost struct {
+	Type      string         `json:"$type"`
+	Text      string         `json:"text"`
+	CreatedAt string         `json:"createdAt"`
+	Facets    []blueskyFacet `json:"facets,omitempty"`
+	Embed     *blueskyEmbed  `json:"embed,omitempty"`
+}
+
+// blueskyFacet marks a byte range of the post text, here always a link.
+type blueskyFacet struct {
+	Index    blueskyByteSlice `json:"index"`
+	Features []blueskyFeature `json:"features"`
+}
+
+// blueskyByteSlice is a UTF-8 byte range within the post text.
+type blueskyByteSlice struct {
+	ByteStart int `json:"byteStart"`
+	ByteEnd   int `json:"byteEnd"`
+}
+
+// blueskyFeature is a rich text feature applied to a facet.
+type blueskyFeature struct {
+	Type string `json:"$type"`
+	URI  string `json:"uri"`
+}
+
+// blueskyEmbed is an app.bsky.embed.external link card.
+type blueskyEmbed struct {
+	Type     string          `json:"$type"`
+	External blueskyExternal `json:"external"`
+}
+
+// blueskyExternal describes the link card contents.
+type blueskyExternal struct {
+	URI         string      `json:"uri"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Thumb       interface{} `json:"thumb,omitempty"`
+}
+
+// blueskyBlob is the response to com.atproto.repo.uploadBlob.
+type blueskyBlob struct {
+	Blob interface{} `json:"blob"`
+}
+
+// notify posts the rendered template with a link card when the streamer goes live.
+func (b *blueskyNotifier) notify(n notification) error {
+	if !n.Online {
+		return nil
+	}
+	text, err := renderTemplate(b.template, n)
+	if err != nil {
+		return err
+	}
+
+	session, err := b.currentSession()
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+session.AccessJwt)
+
+	post := blueskyPost{
+		Type:      "app.bsky.feed.post",
+		Text:      text,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Embed: &blueskyEmbed{
+			Type: "app.bsky.embed.external",
+			External: blueskyExternal{
+				URI:         n.URL,
+				Title:       liveTitle(n),
+				Description: n.Title,
+			},
+		},
+	}
+	// Links in the text are only clickable when marked with a facet.
+	if start := strings.Index(text, n.URL); start >= 0 {
+		post.Facets = []blueskyFacet{{
+			Index:    blueskyByteSlice{ByteStart: start, ByteEnd: start + len(n.URL)},
+			Features: []blueskyFeature{{Type: "app.bsky.richtext.facet#link", URI: n.URL}},
+		}}
+	}
+	if n.ThumbnailURL != "" {
+		thumb, err := b.uploadThumbnail(n.ThumbnailURL, header)
+		if err == nil {
+			post.Embed.External.Thumb = thumb
+		}
+	}
+
+	err = postJSON(b.server+"/xrpc/com.atproto.repo.createRecord", map[string]interface{}{
+		"repo":       session.DID,
+		"collection": "app.bsky.feed.post",
+		"record":     post,
+	}, header)
+	if err != nil {
+		// A rejected token is dropped so the next post signs in again.
+		if hasStatus(err, http.StatusBadRequest) || hasStatus(err, http.StatusUnauthorized) {
+			b.forgetSession()
+		}
+		return fmt.Errorf("bluesky: error creating post: %s", err)
+	}
+	return nil
+}
+
+// liveTitle returns the link card title for the streamer going live, naming
+// the platform, or the host of the stream's URL when the platform is unknown.
+func liveTitle(n notification) string {
+	name := platformName(n.Platform)
+	if name == "" {
+		if u, err := url.Parse(n.URL); err == nil {
+			name = u.Host
+		}
+	}
+	if name == "" {
+		return n.Streamer + " is live"
+	}
+	return fmt.Sprintf("%s is live on %s", n.Streamer, name)
+}
+
+// currentSession returns the cached session, refreshing it when its access
+// token is about to expire, or creating one when there is none or it can't be
+// refreshed.
+func (b *blueskyNotifier) currentSession() (blueskySession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session != nil && time.Until(b.expires) > blueskyRefreshMargin {
+		return *b.session, nil
+	}
+	var session blueskySession
+	refreshed := false
+	if b.session != nil {
+		err := b.refreshSession(b.session.RefreshJwt, &session)
+		if err != nil {
+			log.Printf("bluesky: error refreshing session, signing in again: %s\n", err)
+		}
+		refreshed = err == nil
+	}
+	if !refreshed {
+		err := postJSONResponse(b.server+"/xrpc/com.atproto.server.createSession", map[string]string{
+			"identifier": b.identifier,
+			"password":   b.password,
+		}, nil, &session)
+		if err != nil {
+			return blueskySession{}, fmt.Errorf("bluesky: error creating session: %s", err)
+		}
+	}
+	b.session = &session
+	b.expires = jwtExpiry(session.AccessJwt)
+	return session, nil
+}
+
+// refreshSession exchanges the refresh token for a new session.
+func (b *blueskyNotifier) refreshSession(refreshJwt string, session *blueskySession) error {
+	req, err := http.NewRequest(http.MethodPost, b.server+"/xrpc/com.atproto.server.refreshSession", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+refreshJwt)
+	return doRequest(req, session)
+}
+
+// forgetSession drops the cached session.
+func (b *blueskyNotifier) forgetSession() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.session = nil
+}
+
+// jwtExpiry returns when the JWT expires, from its exp claim, or
+// blueskyAccessLifetime from now when it has none.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims struct {
+			Exp int64 `json:"exp"`
+		}
+		if err == nil && json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+			return time.Unix(claims.Exp, 0)
+		}
+	}
+	return time.Now().Add(blueskyAccessLifetime)
+}
+
+// uploadThumbnail fetches the stream thumbnail and uploads it as a blob for the link card.
+func (b *blueskyNotifier) uploadThumbnail(url string, header http.Header) (interface{}, error) {
+	resp, err := notifyClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching thumbnail: %s", resp.Status)
+	}
+	req, err := http.NewRequest(http.MethodPost, b.server+"/xrpc/com.atproto.repo.uploadBlob", resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", header.Get("Authorization"))
+	req.Header.Set("Content-Type", resp.Header.Get("Content-Type"))
+	var blob blueskyBlob
+	err = doRequest(req, &blob)
+	if err != nil {
+		return nil, err
+	}
+	return blob.Blob, nil
+}
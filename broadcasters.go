@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+)
+
+// broadcasterFilter decides which broadcasters' events are applied, so stray
+// subscriptions or test events can't change the page.
+type broadcasterFilter struct {
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+// newBroadcasterFilter returns a filter for the configured allowlist and
+// denylist, or nil when neither is set.
+func newBroadcasterFilter(cfg *config) *broadcasterFilter {
+	if len(cfg.AllowedBroadcasters) == 0 && len(cfg.DeniedBroadcasters) == 0 {
+		return nil
+	}
+	return &broadcasterFilter{
+		allowed: broadcasterSet(cfg.AllowedBroadcasters),
+		denied:  broadcasterSet(cfg.DeniedBroadcasters),
+	}
+}
+
+// broadcasterSet returns the lower case logins and user IDs in list.
+func broadcasterSet(list []string) map[string]bool {
+	set := map[string]bool{}
+	for _, b := range list {
+		set[strings.ToLower(b)] = true
+	}
+	return set
+}
+
+// allows reports whether events for the broadcaster are applied: it must not
+// be denied and, if there is an allowlist, must be on it, by login or user ID.
+func (f *broadcasterFilter) allows(login, userID string) bool {
+	login = strings.ToLower(login)
+	if f.denied[login] || f.denied[userID] {
+		return false
+	}
+	return len(f.allowed) == 0 || f.allowed[login] || f.allowed[userID]
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// calendarSegments is how many scheduled streams of each streamer are added
+// to the calendar.
+const calendarSegments = 10
+
+// icalTimeFormat is the UTC date-time format of iCalendar.
+const icalTimeFormat = "20060102T150405Z"
+
+// calendar is the iCalendar file of everyone's scheduled streams, committed to
+// the repository and served at /calendar.ics.
+type calendar struct {
+	mu   sync.RWMutex
+	path string
+	// text is the last calendar rendered, served until the next.
+	text string
+}
+
+// newCalendar returns the calendar written to the configured path, or nil when
+// no path is configured.
+func newCalendar(cfg *config) *calendar {
+	if cfg.CalendarFilePath == "" {
+		return nil
+	}
+	return &calendar{path: cfg.CalendarFilePath}
+}
+
+// calendarEvent is a scheduled stream in the calendar.
+type calendarEvent struct {
+	login    string
+	streamer string
+	segment  scheduleSegment
+}
+
+// renderCalendar renders events as an iCalendar file.
+func renderCalendar(events []calendarEvent) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		b.WriteString(foldICalLine(name + ":" + value))
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//infosecstreams//StreamStatus//EN")
+	line("X-WR-CALNAME", "Streams")
+	for _, e := range events {
+		s := e.segment
+		line("BEGIN", "VEVENT")
+		line("UID", s.ID+"@streamstatus")
+		// The start stands in for when the event was created so the file only
+		// changes with the schedule.
+		line("DTSTAMP", s.StartTime.UTC().Format(icalTimeFormat))
+		line("DTSTART", s.StartTime.UTC().Format(icalTimeFormat))
+		if !s.EndTime.IsZero() {
+			line("DTEND", s.EndTime.UTC().Format(icalTimeFormat))
+		}
+		summary := e.streamer
+		if s.Title != "" {
+			summary += ": " + s.Title
+		}
+		line("SUMMARY", escapeICalText(summary))
+		if s.Category != nil {
+			line("CATEGORIES", escapeICalText(s.Category.Name))
+		}
+		line("URL", "https://www.twitch.tv/"+e.login)
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// escapeICalText escapes s for an iCalendar text value.
+func escapeICalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldICalLine ends line with CRLF, folding it into lines of at most 75 bytes
+// without splitting UTF-8 characters.
+func foldICalLine(line string) string {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space.
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+	return b.String()
+}
+
+// isRuneStart reports whether c starts a UTF-8 encoded character.
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
+
+// updateCalendar renders the scheduled streams of everyone in index.md to the
+// calendar, then commits and pushes it.
+func (q *updateQueue) updateCalendar() error {
+	repo := q.repo
+	return q.commitTask("calendar", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		users, err := q.twitch.getUsersByLogin(rosterLogins(repo.indexMdText), repo.logger)
+		if err != nil {
+			return "", err
+		}
+		var events []calendarEvent
+		for _, u := range users {
+			segments, err := q.twitch.getSchedule(u.ID, calendarSegments, repo.logger)
+			if err != nil {
+				return "", err
+			}
+			for _, s := range segments {
+				events = append(events, calendarEvent{login: u.Login, streamer: u.DisplayName, segment: s})
+			}
+		}
+		// Order the events so the file only changes with the schedules.
+		sort.Slice(events, func(i, j int) bool {
+			if !events[i].segment.StartTime.Equal(events[j].segment.StartTime) {
+				return events[i].segment.StartTime.Before(events[j].segment.StartTime)
+			}
+			return events[i].login < events[j].login
+		})
+		text := renderCalendar(events)
+		q.calendar.mu.Lock()
+		q.calendar.text = text
+		q.calendar.mu.Unlock()
+		return "📅 Updated the calendar of scheduled streams", repo.writeRepoFile(q.calendar.path, text)
+	}, q.calendar.path)
+}
+
+// serve serves the last calendar rendered.
+func (c *calendar) serve(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	text := c.text
+	c.mu.RUnlock()
+	if text == "" {
+		server.WriteError(w, http.StatusServiceUnavailable, "calendar not rendered yet")
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	_, err := fmt.Fprint(w, text)
+	if err != nil {
+		log.Printf("error writing calendar: %s\n", err)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+)
+
+// usage describes the commands.
+const usage = `usage: StreamStatus [--option=value]... [command] [arguments]
+
+Every SS_ environment variable can be given as an option before the command,
+such as --port=3000 for SS_PORT, and is read from .env, or SS_ENV_FILE, too.
+--debug is short for --log-level=debug, logging webhook payloads with their
+secrets redacted.
+
+Commands, using the same settings as the server:
+  serve                     receive webhooks and update the site (default)
+  add <login>               subscribe to a streamer's events as below and add
+                            a row for them to index.md
+  remove [-archive] <login> delete a streamer's subscriptions and their rows,
+                            or move their row to SS_INACTIVE_FILE
+  subscribe <login>...      subscribe the webhook at SS_CALLBACK_URL to the
+                            streamers' stream.online, stream.offline,
+                            user.update and channel.update events
+  unsubscribe <login>...    delete the streamers' EventSub subscriptions
+  list                      list the app's EventSub subscriptions
+  prune-subs [-dry-run]     delete subscriptions that failed or are for
+                            streamers no longer in index.md or SS_INACTIVE_FILE
+  reconcile                 look up who is live on Twitch and update index.md
+                            where it disagrees
+  lint [-fix]               check index.md and SS_INACTIVE_FILE for malformed,
+                            duplicate and unsorted rows and odd statuses, and
+                            with -fix commit them in canonical form
+  render                    regenerate index.md and SS_INACTIVE_FILE in full
+                            from their rows, SS_ROSTER_FILE and the status
+                            store, laid out with the page templates
+  doctor                    check the settings work and how to fix those that
+                            don't
+  help                      show this message
+`
+
+// commands are run with the config and the arguments after their name.
+var commands = map[string]func(cfg *config, args []string) error{
+	"serve":       serve,
+	"add":         addCommand,
+	"remove":      removeCommand,
+	"subscribe":   subscribeCommand,
+	"unsubscribe": unsubscribeCommand,
+	"list":        listCommand,
+	"prune-subs":  pruneSubsCommand,
+	"reconcile":   reconcileCommand,
+	"lint":        lintCommand,
+	"render":      renderCommand,
+	"doctor":      doctorCommand,
+}
+
+// commandTwitch returns a Twitch client for commands that need one.
+func commandTwitch(cfg *config) (*twitchClient, error) {
+	retry, err := newRetryPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newTwitchClient(cfg, retry)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("no SS_TWITCH_CLIENT_ID and/or SS_TWITCH_CLIENT_SECRET specified in environment")
+	}
+	return client, nil
+}
+
+// commandUsers resolves the logins given to a command to their users,
+// failing if any don't exist.
+func commandUsers(client *twitchClient, logins []string, logger *log.Entry) ([]helix.User, error) {
+	if len(logins) == 0 {
+		return nil, fmt.Errorf("no streamers given")
+	}
+	users, err := client.getUsersByLogin(logins, logger)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, u := range users {
+		found[u.Login] = true
+	}
+	for _, login := range logins {
+		if !found[strings.ToLower(login)] {
+			return nil, fmt.Errorf("no Twitch user named %s", login)
+		}
+	}
+	return users, nil
+}
+
+// addCommand subscribes to the stream events of the streamer with the login
+// and commits a row for them to index.md.
+func addCommand(cfg *config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: StreamStatus add <login>")
+	}
+	if cfg.CallbackURL == "" {
+		return fmt.Errorf("no SS_CALLBACK_URL specified in environment to subscribe")
+	}
+	queue := newQueue(cfg)
+	defer queue.closeStores()
+	if queue.twitch == nil {
+		return fmt.Errorf("no SS_TWITCH_CLIENT_ID and/or SS_TWITCH_CLIENT_SECRET specified in environment")
+	}
+	users, err := commandUsers(queue.twitch, args, queue.repo.logger)
+	if err != nil {
+		return err
+	}
+	err = queue.addStreamer(users[0], cfg.CallbackURL, cfg.SecretKey)
+	if errors.Is(err, ErrNoChangeNeeded) {
+		fmt.Printf("subscribed to %s, who already has a row\n", users[0].Login)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("added %s\n", users[0].Login)
+	return nil
+}
+
+// removeCommand deletes the EventSub subscriptions of the streamer with the
+// login and commits the removal or archiving of their rows.
+func removeCommand(cfg *config, args []string) error {
+	flags := flag.NewFlagSet("remove", flag.ContinueOnError)
+	archive := flags.Bool("archive", false, "move the row to the inactive page instead of deleting it")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: StreamStatus remove [-archive] <login>")
+	}
+	queue := newQueue(cfg)
+	defer queue.closeStores()
+	if queue.twitch == nil {
+		return fmt.Errorf("no SS_TWITCH_CLIENT_ID and/or SS_TWITCH_CLIENT_SECRET specified in environment")
+	}
+	users, err := commandUsers(queue.twitch, flags.Args(), queue.repo.logger)
+	if err != nil {
+		return err
+	}
+	err = queue.removeStreamer(users[0], *archive)
+	if errors.Is(err, ErrNoChangeNeeded) {
+		fmt.Printf("unsubscribed from %s, who has no row\n", users[0].Login)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %s\n", users[0].Login)
+	return nil
+}
+
+// subscribeCommand subscribes the webhook to the stream events of the
+// streamers with the logins.
+func subscribeCommand(cfg *config, args []string) error {
+	if cfg.CallbackURL == "" {
+		return fmt.Errorf("no SS_CALLBACK_URL specified in environment to subscribe")
+	}
+	client, err := commandTwitch(cfg)
+	if err != nil {
+		return err
+	}
+	logger := log.WithField("event_id", "subscribe")
+	users, err := commandUsers(client, args, logger)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		err = client.subscribe(u.ID, cfg.CallbackURL, cfg.SecretKey, logger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("subscribed to %s\n", u.Login)
+	}
+	return nil
+}
+
+// unsubscribeCommand deletes the EventSub subscriptions of the streamers with
+// the logins.
+func unsubscribeCommand(cfg *config, args []string) error {
+	client, err := commandTwitch(cfg)
+	if err != nil {
+		return err
+	}
+	logger := log.WithField("event_id", "unsubscribe")
+	users, err := commandUsers(client, args, logger)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		removed, err := client.unsubscribe(u.ID, logger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("removed %d subscriptions for %s\n", removed, u.Login)
+	}
+	return nil
+}
+
+// listCommand prints the app's EventSub subscriptions.
+func listCommand(cfg *config, args []string) error {
+	client, err := commandTwitch(cfg)
+	if err != nil {
+		return err
+	}
+	subscriptions, totalCost, maxCost, err := client.subscriptions(log.WithField("event_id", "list"))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tBROADCASTER\tCALLBACK")
+	for _, s := range subscriptions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.ID, s.Type, s.Status, twitch.SubscriptionUserID(s), s.Transport.Callback)
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d subscriptions, costing %d of %d\n", len(subscriptions), totalCost, maxCost)
+	return nil
+}
+
+// pruneSubsCommand deletes the subscriptions that failed or are for streamers
+// no longer listed, to keep the app under its cost limit.
+func pruneSubsCommand(cfg *config, args []string) error {
+	flags := flag.NewFlagSet("prune-subs", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the subscriptions that would be deleted without deleting them")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	queue := newQueue(cfg)
+	defer queue.closeStores()
+	queue.repo.logger = log.WithField("event_id", "prune-subs")
+	stale, err := queue.staleSubscriptions(*dryRun)
+	for _, s := range stale {
+		fmt.Printf("%s\t%s\t%s\t%s\n", s.ID, s.Type, s.Status, twitch.SubscriptionUserID(s))
+	}
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("would delete %d subscriptions\n", len(stale))
+	} else {
+		fmt.Printf("deleted %d subscriptions\n", len(stale))
+	}
+	return nil
+}
+
+// reconcileCommand updates index.md for the streamers whose rows disagree
+// with whether they're live on Twitch, and waits for the changes to be pushed.
+func reconcileCommand(cfg *config, args []string) error {
+	queue := newQueue(cfg)
+	defer queue.closeStores()
+	go queue.run()
+	queued, err := queue.reconcile()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = queue.shutdown(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("queued %d changes\n", queued)
+	return nil
+}
+
+// lintCommand prints the problems in the pages, after committing them in
+// canonical form with -fix, and fails if there are any left.
+func lintCommand(cfg *config, args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "commit the pages rewritten in canonical form first")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	queue := newQueue(cfg)
+	defer queue.closeStores()
+	queue.repo.logger = log.WithField("event_id", "lint")
+	if *fix {
+		err = queue.formatPages()
+		if err != nil && !errors.Is(err, ErrNoChangeNeeded) {
+			return err
+		}
+		if err == nil {
+			fmt.Println("committed the formatted pages")
+		}
+	}
+	pages, err := queue.lintPages()
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, page := range pages {
+		for _, p := range page.problems {
+			fmt.Printf("%s:%d: %s\n", page.path, p.Line, p.Message)
+			count++
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("%d problems found", count)
+	}
+	fmt.Println("no problems found")
+	return nil
+}
+
+// renderCommand commits index.md and the inactive page regenerated in full,
+// such as after changing the page templates or to recover a mangled page.
+func renderCommand(cfg *config, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: StreamStatus render")
+	}
+	queue := newQueue(cfg)
+	defer queue.closeStores()
+	queue.repo.logger = log.WithField("event_id", "render")
+	pages := queue.repo.pages
+	if pages == nil {
+		var err error
+		pages, err = render.LoadTemplates(cfg.PageTemplateDir)
+		if err != nil {
+			return err
+		}
+	}
+	r, err := loadRoster(cfg)
+	if err != nil {
+		return err
+	}
+	err = queue.regeneratePages(pages, r)
+	if errors.Is(err, ErrNoChangeNeeded) {
+		fmt.Println("the pages are already up to date")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("committed the regenerated pages")
+	return nil
+}
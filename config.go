@@ -0,0 +1,930 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// The image has no zoneinfo for SS_LAST_UPDATED_TIMEZONE to load.
+	_ "time/tzdata"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultRepoURL is the site repository updated when SS_GH_REPO is unset.
+	defaultRepoURL = "https://github.com/infosecstreams/infosecstreams.github.io"
+	// defaultWebhookPath is where EventSub webhook requests are received.
+	defaultWebhookPath = "/webhook/callbacks"
+
+	// Default author and messages for the automated commits. The provider's
+	// CI skip marker is appended to the messages.
+	defaultCommitAuthorName      = "🤖 STATUSS (Seriously Totally Automated Twitch Updating StreamStatus)"
+	defaultCommitAuthorEmail     = "goproslowyo+statuss@users.noreply.github.com"
+	defaultCommitOnlineTemplate  = "🟢 {{.Streamer}} has gone online!"
+	defaultCommitOfflineTemplate = "☠️  {{.Streamer}} has gone offline!"
+	// defaultNewRowTemplate renders the columns after the status of a row
+	// added for a streamer missing from index.md.
+	defaultNewRowTemplate = "`{{.Login}}` | [<i class=\"fab fa-twitch twitch\"></i>](https://www.twitch.tv/{{.Login}})"
+	// defaultLastUpdatedTemplate renders the last updated line of index.md.
+	defaultLastUpdatedTemplate = "Last updated: {{.Time.Format \"2006-01-02 15:04 MST\"}}"
+)
+
+// config holds the settings read from the optional JSON config file named by
+// SS_CONFIG. Environment variables take precedence over the file.
+type config struct {
+	// LogFile is a file to write the logs to as well as stderr, renamed with
+	// the time and started again once it reaches LogFileMaxSize megabytes or
+	// LogFileMaxAge passes. Renamed files are deleted after LogFileMaxAge.
+	// Unset disables it.
+	LogFile        string `json:"log_file"`
+	LogFileMaxAge  string `json:"log_file_max_age"`
+	LogFileMaxSize int64  `json:"log_file_max_size"`
+	LogFormat      string `json:"log_format"`
+	// LogLevel is the least severe level logged: debug also logs the
+	// verified webhook payloads, with secrets redacted.
+	LogLevel     string `json:"log_level"`
+	MaxBodyBytes int64  `json:"max_body_bytes"`
+	Port         string `json:"port"`
+	RepoURL      string `json:"repo_url"`
+	SecretKey    string `json:"secret_key"`
+	Token        string `json:"token"`
+	Username     string `json:"username"`
+	WebhookPath  string `json:"webhook_path"`
+	// WebhookRateLimit and WebhookIPRateLimit are the webhook requests a
+	// second accepted from all clients and from each client IP, with bursts
+	// of up to their Burst settings, by default the limit. 0 is unlimited.
+	WebhookRateLimit   int64 `json:"webhook_rate_limit"`
+	WebhookRateBurst   int64 `json:"webhook_rate_burst"`
+	WebhookIPRateLimit int64 `json:"webhook_ip_rate_limit"`
+	WebhookIPRateBurst int64 `json:"webhook_ip_rate_burst"`
+	// TrustedProxies are the CIDRs or addresses of reverse proxies whose
+	// X-Forwarded-For header gives the client IP for logs and rate limits.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// SecondarySecretKey is also accepted on EventSub messages while the
+	// subscriptions are recreated with a new secret.
+	SecondarySecretKey string `json:"secondary_secret_key"`
+
+	// AllowedBroadcasters, when set, are the only broadcasters whose events
+	// are applied, and DeniedBroadcasters are never applied, by login or
+	// user ID.
+	AllowedBroadcasters []string `json:"allowed_broadcasters"`
+	DeniedBroadcasters  []string `json:"denied_broadcasters"`
+	// LiveOnly ignores stream.online events for reruns and premieres.
+	LiveOnly bool `json:"live_only"`
+	// VerifyStatus checks Twitch changes against Helix Get Streams before
+	// applying them, skipping stale or out of order events once rechecks
+	// still disagree.
+	VerifyStatus bool `json:"verify_status"`
+
+	// Provider is the host of the repository: github, gitlab or gitea,
+	// which covers Forgejo and Codeberg too.
+	Provider string `json:"provider"`
+	// GiteaAPIURL is the Gitea API used for pull requests, by default
+	// /api/v1 on the repository's host.
+	GiteaAPIURL string `json:"gitea_api_url"`
+
+	// SSH key used instead of Username/Token when RepoURL is an SSH remote,
+	// either as a path or inline PEM.
+	SSHKeyPath       string `json:"ssh_key_path"`
+	SSHKey           string `json:"ssh_key"`
+	SSHKeyPassphrase string `json:"ssh_key_passphrase"`
+	SSHKnownHosts    string `json:"ssh_known_hosts"`
+
+	// GitHub App used instead of Username/Token for HTTPS remotes, with the
+	// private key as a path or inline PEM.
+	GitHubAPIURL            string `json:"github_api_url"`
+	GitHubAppID             string `json:"github_app_id"`
+	GitHubAppInstallationID string `json:"github_app_installation_id"`
+	GitHubAppPrivateKeyPath string `json:"github_app_private_key_path"`
+	GitHubAppPrivateKey     string `json:"github_app_private_key"`
+
+	// SigningFormat is gpg or ssh to sign commits with the key given as a
+	// path or inline armored/PEM contents.
+	SigningFormat        string `json:"signing_format"`
+	SigningKeyPath       string `json:"signing_key_path"`
+	SigningKey           string `json:"signing_key"`
+	SigningKeyPassphrase string `json:"signing_key_passphrase"`
+
+	// Commit author and message templates. The templates are text/templates
+	// executed with the same fields as the notification templates.
+	CommitAuthorName      string `json:"commit_author_name"`
+	CommitAuthorEmail     string `json:"commit_author_email"`
+	CommitOnlineTemplate  string `json:"commit_online_template"`
+	CommitOfflineTemplate string `json:"commit_offline_template"`
+	// AutoAddRows adds a row to index.md for streamers missing from it,
+	// placed alphabetically, instead of leaving the event unapplied. The
+	// columns after the status are rendered from NewRowTemplate.
+	AutoAddRows    bool   `json:"auto_add_rows"`
+	NewRowTemplate string `json:"new_row_template"`
+	// PageTemplates lays out the whole of index.md and the inactive page
+	// from their rows with the built-in templates after each change, or with
+	// index.md.tmpl and inactive.md.tmpl from PageTemplateDir if it has them.
+	PageTemplates   bool   `json:"page_templates"`
+	PageTemplateDir string `json:"page_template_dir"`
+	// StatusStyle is how statuses are written in rows: emoji for the green
+	// dot alone, text to add LIVE and offline for screen readers, or aria
+	// for HTML labelling the dot. Existing rows keep theirs until they
+	// change or are formatted with the lint command.
+	StatusStyle string `json:"status_style"`
+	// LastUpdated keeps a line at the bottom of index.md with the time it was
+	// last updated, rendered from LastUpdatedTemplate with .Time in the
+	// LastUpdatedTimezone, such as UTC or America/New_York.
+	LastUpdated         bool   `json:"last_updated"`
+	LastUpdatedTemplate string `json:"last_updated_template"`
+	LastUpdatedTimezone string `json:"last_updated_timezone"`
+
+	// Backend is git to update a clone of the repository, or github_api to
+	// update index.md with the GitHub Contents API without cloning.
+	Backend string `json:"backend"`
+	// Branch is the branch to update, created from the default branch if it
+	// doesn't exist. The default branch is used when it is empty.
+	Branch string `json:"branch"`
+	// CloneStorage is disk to clone the repository into the working
+	// directory, or memory to keep the clone in memory.
+	CloneStorage string `json:"clone_storage"`
+	// CloneDepth limits the clone to this many commits, 0 for the full
+	// history, and CloneSingleBranch only fetches the default branch. A
+	// shallow clone is fetched into at the same depth, and cloned again when
+	// go-git can't update it.
+	CloneDepth        int64 `json:"clone_depth"`
+	CloneSingleBranch bool  `json:"clone_single_branch"`
+
+	// PushMode is direct to push to the default branch, or pull_request to
+	// push to PullRequestBranch and open a pull request for it.
+	PushMode          string `json:"push_mode"`
+	PullRequestBranch string `json:"pull_request_branch"`
+	// PushFailureAlert alerts through the notifiers that can, and fails
+	// /readyz, once this many pushes in a row have failed, until one
+	// succeeds. 0 disables it.
+	PushFailureAlert int64 `json:"push_failure_alert"`
+	// NotFoundIssues opens a GitHub issue for each streamer whose status
+	// changed but who has no row in index.md.
+	NotFoundIssues bool `json:"not_found_issues"`
+
+	// BatchWindow is how long to wait after a status change for others to
+	// commit and push along with it, as a Go duration. 0s disables batching.
+	BatchWindow string `json:"batch_window"`
+
+	// RetryQueuePath is a bbolt database storing changes that couldn't be
+	// pushed, which are retried every RetryQueueInterval until they are
+	// older than RetryQueueExpiry. Unset disables the retry queue.
+	RetryQueuePath     string `json:"retry_queue_path"`
+	RetryQueueInterval string `json:"retry_queue_interval"`
+	RetryQueueExpiry   string `json:"retry_queue_expiry"`
+	// RedisURL shares the queue of status changes between instances through
+	// Redis, with a lock held for RedisLockTTL at a time so only one
+	// instance updates the repository. Keys start with RedisPrefix.
+	RedisURL     string `json:"redis_url"`
+	RedisPrefix  string `json:"redis_prefix"`
+	RedisLockTTL string `json:"redis_lock_ttl"`
+	// LeaseName replaces the Redis lock with a Kubernetes Lease of that name,
+	// held for LeaseDuration, so only the leader among the replicas takes
+	// changes from Redis. LeaseNamespace defaults to the pod's namespace.
+	LeaseName      string `json:"lease_name"`
+	LeaseNamespace string `json:"lease_namespace"`
+	LeaseDuration  string `json:"lease_duration"`
+
+	// StatusDBPath is a SQLite database recording the last status, change
+	// time and event ID of each streamer, and the outcome of every processed
+	// event. Unset disables it.
+	StatusDBPath string `json:"status_db_path"`
+	// StatsFilePath is a page in the repository, such as stats.md, rewritten
+	// with the hours each streamer streamed from the event history whenever
+	// index.md is updated. Unset disables it.
+	StatsFilePath string `json:"stats_file_path"`
+	// DataFilePath is a file in the repository, such as _data/streamers.yml
+	// for Jekyll or data/streamers.json for Hugo, rewritten with the
+	// streamers on index.md and the inactive page whenever they change, so
+	// the site's templates can lay them out. It's YAML unless it ends in
+	// .json. Unset disables it.
+	DataFilePath string `json:"data_file_path"`
+	// SummaryFilePath is a page in the repository, such as summary.md,
+	// rewritten and committed each SummaryDay with a summary of the week
+	// before from the event history. Unset disables it.
+	SummaryFilePath string `json:"summary_file_path"`
+	SummaryDay      string `json:"summary_day"`
+	// InactiveFilePath is a page in the repository, such as inactive.md,
+	// that the rows of streamers offline for longer than InactiveAfter are
+	// moved to from index.md, and back from when they go live. Unset
+	// disables it.
+	InactiveFilePath string `json:"inactive_file_path"`
+	InactiveAfter    string `json:"inactive_after"`
+	// AvatarDir is a directory in the repository, such as assets/avatars,
+	// that the profile images of streamers are cached in when their status
+	// changes, and rendered from in index.md's Avatar column if it has one.
+	// Unset disables it.
+	AvatarDir string `json:"avatar_dir"`
+
+	// DeadLetterPath is a file recording changes that failed permanently or
+	// ran out of retries as JSON lines. Unset disables it.
+	DeadLetterPath string `json:"dead_letter_path"`
+	// AdminToken enables the /admin endpoints for requests bearing it.
+	AdminToken string `json:"admin_token"`
+	// GRPCPort serves the gRPC API on this port too, for calls bearing
+	// AdminToken. Unset disables it.
+	GRPCPort string `json:"grpc_port"`
+	// DebugSimulate enables /debug/simulate, which feeds signed fake events
+	// through the webhook handler, for local development.
+	DebugSimulate bool `json:"debug_simulate"`
+
+	// Retry policy for clone, pull, push and Helix requests. The delays are
+	// Go durations such as 500ms or 30s; each retry doubles the base delay up
+	// to the max and adds a random delay of up to the jitter.
+	RetryMaxAttempts int64  `json:"retry_max_attempts"`
+	RetryBaseDelay   string `json:"retry_base_delay"`
+	RetryMaxDelay    string `json:"retry_max_delay"`
+	RetryJitter      string `json:"retry_jitter"`
+	// GitCloneTimeout and GitTimeout are how long a clone, and a fetch, push
+	// or listing of the remote, may take before it's abandoned, as Go
+	// durations. 0s waits forever.
+	GitCloneTimeout string `json:"git_clone_timeout"`
+	GitTimeout      string `json:"git_timeout"`
+
+	// TLSDomains enables TLS with Let's Encrypt certificates for these
+	// domains when set.
+	TLSDomains  []string `json:"tls_domains"`
+	TLSCacheDir string   `json:"tls_cache_dir"`
+	TLSEmail    string   `json:"tls_email"`
+	// TLSHTTPPort serves ACME http-01 challenges and redirects to HTTPS.
+	TLSHTTPPort string `json:"tls_http_port"`
+
+	// SentryDSN enables error reporting to Sentry when set.
+	SentryDSN         string `json:"sentry_dsn"`
+	SentryEnvironment string `json:"sentry_environment"`
+
+	// TwitchTeam is a Twitch team whose members are added to index.md every
+	// TwitchTeamInterval, subscribing to their stream events for the webhook
+	// at CallbackURL if it is set. Unset disables it. The subscribe command
+	// subscribes CallbackURL too.
+	TwitchTeam         string `json:"twitch_team"`
+	TwitchTeamInterval string `json:"twitch_team_interval"`
+	CallbackURL        string `json:"callback_url"`
+	// SubscriptionCheckInterval is how often the cost of the app's EventSub
+	// subscriptions is checked, warning once it reaches
+	// SubscriptionCostWarning percent of Twitch's limit, 80 when unset, or
+	// never when 0.
+	SubscriptionCheckInterval string `json:"subscription_check_interval"`
+	SubscriptionCostWarning   *int64 `json:"subscription_cost_warning"`
+	// ScheduleInterval is how often each streamer's next scheduled stream is
+	// rendered in index.md's Next stream column, and also when their channel
+	// is updated. Unset disables it.
+	ScheduleInterval string `json:"schedule_interval"`
+	// CalendarFilePath is an iCalendar file in the repository, such as
+	// streams.ics, rewritten every ScheduleInterval with everyone's scheduled
+	// streams and served at /calendar.ics. Unset disables it.
+	CalendarFilePath string `json:"calendar_file_path"`
+	// LastLiveInterval is how often index.md's Last live column is
+	// rendered afresh with how long ago each streamer was live, such as "3
+	// hours ago", besides when statuses change. Longer intervals mean fewer
+	// commits but staler values. Unset disables it.
+	LastLiveInterval string `json:"last_live_interval"`
+
+	// RosterPath is a JSON file mapping streamers' Twitch logins to what is
+	// known about them, such as their channels on other platforms, which are
+	// polled for live streams every PollInterval.
+	RosterPath   string `json:"roster_path"`
+	PollInterval string `json:"poll_interval"`
+	// YouTubeAPIKey polls the YouTube Data API for the streamers' YouTube
+	// channels.
+	YouTubeAPIKey string `json:"youtube_api_key"`
+	// Kick app credentials used to poll the streamers' Kick channels.
+	KickClientID     string `json:"kick_client_id"`
+	KickClientSecret string `json:"kick_client_secret"`
+	// TrovoClientID polls the Trovo API for the streamers' Trovo channels.
+	TrovoClientID string `json:"trovo_client_id"`
+	// URLSources poll a URL for each of the streamers' channels on other
+	// platforms, such as self-hosted Owncast servers. Only set in the file.
+	URLSources []urlSourceConfig `json:"url_sources"`
+
+	// Twitch app credentials used to look up stream details and canonical
+	// names via Helix.
+	TwitchClientID     string `json:"twitch_client_id"`
+	TwitchClientSecret string `json:"twitch_client_secret"`
+
+	// DiscordWebhooks receive an embed when a streamer goes live.
+	DiscordWebhooks []string `json:"discord_webhooks"`
+	// SlackWebhooks receive go-live and offline messages for every streamer.
+	SlackWebhooks []string `json:"slack_webhooks"`
+	// Mastodon account that toots when a streamer goes live. The template
+	// is a text/template executed with the notification fields.
+	MastodonServer   string `json:"mastodon_server"`
+	MastodonToken    string `json:"mastodon_token"`
+	MastodonTemplate string `json:"mastodon_template"`
+	// Bluesky account that posts when a streamer goes live, authenticated
+	// with an app password.
+	BlueskyServer     string `json:"bluesky_server"`
+	BlueskyIdentifier string `json:"bluesky_identifier"`
+	BlueskyPassword   string `json:"bluesky_password"`
+	BlueskyTemplate   string `json:"bluesky_template"`
+	// Telegram bot that messages the chats when a streamer goes live.
+	TelegramToken    string   `json:"telegram_token"`
+	TelegramChats    []string `json:"telegram_chats"`
+	TelegramTemplate string   `json:"telegram_template"`
+	// OutboundWebhooks receive a JSON payload for every status change,
+	// signed with OutboundWebhookSecret when it is set.
+	OutboundWebhooks      []string `json:"outbound_webhooks"`
+	OutboundWebhookSecret string   `json:"outbound_webhook_secret"`
+	// MQTT broker that receives a retained message per streamer on
+	// <MQTTTopicPrefix>/<login>.
+	MQTTBroker      string `json:"mqtt_broker"`
+	MQTTClientID    string `json:"mqtt_client_id"`
+	MQTTUsername    string `json:"mqtt_username"`
+	MQTTPassword    string `json:"mqtt_password"`
+	MQTTTopicPrefix string `json:"mqtt_topic_prefix"`
+	// Matrix account, by access token, that messages the rooms on status changes.
+	MatrixHomeserver string   `json:"matrix_homeserver"`
+	MatrixToken      string   `json:"matrix_token"`
+	MatrixRooms      []string `json:"matrix_rooms"`
+
+	// Streamers holds per-streamer settings keyed by Twitch login.
+	Streamers map[string]streamerConfig `json:"streamers"`
+}
+
+// streamerConfig holds settings that apply to a single streamer.
+type streamerConfig struct {
+	SlackWebhooks []string `json:"slack_webhooks"`
+	// Telegram can be set to false to skip Telegram announcements.
+	Telegram *bool `json:"telegram"`
+}
+
+// urlSourceConfig describes a platform polled by requesting a URL for each
+// channel and reading whether it's live from the JSON response.
+type urlSourceConfig struct {
+	// Platform is the name the channels are listed under in the roster.
+	Platform string `json:"platform"`
+	// URL is requested with {channel} replaced by the channel.
+	URL string `json:"url"`
+	// LiveField is the dot separated path to the field in the response
+	// saying whether the channel is live.
+	LiveField string `json:"live_field"`
+	// LiveValue is what the field holds when live. Unset means true.
+	LiveValue string `json:"live_value"`
+}
+
+// loadConfig reads the config file, if any, then applies environment overrides,
+// including secrets from files and Vault, and defaults and returns the config
+// or an error.
+func loadConfig() (*config, error) {
+	// Shallow, single branch clones are the default. Set before reading the
+	// file so it can turn them off.
+	cfg := &config{
+		CloneDepth:        1,
+		CloneSingleBranch: true,
+	}
+	err := loadSecrets()
+	if err != nil {
+		return nil, err
+	}
+	if path := os.Getenv("SS_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %s", path, err)
+		}
+	}
+
+	envString(&cfg.RepoURL, "SS_GH_REPO")
+	envString(&cfg.Provider, "SS_PROVIDER")
+	envString(&cfg.GiteaAPIURL, "SS_GITEA_API_URL")
+	envString(&cfg.Username, "SS_USERNAME")
+	envString(&cfg.Token, "SS_TOKEN")
+	envString(&cfg.SecretKey, "SS_SECRETKEY")
+	envString(&cfg.SecondarySecretKey, "SS_SECRETKEY_SECONDARY")
+	envString(&cfg.WebhookPath, "SS_WEBHOOK_PATH")
+	envList(&cfg.AllowedBroadcasters, "SS_ALLOWED_BROADCASTERS")
+	envList(&cfg.DeniedBroadcasters, "SS_DENIED_BROADCASTERS")
+	envString(&cfg.SSHKeyPath, "SS_SSH_KEY_PATH")
+	envString(&cfg.SSHKey, "SS_SSH_KEY")
+	envString(&cfg.SSHKeyPassphrase, "SS_SSH_KEY_PASSPHRASE")
+	envString(&cfg.SSHKnownHosts, "SS_SSH_KNOWN_HOSTS")
+	envString(&cfg.GitHubAPIURL, "SS_GH_API_URL")
+	envString(&cfg.GitHubAppID, "SS_GH_APP_ID")
+	envString(&cfg.GitHubAppInstallationID, "SS_GH_APP_INSTALLATION_ID")
+	envString(&cfg.GitHubAppPrivateKeyPath, "SS_GH_APP_PRIVATE_KEY_PATH")
+	envString(&cfg.GitHubAppPrivateKey, "SS_GH_APP_PRIVATE_KEY")
+	envString(&cfg.SigningFormat, "SS_SIGNING_FORMAT")
+	envString(&cfg.SigningKeyPath, "SS_SIGNING_KEY_PATH")
+	envString(&cfg.SigningKey, "SS_SIGNING_KEY")
+	envString(&cfg.SigningKeyPassphrase, "SS_SIGNING_KEY_PASSPHRASE")
+	envString(&cfg.CommitAuthorName, "SS_COMMIT_AUTHOR_NAME")
+	envString(&cfg.CommitAuthorEmail, "SS_COMMIT_AUTHOR_EMAIL")
+	envString(&cfg.CommitOnlineTemplate, "SS_COMMIT_ONLINE_TEMPLATE")
+	envString(&cfg.CommitOfflineTemplate, "SS_COMMIT_OFFLINE_TEMPLATE")
+	envString(&cfg.NewRowTemplate, "SS_NEW_ROW_TEMPLATE")
+	envString(&cfg.Backend, "SS_BACKEND")
+	envString(&cfg.Branch, "SS_BRANCH")
+	envString(&cfg.CloneStorage, "SS_CLONE_STORAGE")
+	envString(&cfg.PushMode, "SS_PUSH_MODE")
+	envString(&cfg.PullRequestBranch, "SS_PR_BRANCH")
+	err = envInt64(&cfg.PushFailureAlert, "SS_PUSH_FAILURE_ALERT")
+	if err != nil {
+		return nil, err
+	}
+	err = envBool(&cfg.NotFoundIssues, "SS_NOT_FOUND_ISSUES")
+	if err != nil {
+		return nil, err
+	}
+	envString(&cfg.BatchWindow, "SS_BATCH_WINDOW")
+	envString(&cfg.RetryQueuePath, "SS_RETRY_QUEUE_PATH")
+	envString(&cfg.RetryQueueInterval, "SS_RETRY_QUEUE_INTERVAL")
+	envString(&cfg.RetryQueueExpiry, "SS_RETRY_QUEUE_EXPIRY")
+	envString(&cfg.RedisURL, "SS_REDIS_URL")
+	envString(&cfg.RedisPrefix, "SS_REDIS_PREFIX")
+	envString(&cfg.RedisLockTTL, "SS_REDIS_LOCK_TTL")
+	envString(&cfg.LeaseName, "SS_K8S_LEASE_NAME")
+	envString(&cfg.LeaseNamespace, "SS_K8S_LEASE_NAMESPACE")
+	envString(&cfg.LeaseDuration, "SS_K8S_LEASE_DURATION")
+	envString(&cfg.StatusDBPath, "SS_STATUS_DB_PATH")
+	envString(&cfg.StatsFilePath, "SS_STATS_FILE")
+	envString(&cfg.DataFilePath, "SS_DATA_FILE")
+	envString(&cfg.SummaryFilePath, "SS_SUMMARY_FILE")
+	envString(&cfg.SummaryDay, "SS_SUMMARY_DAY")
+	envString(&cfg.InactiveFilePath, "SS_INACTIVE_FILE")
+	envString(&cfg.InactiveAfter, "SS_INACTIVE_AFTER")
+	envString(&cfg.AvatarDir, "SS_AVATAR_DIR")
+	envString(&cfg.TwitchTeam, "SS_TWITCH_TEAM")
+	envString(&cfg.TwitchTeamInterval, "SS_TWITCH_TEAM_INTERVAL")
+	envString(&cfg.CallbackURL, "SS_CALLBACK_URL")
+	envString(&cfg.SubscriptionCheckInterval, "SS_SUBSCRIPTION_CHECK_INTERVAL")
+	envString(&cfg.ScheduleInterval, "SS_SCHEDULE_INTERVAL")
+	envString(&cfg.CalendarFilePath, "SS_CALENDAR_FILE")
+	envString(&cfg.LastLiveInterval, "SS_LAST_LIVE_INTERVAL")
+	envString(&cfg.RosterPath, "SS_ROSTER_FILE")
+	envString(&cfg.PollInterval, "SS_POLL_INTERVAL")
+	envString(&cfg.YouTubeAPIKey, "SS_YOUTUBE_API_KEY")
+	envString(&cfg.KickClientID, "SS_KICK_CLIENT_ID")
+	envString(&cfg.KickClientSecret, "SS_KICK_CLIENT_SECRET")
+	envString(&cfg.TrovoClientID, "SS_TROVO_CLIENT_ID")
+	envString(&cfg.DeadLetterPath, "SS_DEAD_LETTER_PATH")
+	envString(&cfg.AdminToken, "SS_ADMIN_TOKEN")
+	envString(&cfg.GRPCPort, "SS_GRPC_PORT")
+	envString(&cfg.RetryBaseDelay, "SS_RETRY_BASE_DELAY")
+	envString(&cfg.RetryMaxDelay, "SS_RETRY_MAX_DELAY")
+	envString(&cfg.RetryJitter, "SS_RETRY_JITTER")
+	envString(&cfg.GitCloneTimeout, "SS_GIT_CLONE_TIMEOUT")
+	envString(&cfg.GitTimeout, "SS_GIT_TIMEOUT")
+	envString(&cfg.LogFormat, "SS_LOG_FORMAT")
+	envString(&cfg.LogLevel, "SS_LOG_LEVEL")
+	envString(&cfg.LogFile, "SS_LOG_FILE")
+	err = envInt64(&cfg.LogFileMaxSize, "SS_LOG_FILE_MAX_SIZE")
+	if err != nil {
+		return nil, err
+	}
+	envString(&cfg.LogFileMaxAge, "SS_LOG_FILE_MAX_AGE")
+	envString(&cfg.SentryDSN, "SS_SENTRY_DSN")
+	envString(&cfg.SentryEnvironment, "SS_SENTRY_ENVIRONMENT")
+	envString(&cfg.TwitchClientID, "SS_TWITCH_CLIENT_ID")
+	envString(&cfg.TwitchClientSecret, "SS_TWITCH_CLIENT_SECRET")
+	envList(&cfg.DiscordWebhooks, "SS_DISCORD_WEBHOOKS")
+	envList(&cfg.SlackWebhooks, "SS_SLACK_WEBHOOKS")
+	envString(&cfg.MastodonServer, "SS_MASTODON_SERVER")
+	envString(&cfg.MastodonToken, "SS_MASTODON_TOKEN")
+	envString(&cfg.MastodonTemplate, "SS_MASTODON_TEMPLATE")
+	envString(&cfg.BlueskyServer, "SS_BLUESKY_SERVER")
+	envString(&cfg.BlueskyIdentifier, "SS_BLUESKY_IDENTIFIER")
+	envString(&cfg.BlueskyPassword, "SS_BLUESKY_PASSWORD")
+	envString(&cfg.BlueskyTemplate, "SS_BLUESKY_TEMPLATE")
+	envString(&cfg.TelegramToken, "SS_TELEGRAM_TOKEN")
+	envList(&cfg.TelegramChats, "SS_TELEGRAM_CHATS")
+	envString(&cfg.TelegramTemplate, "SS_TELEGRAM_TEMPLATE")
+	envList(&cfg.OutboundWebhooks, "SS_OUTBOUND_WEBHOOKS")
+	envString(&cfg.OutboundWebhookSecret, "SS_OUTBOUND_WEBHOOK_SECRET")
+	envString(&cfg.MQTTBroker, "SS_MQTT_BROKER")
+	envString(&cfg.MQTTClientID, "SS_MQTT_CLIENT_ID")
+	envString(&cfg.MQTTUsername, "SS_MQTT_USERNAME")
+	envString(&cfg.MQTTPassword, "SS_MQTT_PASSWORD")
+	envString(&cfg.MQTTTopicPrefix, "SS_MQTT_TOPIC_PREFIX")
+	envString(&cfg.MatrixHomeserver, "SS_MATRIX_HOMESERVER")
+	envString(&cfg.MatrixToken, "SS_MATRIX_TOKEN")
+	envList(&cfg.MatrixRooms, "SS_MATRIX_ROOMS")
+	// Google Cloud Run defaults to 8080. Their platform
+	// sets the $PORT ENV var if you override it with, e.g.:
+	// `gcloud run services update <service-name> --port <port>`.
+	envString(&cfg.Port, "SS_PORT")
+	envString(&cfg.Port, "PORT")
+	envList(&cfg.TLSDomains, "SS_TLS_DOMAINS")
+	envString(&cfg.TLSCacheDir, "SS_TLS_CACHE_DIR")
+	envString(&cfg.TLSEmail, "SS_TLS_EMAIL")
+	envString(&cfg.TLSHTTPPort, "SS_TLS_HTTP_PORT")
+	err = envInt64(&cfg.MaxBodyBytes, "SS_MAX_BODY_BYTES")
+	if err != nil {
+		return nil, err
+	}
+	err = envInt64(&cfg.WebhookRateLimit, "SS_WEBHOOK_RATE_LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	err = envInt64(&cfg.WebhookRateBurst, "SS_WEBHOOK_RATE_BURST")
+	if err != nil {
+		return nil, err
+	}
+	err = envInt64(&cfg.WebhookIPRateLimit, "SS_WEBHOOK_IP_RATE_LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	err = envInt64(&cfg.WebhookIPRateBurst, "SS_WEBHOOK_IP_RATE_BURST")
+	if err != nil {
+		return nil, err
+	}
+	envList(&cfg.TrustedProxies, "SS_TRUSTED_PROXIES")
+	err = envInt64(&cfg.CloneDepth, "SS_CLONE_DEPTH")
+	if err != nil {
+		return nil, err
+	}
+	err = envBool(&cfg.CloneSingleBranch, "SS_CLONE_SINGLE_BRANCH")
+	if err != nil {
+		return nil, err
+	}
+	err = envBool(&cfg.AutoAddRows, "SS_AUTO_ADD_ROWS")
+	if err != nil {
+		return nil, err
+	}
+	err = envBool(&cfg.PageTemplates, "SS_PAGE_TEMPLATES")
+	if err != nil {
+		return nil, err
+	}
+	envString(&cfg.PageTemplateDir, "SS_PAGE_TEMPLATE_DIR")
+	envString(&cfg.StatusStyle, "SS_STATUS_STYLE")
+	err = envBool(&cfg.LastUpdated, "SS_LAST_UPDATED")
+	if err != nil {
+		return nil, err
+	}
+	envString(&cfg.LastUpdatedTemplate, "SS_LAST_UPDATED_TEMPLATE")
+	envString(&cfg.LastUpdatedTimezone, "SS_LAST_UPDATED_TIMEZONE")
+	err = envBool(&cfg.LiveOnly, "SS_LIVE_ONLY")
+	if err != nil {
+		return nil, err
+	}
+	err = envBool(&cfg.VerifyStatus, "SS_VERIFY_STATUS")
+	if err != nil {
+		return nil, err
+	}
+	err = envBool(&cfg.DebugSimulate, "SS_DEBUG_SIMULATE")
+	if err != nil {
+		return nil, err
+	}
+	// 0 turns the warning off, so an unset warning is told apart by the
+	// pointer being nil.
+	costWarning := int64(80)
+	if cfg.SubscriptionCostWarning != nil {
+		costWarning = *cfg.SubscriptionCostWarning
+	}
+	err = envInt64(&costWarning, "SS_SUBSCRIPTION_COST_WARNING")
+	if err != nil {
+		return nil, err
+	}
+	cfg.SubscriptionCostWarning = &costWarning
+	err = envInt64(&cfg.RetryMaxAttempts, "SS_RETRY_MAX_ATTEMPTS")
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.RepoURL == "" {
+		log.Warnf("warning: no SS_GH_REPO specified in environment, defaulting to: %s", defaultRepoURL)
+		cfg.RepoURL = defaultRepoURL
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = providerGitHub
+	}
+	cfg.RepoURL = providerRepoURL(cfg.Provider, cfg.RepoURL)
+	if cfg.Provider == providerGitea && cfg.GiteaAPIURL == "" {
+		cfg.GiteaAPIURL = giteaAPIURL(cfg.RepoURL)
+	}
+	// GitLab accepts any username alongside a personal access token.
+	if cfg.Provider == providerGitLab && cfg.Username == "" {
+		cfg.Username = "oauth2"
+	}
+	if cfg.Port == "" && len(cfg.TLSDomains) > 0 {
+		cfg.Port = "443"
+	} else if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+	if cfg.TLSCacheDir == "" {
+		cfg.TLSCacheDir = "certs"
+	}
+	if cfg.TLSHTTPPort == "" {
+		cfg.TLSHTTPPort = "80"
+	}
+	if cfg.CommitAuthorName == "" {
+		cfg.CommitAuthorName = defaultCommitAuthorName
+	}
+	if cfg.CommitAuthorEmail == "" {
+		cfg.CommitAuthorEmail = defaultCommitAuthorEmail
+	}
+	if cfg.CommitOnlineTemplate == "" {
+		cfg.CommitOnlineTemplate = defaultCommitOnlineTemplate + " " + ciSkipMarkers[cfg.Provider]
+	}
+	if cfg.CommitOfflineTemplate == "" {
+		cfg.CommitOfflineTemplate = defaultCommitOfflineTemplate + " " + ciSkipMarkers[cfg.Provider]
+	}
+	if cfg.NewRowTemplate == "" {
+		cfg.NewRowTemplate = defaultNewRowTemplate
+	}
+	if cfg.StatusStyle == "" {
+		cfg.StatusStyle = "emoji"
+	}
+	if cfg.LastUpdatedTemplate == "" {
+		cfg.LastUpdatedTemplate = defaultLastUpdatedTemplate
+	}
+	if cfg.LastUpdatedTimezone == "" {
+		cfg.LastUpdatedTimezone = "UTC"
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "git"
+	}
+	if cfg.CloneStorage == "" {
+		cfg.CloneStorage = "disk"
+	}
+	if cfg.PushMode == "" {
+		cfg.PushMode = "direct"
+	}
+	if cfg.PullRequestBranch == "" {
+		cfg.PullRequestBranch = "streamstatus/updates"
+	}
+	if cfg.BatchWindow == "" {
+		cfg.BatchWindow = "0s"
+	}
+	if cfg.RetryQueueInterval == "" {
+		cfg.RetryQueueInterval = "1m"
+	}
+	if cfg.RetryQueueExpiry == "" {
+		cfg.RetryQueueExpiry = "24h"
+	}
+	if cfg.RedisPrefix == "" {
+		cfg.RedisPrefix = "streamstatus"
+	}
+	if cfg.RedisLockTTL == "" {
+		cfg.RedisLockTTL = "30s"
+	}
+	if cfg.SummaryDay == "" {
+		cfg.SummaryDay = "monday"
+	}
+	if cfg.InactiveAfter == "" {
+		cfg.InactiveAfter = "720h"
+	}
+	if cfg.PollInterval == "" {
+		cfg.PollInterval = "5m"
+	}
+	if cfg.TwitchTeamInterval == "" {
+		cfg.TwitchTeamInterval = "1h"
+	}
+	if cfg.SubscriptionCheckInterval == "" {
+		cfg.SubscriptionCheckInterval = "1h"
+	}
+	if cfg.LeaseDuration == "" {
+		cfg.LeaseDuration = "15s"
+	}
+	if cfg.RetryMaxAttempts == 0 {
+		cfg.RetryMaxAttempts = 5
+	}
+	if cfg.RetryBaseDelay == "" {
+		cfg.RetryBaseDelay = "1s"
+	}
+	if cfg.RetryMaxDelay == "" {
+		cfg.RetryMaxDelay = "30s"
+	}
+	if cfg.RetryJitter == "" {
+		cfg.RetryJitter = "1s"
+	}
+	if cfg.GitCloneTimeout == "" {
+		cfg.GitCloneTimeout = "5m"
+	}
+	if cfg.GitTimeout == "" {
+		cfg.GitTimeout = "1m"
+	}
+	if cfg.GitHubAPIURL == "" {
+		cfg.GitHubAPIURL = defaultGitHubAPI
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = "text"
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+	}
+	if cfg.LogFileMaxSize == 0 {
+		cfg.LogFileMaxSize = 100
+	}
+	if cfg.LogFileMaxAge == "" {
+		cfg.LogFileMaxAge = "168h"
+	}
+	if cfg.MaxBodyBytes == 0 {
+		cfg.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if cfg.MQTTClientID == "" {
+		cfg.MQTTClientID = "streamstatus"
+	}
+	if cfg.WebhookPath == "" {
+		cfg.WebhookPath = defaultWebhookPath
+	}
+
+	if cfg.SecretKey == "" {
+		return nil, fmt.Errorf("no SS_SECRETKEY specified in environment")
+	}
+	if isSSHURL(cfg.RepoURL) {
+		if cfg.SSHKeyPath == "" && cfg.SSHKey == "" {
+			return nil, fmt.Errorf("no SS_SSH_KEY_PATH or SS_SSH_KEY specified in environment for ssh remote")
+		}
+	} else if cfg.GitHubAppID != "" {
+		if cfg.GitHubAppInstallationID == "" || (cfg.GitHubAppPrivateKeyPath == "" && cfg.GitHubAppPrivateKey == "") {
+			return nil, fmt.Errorf("no SS_GH_APP_INSTALLATION_ID and/or SS_GH_APP_PRIVATE_KEY_PATH specified in environment for github app")
+		}
+	} else if cfg.Username == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("no SS_USERNAME and/or SS_TOKEN specified in environment")
+	}
+	if repoDirectory(cfg.RepoURL) == "" {
+		return nil, fmt.Errorf("invalid repo url: %s", cfg.RepoURL)
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return nil, fmt.Errorf("log format must be text or json: %s", cfg.LogFormat)
+	}
+	if _, err := log.ParseLevel(cfg.LogLevel); err != nil {
+		return nil, fmt.Errorf("invalid log level: %s", err)
+	}
+	if cfg.LogFileMaxSize < 0 {
+		return nil, fmt.Errorf("invalid log file max size: %d", cfg.LogFileMaxSize)
+	}
+	if _, err := time.ParseDuration(cfg.LogFileMaxAge); err != nil {
+		return nil, fmt.Errorf("invalid log file max age: %s", err)
+	}
+	if cfg.SigningFormat != "" && cfg.SigningFormat != "gpg" && cfg.SigningFormat != "ssh" {
+		return nil, fmt.Errorf("signing format must be gpg or ssh: %s", cfg.SigningFormat)
+	}
+	if cfg.SigningFormat != "" && cfg.SigningKeyPath == "" && cfg.SigningKey == "" {
+		return nil, fmt.Errorf("no SS_SIGNING_KEY_PATH or SS_SIGNING_KEY specified in environment for commit signing")
+	}
+	if _, ok := ciSkipMarkers[cfg.Provider]; !ok {
+		return nil, fmt.Errorf("provider must be github, gitlab or gitea: %s", cfg.Provider)
+	}
+	if cfg.Provider != providerGitHub && (cfg.GitHubAppID != "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("github apps and the github_api backend need the github provider")
+	}
+	if cfg.Provider == providerGitLab && cfg.PushMode != "direct" {
+		return nil, fmt.Errorf("pull request mode isn't supported for gitlab")
+	}
+	if cfg.Backend != "git" && cfg.Backend != "github_api" {
+		return nil, fmt.Errorf("backend must be git or github_api: %s", cfg.Backend)
+	}
+	if cfg.Backend == "github_api" && (isSSHURL(cfg.RepoURL) || cfg.PushMode != "direct" || cfg.SigningFormat != "") {
+		return nil, fmt.Errorf("github_api backend needs an https repo url and doesn't support pull request mode or commit signing")
+	}
+	if cfg.CloneStorage != "disk" && cfg.CloneStorage != "memory" {
+		return nil, fmt.Errorf("clone storage must be disk or memory: %s", cfg.CloneStorage)
+	}
+	if cfg.PushMode != "direct" && cfg.PushMode != "pull_request" {
+		return nil, fmt.Errorf("push mode must be direct or pull_request: %s", cfg.PushMode)
+	}
+	if cfg.PushMode == "pull_request" && cfg.Token == "" && cfg.GitHubAppID == "" {
+		return nil, fmt.Errorf("no SS_TOKEN or github app specified in environment for pull request mode")
+	}
+	if cfg.NotFoundIssues && (cfg.Provider != providerGitHub || (cfg.Token == "" && cfg.GitHubAppID == "")) {
+		return nil, fmt.Errorf("issues for missing streamers need GitHub and SS_TOKEN or a github app")
+	}
+	if cfg.StatsFilePath != "" && (cfg.StatusDBPath == "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("the stats page needs SS_STATUS_DB_PATH and the git backend")
+	}
+	if cfg.DataFilePath != "" && cfg.Backend != "git" {
+		return nil, fmt.Errorf("the data file needs the git backend")
+	}
+	if cfg.DataFilePath != "" && !isDataFile(cfg.DataFilePath) {
+		return nil, fmt.Errorf("SS_DATA_FILE must end in .yml, .yaml or .json, got %q", cfg.DataFilePath)
+	}
+	if cfg.GRPCPort != "" && cfg.AdminToken == "" {
+		return nil, fmt.Errorf("the grpc api needs SS_ADMIN_TOKEN")
+	}
+	if cfg.DebugSimulate && cfg.AdminToken == "" {
+		return nil, fmt.Errorf("the simulate endpoint needs SS_ADMIN_TOKEN")
+	}
+	if cfg.SummaryFilePath != "" && (cfg.StatusDBPath == "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("the weekly summary needs SS_STATUS_DB_PATH and the git backend")
+	}
+	if cfg.InactiveFilePath != "" && (cfg.StatusDBPath == "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("moving inactive streamers needs SS_STATUS_DB_PATH and the git backend")
+	}
+	if cfg.AvatarDir != "" && (cfg.TwitchClientID == "" || cfg.TwitchClientSecret == "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("avatars need the Twitch app credentials and the git backend")
+	}
+	if cfg.TwitchTeam != "" && (cfg.TwitchClientID == "" || cfg.TwitchClientSecret == "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("the team roster needs the Twitch app credentials and the git backend")
+	}
+	if cfg.ScheduleInterval != "" && (cfg.TwitchClientID == "" || cfg.TwitchClientSecret == "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("the next stream column needs the Twitch app credentials and the git backend")
+	}
+	if (cfg.KickClientID == "") != (cfg.KickClientSecret == "") {
+		return nil, fmt.Errorf("polling Kick needs both SS_KICK_CLIENT_ID and SS_KICK_CLIENT_SECRET")
+	}
+	for _, source := range cfg.URLSources {
+		if source.Platform == "" || source.URL == "" || source.LiveField == "" {
+			return nil, fmt.Errorf("each URL source needs a platform, url and live_field")
+		}
+		if source.Platform == platformTwitch || strings.Contains(source.Platform, ":") {
+			return nil, fmt.Errorf("invalid URL source platform %q", source.Platform)
+		}
+	}
+	if (cfg.YouTubeAPIKey != "" || cfg.KickClientID != "" || cfg.TrovoClientID != "" || len(cfg.URLSources) > 0) && cfg.RosterPath == "" {
+		return nil, fmt.Errorf("no SS_ROSTER_FILE specified in environment with the channels to poll")
+	}
+	if cfg.PageTemplateDir != "" && !cfg.PageTemplates {
+		return nil, fmt.Errorf("SS_PAGE_TEMPLATE_DIR needs SS_PAGE_TEMPLATES")
+	}
+	if _, err := time.LoadLocation(cfg.LastUpdatedTimezone); err != nil {
+		return nil, fmt.Errorf("invalid SS_LAST_UPDATED_TIMEZONE: %s", err)
+	}
+	if _, ok := render.Styles[cfg.StatusStyle]; !ok {
+		return nil, fmt.Errorf("SS_STATUS_STYLE must be emoji, text or aria, got %q", cfg.StatusStyle)
+	}
+	if cfg.LastLiveInterval != "" && (cfg.StatusDBPath == "" || cfg.Backend != "git") {
+		return nil, fmt.Errorf("the last live column needs SS_STATUS_DB_PATH and the git backend")
+	}
+	if cfg.CalendarFilePath != "" && cfg.ScheduleInterval == "" {
+		return nil, fmt.Errorf("the calendar needs SS_SCHEDULE_INTERVAL")
+	}
+	if cfg.LeaseName != "" && cfg.RedisURL == "" {
+		return nil, fmt.Errorf("no SS_REDIS_URL specified in environment for followers to queue changes with")
+	}
+	if cfg.CloneDepth < 0 {
+		return nil, fmt.Errorf("invalid clone depth: %d", cfg.CloneDepth)
+	}
+	if cfg.RetryMaxAttempts < 1 {
+		return nil, fmt.Errorf("retry max attempts must be at least 1: %d", cfg.RetryMaxAttempts)
+	}
+	if *cfg.SubscriptionCostWarning < 0 || *cfg.SubscriptionCostWarning > 100 {
+		return nil, fmt.Errorf("subscription cost warning must be a percentage: %d", *cfg.SubscriptionCostWarning)
+	}
+	if cfg.PushFailureAlert < 0 {
+		return nil, fmt.Errorf("invalid push failure alert count: %d", cfg.PushFailureAlert)
+	}
+	if cfg.MaxBodyBytes < 0 {
+		return nil, fmt.Errorf("invalid max body bytes: %d", cfg.MaxBodyBytes)
+	}
+	if cfg.WebhookRateLimit < 0 || cfg.WebhookRateBurst < 0 || cfg.WebhookIPRateLimit < 0 || cfg.WebhookIPRateBurst < 0 {
+		return nil, fmt.Errorf("webhook rate limits can't be negative")
+	}
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookPath[0] != '/' {
+		return nil, fmt.Errorf("webhook path must start with /: %s", cfg.WebhookPath)
+	}
+	return cfg, nil
+}
+
+// envString sets dst to the value of the environment variable name if it is set.
+func envString(dst *string, name string) {
+	envNames[name] = true
+	if v := os.Getenv(name); v != "" {
+		*dst = v
+	}
+}
+
+// envList sets dst to the comma separated values of the environment variable name if it is set.
+func envList(dst *[]string, name string) {
+	envNames[name] = true
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	var values []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	*dst = values
+}
+
+// envInt64 sets dst to the integer value of the environment variable name if it is set.
+func envInt64(dst *int64, name string) error {
+	envNames[name] = true
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", name, v)
+	}
+	*dst = n
+	return nil
+}
+
+// envBool sets dst to the boolean value of the environment variable name if it is set.
+func envBool(dst *bool, name string) error {
+	envNames[name] = true
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", name, v)
+	}
+	*dst = b
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// contentsAPI reads and writes a file with the GitHub Contents API, so the
+// site can be updated without a local clone.
+type contentsAPI struct {
+	apiURL string
+	branch string
+	owner  string
+	repo   string
+	token  func() (string, error)
+}
+
+// newContentsAPI returns a Contents API client for the configured repo, or nil
+// when the git backend is used.
+func newContentsAPI(cfg *config, auth transport.AuthMethod) (*contentsAPI, error) {
+	if cfg.Backend != "github_api" {
+		return nil, nil
+	}
+	owner, repo, err := repoOwnerAndName(cfg.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &contentsAPI{
+		apiURL: strings.TrimRight(cfg.GitHubAPIURL, "/"),
+		branch: cfg.Branch,
+		owner:  owner,
+		repo:   repo,
+		token:  githubToken(cfg, auth),
+	}, nil
+}
+
+// githubContent is the subset of a GitHub file content response used here.
+type githubContent struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	SHA      string `json:"sha"`
+}
+
+// githubCommitter is the author of a commit made with the Contents API.
+type githubCommitter struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// githubContentUpdate is the body of a Contents API file update.
+type githubContentUpdate struct {
+	Message   string          `json:"message"`
+	Content   string          `json:"content"`
+	SHA       string          `json:"sha"`
+	Branch    string          `json:"branch,omitempty"`
+	Committer githubCommitter `json:"committer"`
+}
+
+// githubRef is the subset of a GitHub git reference used here.
+type githubRef struct {
+	Object struct {
+		SHA string `json:"sha"`
+	} `json:"object"`
+}
+
+// request returns an authenticated request for path within the repository's API.
+func (c *contentsAPI) request(method, path string, body []byte) (*http.Request, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/repos/%s/%s", c.apiURL, c.owner, c.repo)
+	if path != "" {
+		u += "/" + path
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// get returns the contents of the file at path on the branch and the blob
+// SHA needed to update it.
+func (c *contentsAPI) get(path string) (string, string, error) {
+	apiPath := "contents/" + path
+	if c.branch != "" {
+		apiPath += "?ref=" + url.QueryEscape(c.branch)
+	}
+	req, err := c.request(http.MethodGet, apiPath, nil)
+	if err != nil {
+		return "", "", err
+	}
+	var content githubContent
+	err = doRequest(req, &content)
+	if err != nil {
+		return "", "", err
+	}
+	if content.Encoding != "base64" {
+		return "", "", fmt.Errorf("unsupported content encoding for %s: %s", path, content.Encoding)
+	}
+	// The content is wrapped onto multiple lines.
+	data, err := base64.StdEncoding.DecodeString(strings.Replace(content.Content, "\n", "", -1))
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), content.SHA, nil
+}
+
+// put commits text as the new contents of the file at path, replacing the
+// blob with the given SHA. It fails with a 409 status if the file has changed.
+func (c *contentsAPI) put(path, text, sha, message string, committer githubCommitter) error {
+	body, err := json.Marshal(githubContentUpdate{
+		Message:   message,
+		Content:   base64.StdEncoding.EncodeToString([]byte(text)),
+		SHA:       sha,
+		Branch:    c.branch,
+		Committer: committer,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := c.request(http.MethodPut, "contents/"+path, body)
+	if err != nil {
+		return err
+	}
+	return doRequest(req, nil)
+}
+
+// ensureBranch creates the branch from the default branch if it doesn't exist.
+func (c *contentsAPI) ensureBranch() error {
+	if c.branch == "" {
+		return nil
+	}
+	_, err := c.headSHA(c.branch)
+	if !hasStatus(err, http.StatusNotFound) {
+		return err
+	}
+	req, err := c.request(http.MethodGet, "", nil)
+	if err != nil {
+		return err
+	}
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err = doRequest(req, &repo)
+	if err != nil {
+		return err
+	}
+	sha, err := c.headSHA(repo.DefaultBranch)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{
+		"ref": "refs/heads/" + c.branch,
+		"sha": sha,
+	})
+	if err != nil {
+		return err
+	}
+	req, err = c.request(http.MethodPost, "git/refs", body)
+	if err != nil {
+		return err
+	}
+	return doRequest(req, nil)
+}
+
+// headSHA returns the commit SHA at the head of branch.
+func (c *contentsAPI) headSHA(branch string) (string, error) {
+	req, err := c.request(http.MethodGet, "git/ref/heads/"+branch, nil)
+	if err != nil {
+		return "", err
+	}
+	var ref githubRef
+	err = doRequest(req, &ref)
+	return ref.Object.SHA, err
+}
+
+// isConflict reports whether err is a Contents API update rejected because
+// the file changed since it was read.
+func isConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// updateContents reads index.md with the Contents API, updates the
+// streamer's status and commits it back, reading it again if someone else
+// changed it in the meantime. The outcome of committing it is passed to
+// pushed.
+func updateContents(repo *StreamersRepo, pushed func(error)) error {
+	for attempt := 1; ; attempt++ {
+		var sha string
+		err := repo.retry.do(repo.logger, "contents read", func() error {
+			var err error
+			repo.indexMdText, sha, err = repo.contents.get(repo.indexFilePath)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		original := repo.indexMdText
+		err = repo.applyChanges()
+		if err != nil {
+			return err
+		}
+		repo.indexMdText, err = repo.layout(repo.indexFilePath, repo.indexMdText)
+		if err != nil {
+			return err
+		}
+		if repo.indexMdText == original {
+			repo.logger.Warn("index.md is unchanged, nothing to commit")
+			return &NoChangeNeededError{err: "no changes to commit"}
+		}
+		// The footer is set after the comparison, so it alone isn't a change.
+		repo.indexMdText, err = repo.lastUpdated(repo.indexMdText, time.Now())
+		if err != nil {
+			return err
+		}
+		message, err := repo.commitMessage()
+		if err != nil {
+			return err
+		}
+		committer := githubCommitter{Name: repo.authorName, Email: repo.authorEmail}
+		err = repo.retry.do(repo.logger, "contents update", func() error {
+			return repo.contents.put(repo.indexFilePath, repo.indexMdText, sha, message, committer)
+		})
+		if !isConflict(err) || attempt == maxPushAttempts {
+			pushed(err)
+			return err
+		}
+		repo.logger.Warnf("%s changed while updating, retrying (attempt %d)", repo.indexFilePath, attempt+1)
+	}
+}
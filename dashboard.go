@@ -0,0 +1,108 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// dashboardTemplate renders the dashboard page.
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>StreamStatus</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>StreamStatus</h1>
+<h2>Queue</h2>
+<table>
+<tr><th>Pending changes</th><td>{{.QueueDepth}}</td></tr>
+<tr><th>Pending tasks</th><td>{{.PendingTasks}}</td></tr>
+<tr><th>Last push</th><td>{{with .LastPush}}{{if .At.IsZero}}none yet{{else}}{{.At.Format "2006-01-02 15:04:05 MST"}} for {{.Event}}: {{if .Error}}<span class="failed">{{.Error}}</span>{{else}}ok{{end}}{{end}}{{end}}</td></tr>
+</table>
+<h2>Processed events</h2>
+{{if .Processed}}<table>
+<tr><th>Type</th><th>Outcome</th><th>Count</th></tr>
+{{range .Processed}}<tr><td>{{index .Labels 0}}</td><td{{if or (eq (index .Labels 1) "failed") (eq (index .Labels 1) "push_failed") (eq (index .Labels 1) "not_found")}} class="failed"{{end}}>{{index .Labels 1}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{else}}<p>None since starting.</p>
+{{end}}
+{{if .Statuses}}
+<h2>Streamers</h2>
+<table>
+<tr><th>Streamer</th><th>Status</th><th>Since</th><th>Event</th></tr>
+{{range .Statuses}}<tr><td>{{.Streamer}}</td><td>{{if .Online}}🟢 online{{else}}offline{{end}}</td><td>{{.ChangedAt.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.EventID}}</td></tr>
+{{end}}</table>
+<h2>Recent events</h2>
+<table>
+<tr><th>Processed</th><th>Streamer</th><th>Type</th><th>Outcome</th><th>Event</th></tr>
+{{range .Events}}<tr><td>{{.ProcessedAt.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Streamer}}</td><td>{{.Type}}</td><td{{if .Error}} class="failed" title="{{.Error}}"{{end}}>{{.Outcome}}</td><td>{{.EventID}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>Set SS_STATUS_DB_PATH to list streamers and recent events.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// dashboardEvents is how many of the latest events the dashboard lists.
+const dashboardEvents = 50
+
+// dashboardData is what the dashboard shows.
+type dashboardData struct {
+	QueueDepth   int
+	PendingTasks int
+	LastPush     pushResult
+	// Processed counts the events processed since starting by type and
+	// outcome.
+	Processed []server.CounterValue
+	Statuses  []streamerStatus
+	Events    []historyEvent
+}
+
+// dashboard serves an HTML page of the queue, the latest push, the events
+// processed by outcome and, with the status database, each streamer's status
+// and the latest events.
+func (h *adminHandler) dashboard(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeBrowser(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	data := dashboardData{
+		QueueDepth:   len(h.queue.changes),
+		PendingTasks: h.queue.pendingTasks(),
+		LastPush:     h.queue.pushed(),
+		Processed:    eventsProcessed.Snapshot(),
+	}
+	if h.statuses != nil {
+		var err error
+		data.Statuses, err = h.statuses.all()
+		if err == nil {
+			data.Events, err = h.statuses.history("", time.Time{}, dashboardEvents)
+		}
+		if err != nil {
+			log.Printf("error reading status database: %s\n", err)
+			server.WriteError(w, http.StatusInternalServerError, "error reading status database")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, data)
+	if err != nil {
+		log.Printf("error rendering dashboard: %s\n", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// dataStreamer is a streamer in the data file.
+type dataStreamer struct {
+	Name     string `json:"name"`
+	Online   bool   `json:"online"`
+	Inactive bool   `json:"inactive"`
+	URL      string `json:"url"`
+	// Links are the cells after the name in the streamer's row, as markdown.
+	Links string `json:"links"`
+}
+
+// isDataFile reports whether name has an extension the data file can be
+// written as, YAML or JSON.
+func isDataFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yml", ".yaml", ".json":
+		return true
+	}
+	return false
+}
+
+// dataStreamers returns the streamers in index.md and then those in the
+// inactive page.
+func dataStreamers(index, inactive string) []dataStreamer {
+	var streamers []dataStreamer
+	for i, text := range []string{index, inactive} {
+		for _, row := range render.ParseRows(text) {
+			streamers = append(streamers, dataStreamer{
+				Name:     row.Name,
+				Online:   row.Online,
+				Inactive: i == 1,
+				URL:      channelURL(platformTwitch, strings.ToLower(row.Name)),
+				Links:    row.Columns,
+			})
+		}
+	}
+	return streamers
+}
+
+// renderData renders the streamers as JSON when name ends in .json, or YAML,
+// for a static site generator to lay out.
+func renderData(name string, streamers []dataStreamer) (string, error) {
+	if strings.EqualFold(path.Ext(name), ".json") {
+		if streamers == nil {
+			streamers = []dataStreamer{}
+		}
+		data, err := json.MarshalIndent(streamers, "", "  ")
+		return string(data) + "\n", err
+	}
+	if len(streamers) == 0 {
+		return "[]\n", nil
+	}
+	// Double quoted YAML strings take the same escapes as Go's.
+	var b strings.Builder
+	for _, st := range streamers {
+		fmt.Fprintf(&b, "- name: %s\n", strconv.Quote(st.Name))
+		fmt.Fprintf(&b, "  online: %t\n", st.Online)
+		fmt.Fprintf(&b, "  inactive: %t\n", st.Inactive)
+		fmt.Fprintf(&b, "  url: %s\n", strconv.Quote(st.URL))
+		fmt.Fprintf(&b, "  links: %s\n", strconv.Quote(st.Links))
+	}
+	return b.String(), nil
+}
+
+// writeDataFile writes the data file from index.md's text and the inactive
+// page to the worktree.
+func (s *StreamersRepo) writeDataFile(index string) error {
+	data, err := renderData(s.dataFilePath, dataStreamers(index, s.inactiveMdText))
+	if err != nil {
+		return err
+	}
+	return s.writeRepoFile(s.dataFilePath, data)
+}
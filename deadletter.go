@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+)
+
+// deadLetter is a change that couldn't be applied, as written to the
+// dead-letter file. Changes from EventSub keep the verified notification they
+// came from, which replays are rebuilt from.
+type deadLetter struct {
+	Change   storedChange `json:"change"`
+	Error    string       `json:"error"`
+	FailedAt time.Time    `json:"failed_at"`
+}
+
+// replayChange returns the change to replay for the entry, decoded again from
+// its notification when it has one. Entries written before notifications were
+// kept, and changes that didn't come from EventSub, replay the stored change.
+func (e deadLetter) replayChange() (statusChange, error) {
+	c := e.Change.change()
+	if len(e.Change.Notification) == 0 {
+		return c, nil
+	}
+	var vals twitch.Notification
+	err := json.Unmarshal(e.Change.Notification, &vals)
+	if err != nil {
+		return c, fmt.Errorf("decoding notification: %w", err)
+	}
+	event, err := twitch.DecodeStreamEvent(vals)
+	if err != nil {
+		return c, fmt.Errorf("decoding %s event: %w", vals.Subscription.Type, err)
+	}
+	return statusChange{
+		id:           c.id,
+		login:        event.UserLogin,
+		online:       event.Online,
+		streamer:     event.UserName,
+		userID:       event.UserID,
+		queuedAt:     c.queuedAt,
+		notification: e.Change.Notification,
+	}, nil
+}
+
+// deadLetterLog records changes that failed permanently or ran out of
+// retries as JSON lines in a file, so they can be inspected and replayed.
+type deadLetterLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// newDeadLetterLog returns the dead-letter log at the configured path, or nil
+// when no path is configured.
+func newDeadLetterLog(cfg *config) *deadLetterLog {
+	if cfg.DeadLetterPath == "" {
+		return nil
+	}
+	return &deadLetterLog{path: cfg.DeadLetterPath}
+}
+
+// add appends changes to the log along with the error that stopped them.
+func (d *deadLetterLog) add(changes []statusChange, reason error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, c := range changes {
+		err = enc.Encode(deadLetter{
+			Change:   newStoredChange(c),
+			Error:    reason.Error(),
+			FailedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// list returns the entries in the log, oldest first.
+func (d *deadLetterLog) list() ([]deadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.read()
+}
+
+// take removes and returns the entries for the event id, or every entry when
+// id is empty.
+func (d *deadLetterLog) take(id string) ([]deadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	var taken, kept []deadLetter
+	for _, e := range entries {
+		if id == "" || e.Change.ID == id {
+			taken = append(taken, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	if len(taken) == 0 {
+		return nil, nil
+	}
+	return taken, d.write(kept)
+}
+
+// read parses the log, which is missing until the first entry is added.
+func (d *deadLetterLog) read() ([]deadLetter, error) {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []deadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// write replaces the log with entries, via a temporary file so a crash can't
+// leave it half written.
+func (d *deadLetterLog) write(entries []deadLetter) error {
+	f, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), d.path)
+}
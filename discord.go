@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// discordColor is Twitch purple, used for the embed accent.
+const discordColor = 0x9146ff
+
+// discordNotifier posts go-live embeds to Discord webhooks.
+type discordNotifier struct {
+	webhooks []string
+}
+
+// discordMessage is the body of a Discord webhook execution.
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+// discordEmbed is a Discord rich embed.
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url"`
+	Color       int                 `json:"color"`
+	Timestamp   string              `json:"timestamp"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+	Image       *discordEmbedImage  `json:"image,omitempty"`
+}
+
+// discordEmbedField is a name/value pair shown in an embed.
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordEmbedImage is an image shown in an embed.
+type discordEmbedImage struct {
+	URL string `json:"url"`
+}
+
+// notify posts an embed to each webhook when the streamer goes live.
+func (d *discordNotifier) notify(n notification) error {
+	if !n.Online {
+		return nil
+	}
+	embed := discordEmbed{
+		Title:       fmt.Sprintf("%s is live!", n.Streamer),
+		Description: n.Title,
+		URL:         n.URL,
+		Color:       discordColor,
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if n.Game != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "Game", Value: n.Game, Inline: true})
+	}
+	if n.ThumbnailURL != "" {
+		embed.Image = &discordEmbedImage{URL: n.ThumbnailURL}
+	}
+	msg := discordMessage{Embeds: []discordEmbed{embed}}
+
+	var failed []string
+	for _, url := range d.webhooks {
+		err := postJSON(url, msg, nil)
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("discord: %d of %d webhooks failed: %v", len(failed), len(d.webhooks), failed)
+	}
+	return nil
+}
+
+// alert posts the message to each webhook.
+func (d *discordNotifier) alert(message string) error {
+	var failed []string
+	for _, url := range d.webhooks {
+		err := postJSON(url, map[string]string{"content": message}, nil)
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("discord: %d of %d webhooks failed: %v", len(failed), len(d.webhooks), failed)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/infosecstreams/StreamStatus/internal/gitops"
+)
+
+// doctorTimeout bounds the doctor command's request to the callback URL.
+const doctorTimeout = 10 * time.Second
+
+// doctorCheck is a check of the setup run by the doctor command, with a hint
+// at how to fix it when it fails.
+type doctorCheck struct {
+	name string
+	hint string
+	run  func() error
+}
+
+// doctorCommand checks the settings work, printing what to change for those
+// that don't.
+func doctorCommand(cfg *config, args []string) error {
+	auth, err := newGitAuth(cfg)
+	if err != nil {
+		return err
+	}
+	checks := []doctorCheck{
+		{
+			name: "webhook secret",
+			hint: "set SS_SECRETKEY to the secret the EventSub subscriptions were created with",
+			run:  func() error { return checkSecret(cfg.SecretKey) },
+		},
+		{
+			name: "site repo readable",
+			hint: "check SS_GH_REPO and that the token, key or app can read it",
+			run:  func() error { return checkRepoReadable(cfg, auth) },
+		},
+		{
+			name: "site repo writable",
+			hint: "give the token, deploy key or app write access to the repo",
+			run:  func() error { return checkRepoWritable(cfg.RepoURL, auth) },
+		},
+	}
+	if cfg.TwitchClientID != "" {
+		checks = append(checks, doctorCheck{
+			name: "Twitch app credentials",
+			hint: "check SS_TWITCH_CLIENT_ID and SS_TWITCH_CLIENT_SECRET against the app in the Twitch developer console",
+			run: func() error {
+				_, err := commandTwitch(cfg)
+				return err
+			},
+		})
+	}
+	if cfg.CallbackURL != "" {
+		checks = append(checks, doctorCheck{
+			name: "callback URL",
+			hint: "SS_CALLBACK_URL must be an https URL on port 443 reaching SS_WEBHOOK_PATH on this server",
+			run:  func() error { return checkCallback(cfg.CallbackURL) },
+		})
+	}
+	failed := 0
+	for _, c := range checks {
+		err := c.run()
+		if err == nil {
+			fmt.Printf("ok    %s\n", c.name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s: %s\n      %s\n", c.name, err, c.hint)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// checkSecret checks the webhook secret is a length EventSub accepts.
+func checkSecret(secret string) error {
+	if len(secret) < 10 || len(secret) > 100 {
+		return fmt.Errorf("it's %d characters, EventSub needs 10 to 100", len(secret))
+	}
+	return nil
+}
+
+// checkRepoReadable lists the site repo's references, or reads index.md with
+// the GitHub API backend.
+func checkRepoReadable(cfg *config, auth transport.AuthMethod) error {
+	contents, err := newContentsAPI(cfg, auth)
+	if err != nil {
+		return err
+	}
+	if contents != nil {
+		_, _, err = contents.get("index.md")
+		return err
+	}
+	timeout, err := time.ParseDuration(cfg.GitTimeout)
+	if err != nil {
+		return err
+	}
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{Name: "origin", URLs: []string{cfg.RepoURL}})
+	return gitops.WithTimeout("list", timeout, func(ctx context.Context) error {
+		_, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+		return err
+	})
+}
+
+// checkRepoWritable starts a push to the site repo without sending anything,
+// which hosts refuse without write access.
+func checkRepoWritable(repoURL string, auth transport.AuthMethod) error {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return err
+	}
+	c, err := client.NewClient(endpoint)
+	if err != nil {
+		return err
+	}
+	session, err := c.NewReceivePackSession(endpoint, auth)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	_, err = session.AdvertisedReferences()
+	return err
+}
+
+// checkCallback checks the callback URL is one EventSub delivers to and that
+// it reaches the webhook, which refuses an unsigned request.
+func checkCallback(callback string) error {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || (u.Port() != "" && u.Port() != "443") {
+		return fmt.Errorf("EventSub only delivers to https on port 443")
+	}
+	httpClient := &http.Client{Timeout: doctorTimeout}
+	resp, err := httpClient.Post(callback, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		return fmt.Errorf("an unsigned request got %s instead of 403 Forbidden", resp.Status)
+	}
+	return nil
+}
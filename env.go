@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultEnvFile is loaded at startup when SS_ENV_FILE is unset, if it exists.
+const defaultEnvFile = ".env"
+
+// envNames are the environment variables loadConfig has read, which flags
+// are checked against.
+var envNames = map[string]bool{"SS_CONFIG": true, "SS_ENV_FILE": true}
+
+// loadEnvFile sets the variables in the .env file at SS_ENV_FILE, or ./.env,
+// that aren't already set. Lines are NAME=value, optionally quoted and
+// prefixed with export, with # comments.
+func loadEnvFile() error {
+	path := os.Getenv("SS_ENV_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = defaultEnvFile
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return fmt.Errorf("error parsing %s line %d: expected NAME=value", path, n)
+		}
+		name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if _, ok := os.LookupEnv(name); !ok {
+			os.Setenv(name, value)
+		}
+	}
+	return scanner.Err()
+}
+
+// flagShorthands are flags setting a variable to a fixed value, by name.
+var flagShorthands = map[string][2]string{
+	"debug": {"SS_LOG_LEVEL", "debug"},
+}
+
+// applyFlags sets the environment variable each leading --name=value flag in
+// args mirrors, SS_ followed by the name in upper case with dashes as
+// underscores, overriding the environment. A flag without a value that isn't
+// followed by one is true, and a shorthand sets its variable. It returns the
+// remaining arguments and the names of the variables set, to be checked once
+// the config is loaded.
+func applyFlags(args []string) ([]string, []string, error) {
+	var names []string
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		flag := strings.TrimLeft(args[0], "-")
+		args = args[1:]
+		if flag == "" {
+			break
+		}
+		if shorthand, ok := flagShorthands[flag]; ok {
+			err := os.Setenv(shorthand[0], shorthand[1])
+			if err != nil {
+				return nil, nil, err
+			}
+			names = append(names, shorthand[0])
+			continue
+		}
+		value := "true"
+		if i := strings.Index(flag, "="); i >= 0 {
+			flag, value = flag[:i], flag[i+1:]
+		} else if len(args) > 0 && !strings.HasPrefix(args[0], "-") && commands[args[0]] == nil && args[0] != "help" {
+			value, args = args[0], args[1:]
+		}
+		name := "SS_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+		err := os.Setenv(name, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+	}
+	return args, names, nil
+}
+
+// checkFlags returns an error for the first flag set that doesn't mirror an
+// environment variable loadConfig reads.
+func checkFlags(names []string) error {
+	for _, name := range names {
+		if !envNames[name] {
+			flag := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, "SS_"), "_", "-"))
+			return fmt.Errorf("unknown flag --%s", flag)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+)
+
+// subscribe creates the subscriptions to twitch.StreamerEventTypes of the
+// broadcaster with the user ID for the webhook at callback, treating ones that
+// already exist as created.
+func (t *twitchClient) subscribe(userID, callback, secret string, logger *log.Entry) error {
+	for _, eventType := range twitch.StreamerEventTypes {
+		subscription := &helix.EventSubSubscription{
+			Type:      eventType,
+			Version:   twitch.EventVersion(eventType),
+			Condition: twitch.EventCondition(eventType, userID),
+			Transport: helix.EventSubTransport{Method: "webhook", Callback: callback, Secret: secret},
+		}
+		err := t.do(logger, "eventsub subscription", func() error {
+			resp, err := t.client.CreateEventSubSubscription(subscription)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode == http.StatusConflict {
+				return nil
+			}
+			err = helixError(resp.StatusCode, "error subscribing to "+eventType+" for "+userID, resp.ErrorMessage)
+			if err == nil {
+				t.recordUsage(-1, resp.Data.TotalCost, resp.Data.MaxTotalCost, logger)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscriptions returns the app's EventSub subscriptions, with the total cost
+// of them and the most they're allowed to cost.
+func (t *twitchClient) subscriptions(logger *log.Entry) ([]helix.EventSubSubscription, int, int, error) {
+	var subscriptions []helix.EventSubSubscription
+	var totalCost, maxCost int
+	params := &helix.EventSubSubscriptionsParams{}
+	for {
+		var resp *helix.EventSubSubscriptionsResponse
+		err := t.do(logger, "eventsub subscription list", func() error {
+			var err error
+			resp, err = t.client.GetEventSubSubscriptions(params)
+			if err != nil {
+				return err
+			}
+			return helixError(resp.StatusCode, "error listing eventsub subscriptions", resp.ErrorMessage)
+		})
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		subscriptions = append(subscriptions, resp.Data.EventSubSubscriptions...)
+		totalCost, maxCost = resp.Data.TotalCost, resp.Data.MaxTotalCost
+		if resp.Data.Pagination.Cursor == "" {
+			t.recordUsage(len(subscriptions), totalCost, maxCost, logger)
+			return subscriptions, totalCost, maxCost, nil
+		}
+		params.After = resp.Data.Pagination.Cursor
+	}
+}
+
+// removeSubscription deletes the EventSub subscription with the ID, treating
+// one that's already gone as deleted.
+func (t *twitchClient) removeSubscription(id string, logger *log.Entry) error {
+	return t.do(logger, "eventsub subscription removal", func() error {
+		resp, err := t.client.RemoveEventSubSubscription(id)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return helixError(resp.StatusCode, "error removing subscription "+id, resp.ErrorMessage)
+	})
+}
+
+// unsubscribe deletes every EventSub subscription of the broadcaster with the
+// user ID and returns how many there were.
+func (t *twitchClient) unsubscribe(userID string, logger *log.Entry) (int, error) {
+	subscriptions, _, _, err := t.subscriptions(logger)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, s := range subscriptions {
+		if twitch.SubscriptionUserID(s) != userID {
+			continue
+		}
+		err = t.removeSubscription(s.ID, logger)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
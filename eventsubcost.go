@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// subscriptionCost and subscriptionMaxCost are the cost of the app's EventSub
+// subscriptions and Twitch's limit on it at the last check.
+var (
+	subscriptionCost    = server.NewGauge("streamstatus_eventsub_cost", "Cost of the app's EventSub subscriptions at the last check.")
+	subscriptionMaxCost = server.NewGauge("streamstatus_eventsub_max_cost", "Twitch's limit on the cost of the app's EventSub subscriptions.")
+)
+
+// subscriptionUsage is how many EventSub subscriptions the app has and what
+// they cost against Twitch's limit, as of CheckedAt.
+type subscriptionUsage struct {
+	Count        int       `json:"count"`
+	TotalCost    int       `json:"total_cost"`
+	MaxTotalCost int       `json:"max_total_cost"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// nearLimit reports whether the subscriptions cost at least percent of the
+// limit.
+func (u subscriptionUsage) nearLimit(percent int) bool {
+	return u.MaxTotalCost > 0 && u.TotalCost*100 >= u.MaxTotalCost*percent
+}
+
+// recordUsage stores the subscription cost last reported by Helix, and the
+// count if it's known, warning when it's close to the limit since new
+// streamers fail to subscribe once it's reached.
+func (t *twitchClient) recordUsage(count, totalCost, maxCost int, logger *log.Entry) {
+	t.usageMu.Lock()
+	if count < 0 {
+		count = t.usage.Count
+	}
+	t.usage = subscriptionUsage{Count: count, TotalCost: totalCost, MaxTotalCost: maxCost, CheckedAt: time.Now()}
+	usage := t.usage
+	t.usageMu.Unlock()
+	subscriptionCost.Set(int64(totalCost))
+	subscriptionMaxCost.Set(int64(maxCost))
+	if t.costWarning > 0 && usage.nearLimit(t.costWarning) {
+		logger.Errorf("eventsub subscriptions cost %d of %d, new streamers will fail to subscribe at the limit: prune them with prune-subs", usage.TotalCost, usage.MaxTotalCost)
+	}
+}
+
+// subscriptionUsage returns the subscription count and cost at the last
+// check.
+func (t *twitchClient) subscriptionUsage() subscriptionUsage {
+	t.usageMu.Lock()
+	defer t.usageMu.Unlock()
+	return t.usage
+}
+
+// monitorSubscriptions lists the app's subscriptions now and then every
+// interval until done is closed, so their cost is tracked.
+func (t *twitchClient) monitorSubscriptions(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	logger := log.WithField("event_id", "subscription-usage")
+	for {
+		_, _, _, err := t.subscriptions(logger)
+		if err != nil {
+			logger.Printf("error checking eventsub subscription usage: %s\n", err)
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// subscriptions returns the app's EventSub subscription count and cost as
+// JSON, checking them first if they haven't been yet.
+func (h *adminHandler) subscriptions(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	client := h.queue.twitch
+	if client.subscriptionUsage().CheckedAt.IsZero() {
+		_, _, _, err := client.subscriptions(log.WithField("event_id", "subscription-usage"))
+		if err != nil {
+			log.Printf("error checking eventsub subscription usage: %s\n", err)
+			server.WriteError(w, http.StatusBadGateway, "error checking eventsub subscriptions")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client.subscriptionUsage())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// giteaPulls opens pull requests with the Gitea API, which Forgejo and
+// Codeberg share.
+type giteaPulls struct {
+	apiURL string
+	owner  string
+	repo   string
+	token  string
+}
+
+// giteaPull is the subset of a Gitea pull request used to match branches.
+type giteaPull struct {
+	pullRequest
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	Head struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// header returns the headers for a Gitea API request.
+func (g *giteaPulls) header() http.Header {
+	header := http.Header{}
+	header.Set("Authorization", "token "+g.token)
+	header.Set("Accept", "application/json")
+	return header
+}
+
+// openPullRequests returns the open pull requests from head into base. Gitea
+// can't filter by branch, so the open pull requests are matched here.
+func (g *giteaPulls) openPullRequests(head, base string) ([]pullRequest, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/repos/%s/%s/pulls?state=open&limit=50", g.apiURL, g.owner, g.repo), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = g.header()
+	var pulls []giteaPull
+	err = doRequest(req, &pulls)
+	if err != nil {
+		return nil, err
+	}
+	var open []pullRequest
+	for _, p := range pulls {
+		if p.Head.Ref == head && p.Base.Ref == base {
+			open = append(open, p.pullRequest)
+		}
+	}
+	return open, nil
+}
+
+// createPullRequest opens a pull request from head into base.
+func (g *giteaPulls) createPullRequest(head, base, title string) (*pullRequest, error) {
+	var created pullRequest
+	err := postJSONResponse(fmt.Sprintf("%s/repos/%s/%s/pulls", g.apiURL, g.owner, g.repo), map[string]string{
+		"title": title,
+		"head":  head,
+		"base":  base,
+		"body":  pullRequestBody,
+	}, g.header(), &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
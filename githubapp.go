@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultGitHubAPI is the GitHub REST API base URL.
+	defaultGitHubAPI = "https://api.github.com"
+	// githubAppJWTLifetime is how long app JWTs are valid; GitHub allows at most 10 minutes.
+	githubAppJWTLifetime = 9 * time.Minute
+	// githubTokenRefreshMargin refreshes installation tokens this long before they expire.
+	githubTokenRefreshMargin = 5 * time.Minute
+)
+
+// githubAppAuth authenticates git over HTTPS as a GitHub App installation,
+// exchanging app JWTs for installation tokens and refreshing them as needed.
+// It satisfies go-git's http.AuthMethod.
+type githubAppAuth struct {
+	apiURL         string
+	appID          string
+	installationID string
+	key            *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newGitHubAppAuth returns app auth using the configured private key.
+func newGitHubAppAuth(cfg *config) (*githubAppAuth, error) {
+	pemBytes := []byte(cfg.GitHubAppPrivateKey)
+	if len(pemBytes) == 0 {
+		var err error
+		pemBytes, err = os.ReadFile(cfg.GitHubAppPrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key, err := parseRSAPrivateKey(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &githubAppAuth{
+		apiURL:         strings.TrimRight(cfg.GitHubAPIURL, "/"),
+		appID:          cfg.GitHubAppID,
+		installationID: cfg.GitHubAppInstallationID,
+		key:            key,
+	}, nil
+}
+
+// parseRSAPrivateKey parses a PKCS#1 or PKCS#8 PEM encoded RSA key.
+func parseRSAPrivateKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in github app private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("github app private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Name returns the auth method name.
+func (a *githubAppAuth) Name() string {
+	return "github-app"
+}
+
+// String describes the auth method without revealing the token.
+func (a *githubAppAuth) String() string {
+	return fmt.Sprintf("%s - app %s installation %s", a.Name(), a.appID, a.installationID)
+}
+
+// SetAuth adds the current installation token to a git HTTP request.
+func (a *githubAppAuth) SetAuth(r *http.Request) {
+	token, err := a.installationToken()
+	if err != nil {
+		log.Printf("error getting github app installation token: %s\n", err)
+		return
+	}
+	r.SetBasicAuth("x-access-token", token)
+}
+
+// installationToken returns a cached installation token, requesting a new one
+// when it is missing or about to expire.
+func (a *githubAppAuth) installationToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Until(a.expires) > githubTokenRefreshMargin {
+		return a.token, nil
+	}
+
+	jwt, err := a.jwt()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/app/installations/%s/access_tokens", a.apiURL, a.installationID), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	err = doRequest(req, &resp)
+	if err != nil {
+		return "", err
+	}
+	a.token = resp.Token
+	a.expires = resp.ExpiresAt
+	log.Printf("refreshed github app installation token, expires %s\n", a.expires.Format(time.RFC3339))
+	return a.token, nil
+}
+
+// jwt returns an RS256 signed JWT identifying the app.
+func (a *githubAppAuth) jwt() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		// Backdated to allow for clock drift.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(githubAppJWTLifetime).Unix(),
+		"iss": a.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -3,7 +3,18 @@ module github.com/infosecstreams/StreamStatus
 go 1.16
 
 require (
+	github.com/ProtonMail/go-crypto v0.0.0-20210428141323-04723f9f07d7
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/getsentry/sentry-go v0.11.0
+	github.com/go-git/go-billy/v5 v5.3.1
 	github.com/go-git/go-git/v5 v5.4.2
+	github.com/gomodule/redigo v1.8.9
+	github.com/graph-gophers/graphql-go v1.3.0
 	github.com/nicklaw5/helix v1.24.2
 	github.com/sirupsen/logrus v1.8.1
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
+	google.golang.org/grpc v1.46.2
+	google.golang.org/protobuf v1.28.0
+	modernc.org/sqlite v1.14.8
 )
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// graphQLSchema describes the statuses and history that can be queried.
+const graphQLSchema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	# Streamers with a known status, optionally only those online or offline,
+	# or on a platform such as twitch or youtube.
+	streamers(online: Boolean, platform: String): [Streamer!]!
+	# The streamer with the login or channel, if they have a known status.
+	streamer(login: String!): Streamer
+	# Processed events newest first, by default those of the last day.
+	events(streamer: String, since: Time, limit: Int = 100): [Event!]!
+}
+
+type Streamer {
+	userId: String!
+	login: String!
+	name: String!
+	platform: String!
+	online: Boolean!
+	changedAt: Time!
+	eventId: String!
+	# The streamer's processed events newest first, by default those of the
+	# last day.
+	events(since: Time, limit: Int = 100): [Event!]!
+}
+
+type Event {
+	eventId: String!
+	userId: String!
+	login: String!
+	name: String!
+	type: String!
+	queuedAt: Time!
+	processedAt: Time!
+	outcome: String!
+	error: String
+}
+`
+
+// graphQLRequest is the body of a GraphQL query.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLResolver answers queries from the status database.
+type graphQLResolver struct {
+	statuses *statusStore
+}
+
+// eventsArgs limits the events queried.
+type eventsArgs struct {
+	Since *graphql.Time
+	Limit int32
+}
+
+// Streamers returns the streamers matching the filters.
+func (r *graphQLResolver) Streamers(args struct {
+	Online   *bool
+	Platform *string
+}) ([]*graphQLStreamer, error) {
+	statuses, err := r.statuses.all()
+	if err != nil {
+		return nil, err
+	}
+	streamers := []*graphQLStreamer{}
+	for _, st := range statuses {
+		if args.Online != nil && st.Online != *args.Online {
+			continue
+		}
+		if args.Platform != nil && !strings.EqualFold(changePlatform(st.UserID), *args.Platform) {
+			continue
+		}
+		streamers = append(streamers, newGraphQLStreamer(st, r.statuses))
+	}
+	return streamers, nil
+}
+
+// Streamer returns the streamer with the login, or nil.
+func (r *graphQLResolver) Streamer(args struct{ Login string }) (*graphQLStreamer, error) {
+	statuses, err := r.statuses.all()
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range statuses {
+		if strings.EqualFold(st.Login, args.Login) {
+			return newGraphQLStreamer(st, r.statuses), nil
+		}
+	}
+	return nil, nil
+}
+
+// Events returns the processed events matching the filters.
+func (r *graphQLResolver) Events(args struct {
+	Streamer *string
+	eventsArgs
+}) ([]*graphQLEvent, error) {
+	var streamer string
+	if args.Streamer != nil {
+		streamer = *args.Streamer
+	}
+	return queryEvents(r.statuses, streamer, args.eventsArgs)
+}
+
+// queryEvents returns the streamer's processed events, or everyone's when
+// streamer is empty.
+func queryEvents(statuses *statusStore, streamer string, args eventsArgs) ([]*graphQLEvent, error) {
+	since := time.Now().Add(-24 * time.Hour)
+	if args.Since != nil {
+		since = args.Since.Time
+	}
+	limit := int(args.Limit)
+	if limit < 1 || limit > 1000 {
+		limit = 1000
+	}
+	history, err := statuses.history(streamer, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	events := []*graphQLEvent{}
+	for _, e := range history {
+		events = append(events, newGraphQLEvent(e))
+	}
+	return events, nil
+}
+
+// graphQLStreamer is a streamer in query results.
+type graphQLStreamer struct {
+	UserID    string
+	Login     string
+	Name      string
+	Platform  string
+	Online    bool
+	ChangedAt graphql.Time
+	EventID   string
+	statuses  *statusStore
+}
+
+// newGraphQLStreamer returns the streamer with the status.
+func newGraphQLStreamer(st streamerStatus, statuses *statusStore) *graphQLStreamer {
+	return &graphQLStreamer{
+		UserID:    st.UserID,
+		Login:     st.Login,
+		Name:      st.Streamer,
+		Platform:  changePlatform(st.UserID),
+		Online:    st.Online,
+		ChangedAt: graphql.Time{Time: st.ChangedAt},
+		EventID:   st.EventID,
+		statuses:  statuses,
+	}
+}
+
+// Events returns the streamer's processed events.
+func (s *graphQLStreamer) Events(args eventsArgs) ([]*graphQLEvent, error) {
+	return queryEvents(s.statuses, s.Login, args)
+}
+
+// graphQLEvent is a processed event in query results.
+type graphQLEvent struct {
+	EventID     string
+	UserID      string
+	Login       string
+	Name        string
+	Type        string
+	QueuedAt    graphql.Time
+	ProcessedAt graphql.Time
+	Outcome     string
+	Error       *string
+}
+
+// newGraphQLEvent returns the processed event.
+func newGraphQLEvent(e historyEvent) *graphQLEvent {
+	event := &graphQLEvent{
+		EventID:     e.EventID,
+		UserID:      e.UserID,
+		Login:       e.Login,
+		Name:        e.Streamer,
+		Type:        e.Type,
+		QueuedAt:    graphql.Time{Time: e.QueuedAt},
+		ProcessedAt: graphql.Time{Time: e.ProcessedAt},
+		Outcome:     e.Outcome,
+	}
+	if e.Error != "" {
+		event.Error = &e.Error
+	}
+	return event
+}
+
+// graphQLHandler serves GraphQL queries of the status database, which need
+// the admin token like the history endpoint.
+type graphQLHandler struct {
+	admin  *adminHandler
+	schema *graphql.Schema
+}
+
+// newGraphQLHandler parses the schema, resolving it from the status database.
+func newGraphQLHandler(admin *adminHandler) (*graphQLHandler, error) {
+	schema, err := graphql.ParseSchema(graphQLSchema, &graphQLResolver{statuses: admin.statuses}, graphql.UseFieldResolvers())
+	if err != nil {
+		return nil, err
+	}
+	return &graphQLHandler{admin: admin, schema: schema}, nil
+}
+
+// serve answers a query in a JSON body, or in the query parameter of a GET.
+func (h *graphQLHandler) serve(w http.ResponseWriter, r *http.Request) {
+	if !h.admin.authorize(w, r) {
+		return
+	}
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			err := json.Unmarshal([]byte(v), &req.Variables)
+			if err != nil {
+				server.WriteError(w, http.StatusBadRequest, "malformed variables")
+				return
+			}
+		}
+	case http.MethodPost:
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			server.WriteError(w, http.StatusBadRequest, "malformed request")
+			return
+		}
+	default:
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	resp := h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	for _, err := range resp.Errors {
+		log.Printf("error answering graphql query: %s\n", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/statusapi"
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchBuffer is how many changes a watcher can fall behind by before they're
+// dropped for it.
+const watchBuffer = 16
+
+// statusWatchers passes the status changes made to index.md to each gRPC
+// client watching them.
+type statusWatchers struct {
+	mu       sync.Mutex
+	closed   bool
+	watchers map[chan notification]bool
+}
+
+// newStatusWatchers returns watchers with no one watching.
+func newStatusWatchers() *statusWatchers {
+	return &statusWatchers{watchers: map[chan notification]bool{}}
+}
+
+// watch returns a channel receiving each change from then on, which is closed
+// when the watchers are.
+func (s *statusWatchers) watch() chan notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan notification, watchBuffer)
+	if s.closed {
+		close(ch)
+		return ch
+	}
+	s.watchers[ch] = true
+	return ch
+}
+
+// stop stops passing changes to the channel.
+func (s *statusWatchers) stop(ch chan notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watchers[ch] {
+		delete(s.watchers, ch)
+		close(ch)
+	}
+}
+
+// publish passes n to every watcher, dropping it for those that have fallen
+// behind rather than holding up the queue.
+func (s *statusWatchers) publish(n notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.watchers {
+		select {
+		case ch <- n:
+		default:
+			log.Warnf("grpc watcher fell behind, dropping change for %s", n.Streamer)
+		}
+	}
+}
+
+// close closes every watcher's channel, ending their streams.
+func (s *statusWatchers) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ch := range s.watchers {
+		delete(s.watchers, ch)
+		close(ch)
+	}
+}
+
+// grpcServer serves the gRPC API, which needs the admin token like the admin
+// endpoints.
+type grpcServer struct {
+	statusapi.UnimplementedStreamStatusServer
+	callbackURL string
+	queue       *updateQueue
+	secret      string
+	token       string
+}
+
+// newGRPCServer returns a gRPC server for the API, using tlsConfig if it's set.
+func newGRPCServer(cfg *config, queue *updateQueue, tlsConfig *tls.Config) *grpc.Server {
+	s := &grpcServer{
+		callbackURL: cfg.CallbackURL,
+		queue:       queue,
+		secret:      cfg.SecretKey,
+		token:       cfg.AdminToken,
+	}
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.authorizeUnary),
+		grpc.StreamInterceptor(s.authorizeStream),
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	statusapi.RegisterStreamStatusServer(server, s)
+	return server
+}
+
+// serveGRPC serves the gRPC API on the port until it's stopped.
+func serveGRPC(server *grpc.Server, port string) {
+	listener, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Fatalf("error listening for grpc: %s", err)
+	}
+	log.Printf("grpc server starting on %s\n", port)
+	err = server.Serve(listener)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// authorize checks the call's bearer token.
+func (s *grpcServer) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) != 1 || subtle.ConstantTimeCompare([]byte(values[0]), []byte("Bearer "+s.token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid admin token")
+	}
+	return nil
+}
+
+// authorizeUnary rejects unary calls without the admin token.
+func (s *grpcServer) authorizeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authorizeStream rejects streaming calls without the admin token.
+func (s *grpcServer) authorizeStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := s.authorize(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// ListStatuses returns each streamer's last known status.
+func (s *grpcServer) ListStatuses(ctx context.Context, req *statusapi.ListStatusesRequest) (*statusapi.ListStatusesResponse, error) {
+	if s.queue.statuses == nil {
+		return nil, status.Error(codes.FailedPrecondition, "listing statuses needs SS_STATUS_DB_PATH")
+	}
+	statuses, err := s.queue.statuses.all()
+	if err != nil {
+		log.Printf("error reading status database: %s\n", err)
+		return nil, status.Error(codes.Internal, "error reading status database")
+	}
+	resp := &statusapi.ListStatusesResponse{}
+	for _, st := range statuses {
+		resp.Statuses = append(resp.Statuses, &statusapi.StreamerStatus{
+			UserId:    st.UserID,
+			Login:     st.Login,
+			Streamer:  st.Streamer,
+			Online:    st.Online,
+			ChangedAt: timestamppb.New(st.ChangedAt),
+			EventId:   st.EventID,
+		})
+	}
+	return resp, nil
+}
+
+// WatchStatuses streams the status changes made to index.md until the client
+// goes away or the server stops.
+func (s *grpcServer) WatchStatuses(req *statusapi.WatchStatusesRequest, stream statusapi.StreamStatus_WatchStatusesServer) error {
+	changes := s.queue.watchers.watch()
+	defer s.queue.watchers.stop(changes)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case n, ok := <-changes:
+			if !ok {
+				return nil
+			}
+			err := stream.Send(&statusapi.StreamerStatus{
+				UserId:    n.UserID,
+				Login:     n.Login,
+				Streamer:  n.Streamer,
+				Online:    n.Online,
+				ChangedAt: timestamppb.New(time.Now()),
+				EventId:   n.EventID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// AddStreamer subscribes to a streamer's events and commits a row for them.
+func (s *grpcServer) AddStreamer(ctx context.Context, req *statusapi.AddStreamerRequest) (*statusapi.StreamerResponse, error) {
+	if s.callbackURL == "" {
+		return nil, status.Error(codes.FailedPrecondition, "adding streamers needs SS_CALLBACK_URL")
+	}
+	return s.updateStreamer(ctx, req.Login, func(user helix.User) error {
+		return s.queue.addStreamer(user, s.callbackURL, s.secret)
+	})
+}
+
+// RemoveStreamer deletes a streamer's subscriptions and rows, or archives
+// their row.
+func (s *grpcServer) RemoveStreamer(ctx context.Context, req *statusapi.RemoveStreamerRequest) (*statusapi.StreamerResponse, error) {
+	return s.updateStreamer(ctx, req.Login, func(user helix.User) error {
+		return s.queue.removeStreamer(user, req.Archive)
+	})
+}
+
+// updateStreamer looks up the streamer with the login and runs update for
+// them between changes.
+func (s *grpcServer) updateStreamer(ctx context.Context, login string, update func(user helix.User) error) (*statusapi.StreamerResponse, error) {
+	if login == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+	if s.queue.twitch == nil || s.queue.repo.contents != nil {
+		return nil, status.Error(codes.FailedPrecondition, "managing streamers needs the Twitch app credentials and the git backend")
+	}
+	logger := log.WithField("event_id", "grpc-streamers")
+	users, err := s.queue.twitch.getUsersByLogin([]string{login}, logger)
+	if err != nil {
+		logger.Printf("error looking up %s: %s\n", login, err)
+		return nil, status.Error(codes.Unavailable, "error looking up streamer")
+	}
+	if len(users) == 0 {
+		return nil, status.Error(codes.NotFound, "no such streamer")
+	}
+	user := users[0]
+	err = s.queue.runTask(ctx, func() error {
+		return update(user)
+	})
+	noChange := errors.Is(err, ErrNoChangeNeeded)
+	if err != nil && !noChange {
+		logger.Printf("error updating %s: %s\n", user.Login, err)
+		return nil, grpcError(err)
+	}
+	return &statusapi.StreamerResponse{
+		UserId:   user.ID,
+		Login:    user.Login,
+		Streamer: user.DisplayName,
+		Changed:  !noChange,
+	}, nil
+}
+
+// Reconcile queues changes for the rows of index.md that disagree with
+// Twitch.
+func (s *grpcServer) Reconcile(ctx context.Context, req *statusapi.ReconcileRequest) (*statusapi.ReconcileResponse, error) {
+	if s.queue.twitch == nil || s.queue.repo.contents != nil {
+		return nil, status.Error(codes.FailedPrecondition, "reconciling needs the Twitch app credentials and the git backend")
+	}
+	var queued int
+	err := s.queue.runTask(ctx, func() error {
+		s.queue.repo.logger = log.WithField("event_id", "grpc-reconcile")
+		var err error
+		queued, err = s.queue.reconcile()
+		return err
+	})
+	if err != nil {
+		log.Printf("error reconciling: %s\n", err)
+		return nil, grpcError(err)
+	}
+	return &statusapi.ReconcileResponse{Queued: int32(queued)}, nil
+}
+
+// grpcError returns the gRPC status for an error running a task.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, errNotLeading), errors.Is(err, errQueueClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
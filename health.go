@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// readiness tracks the checks that must pass before the service can usefully
+// receive webhooks.
+type readiness struct {
+	mu            sync.RWMutex
+	repoCloned    bool
+	authValidated bool
+	secretPresent bool
+	pushFailing   bool
+}
+
+// setRepoCloned records whether the site repository is available on disk.
+func (r *readiness) setRepoCloned(ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.repoCloned = ok
+}
+
+// setAuthValidated records whether the git credentials were accepted by the remote.
+func (r *readiness) setAuthValidated(ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.authValidated = ok
+}
+
+// setSecretPresent records whether the EventSub secret is configured.
+func (r *readiness) setSecretPresent(ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secretPresent = ok
+}
+
+// setPushFailing records whether pushes to the site keep failing.
+func (r *readiness) setPushFailing(failing bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pushFailing = failing
+}
+
+// failing returns the names of the checks which are not passing.
+func (r *readiness) failing() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var failed []string
+	if !r.repoCloned {
+		failed = append(failed, "repo not cloned")
+	}
+	if !r.authValidated {
+		failed = append(failed, "credentials not validated")
+	}
+	if !r.secretPresent {
+		failed = append(failed, "twitch secret missing")
+	}
+	if r.pushFailing {
+		failed = append(failed, "pushes failing")
+	}
+	return failed
+}
+
+// healthz reports that the process is alive.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// readyz reports whether the service is ready to process webhooks.
+func (r *readiness) readyz(w http.ResponseWriter, req *http.Request) {
+	failed := r.failing()
+	if len(failed) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(fmt.Sprintf("not ready: %s", strings.Join(failed, ", "))))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// checkReadiness clones the repository and validates the git credentials,
+// recording the results in ready, and returns false if either failed.
+func checkReadiness(repo *StreamersRepo, ready *readiness) bool {
+	// Without a clone, reading index.md checks both the repo and the token.
+	if repo.contents != nil {
+		err := repo.contents.ensureBranch()
+		if err != nil {
+			log.Printf("error creating branch %s with the github api: %s\n", repo.contents.branch, err)
+			return false
+		}
+		_, _, err = repo.contents.get(repo.indexFilePath)
+		if err != nil {
+			log.Printf("error reading %s with the github api: %s\n", repo.indexFilePath, err)
+			return false
+		}
+		ready.setRepoCloned(true)
+		ready.setAuthValidated(true)
+		log.Println("repo readable and credentials validated.")
+		return true
+	}
+	err := repo.withCloneLock(func() error {
+		return repo.retry.do(repo.logger, "clone", repo.getRepo)
+	})
+	if err != nil {
+		log.Printf("error during repo clone: %s\n", err)
+		return false
+	}
+	ready.setRepoCloned(true)
+
+	err = repo.validateAuth()
+	if err != nil {
+		log.Printf("error validating git credentials: %s\n", err)
+		return false
+	}
+	ready.setAuthValidated(true)
+	log.Println("repo cloned and credentials validated.")
+	return true
+}
+
+// minReadinessRecheck is the shortest wait between readiness checks, however
+// short the retry policy's delays.
+const minReadinessRecheck = 10 * time.Second
+
+// recheckReadiness runs checkReadiness again with backoff until it succeeds
+// or done is closed, so /readyz recovers along with the remote or the
+// credentials.
+func recheckReadiness(repo *StreamersRepo, ready *readiness, done chan struct{}) {
+	for attempt := 1; ; attempt++ {
+		delay := repo.retry.backoff(attempt)
+		if delay < minReadinessRecheck {
+			delay = minReadinessRecheck
+		}
+		log.Printf("checking readiness again in %s\n", delay)
+		select {
+		case <-done:
+			return
+		case <-time.After(delay):
+		}
+		if checkReadiness(repo, ready) {
+			return
+		}
+	}
+}
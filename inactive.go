@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// inactiveCheckInterval is how often streamers are checked for inactivity.
+const inactiveCheckInterval = 24 * time.Hour
+
+// moveInactive moves the rows of streamers who haven't been live on any
+// platform for the inactivity period from index.md to the inactive page. Only
+// streamers in the status database are moved, as the last time anyone else
+// was live is unknown.
+func (q *updateQueue) moveInactive() error {
+	statuses, err := q.statuses.all()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-q.inactiveAfter)
+	active := map[string]bool{}
+	var logins []string
+	for _, st := range statuses {
+		login := strings.ToLower(st.Login)
+		if _, ok := active[login]; !ok {
+			logins = append(logins, login)
+		}
+		active[login] = active[login] || st.Online || !st.ChangedAt.Before(cutoff)
+	}
+	var inactive []string
+	for _, login := range logins {
+		if !active[login] {
+			inactive = append(inactive, login)
+		}
+	}
+	if len(inactive) == 0 {
+		return &NoChangeNeededError{err: "no inactive streamers"}
+	}
+	repo := q.repo
+	return q.commitTask("inactive-streamers", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		var moved []string
+		for _, login := range inactive {
+			if repo.moveToInactive(login) {
+				moved = append(moved, login)
+			}
+		}
+		if len(moved) == 0 {
+			return "", &NoChangeNeededError{err: "no inactive streamers in " + repo.indexFilePath}
+		}
+		repo.logger.Printf("moving %s to %s\n", strings.Join(moved, ", "), repo.inactiveFilePath)
+		message := fmt.Sprintf("🗃️ Moved %s to %s after %s offline", strings.Join(moved, ", "), repo.inactiveFilePath, q.inactiveAfter)
+		return message, repo.writeFiles()
+	}, repo.indexFilePath, repo.inactiveFilePath)
+}
+
+// runInactiveChecks moves inactive streamers now and then every
+// inactiveCheckInterval until the queue is done.
+func (q *updateQueue) runInactiveChecks() {
+	ticker := time.NewTicker(inactiveCheckInterval)
+	defer ticker.Stop()
+	for {
+		q.scheduleTask("inactive streamers", q.moveInactive)
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
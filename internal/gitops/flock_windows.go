@@ -0,0 +1,15 @@
+package gitops
+
+import (
+	"os"
+)
+
+// tryLockFile takes no lock on Windows, which has no flock.
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile releases nothing on Windows.
+func unlockFile(f *os.File) error {
+	return nil
+}
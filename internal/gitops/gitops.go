@@ -0,0 +1,68 @@
+// Package gitops holds the git plumbing the site's clone is updated with:
+// timeouts around network operations, writing files so a crash can't leave
+// them half written, the lock other processes honour around the clone, and
+// telling a push rejected because the remote moved on from other failures.
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WithTimeout calls fn with a context that expires after timeout, or never
+// if it's 0, so a hung network operation fails and can be retried.
+func WithTimeout(operation string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := fn(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("git %s timed out after %s: %w", operation, timeout, err)
+	}
+	return err
+}
+
+// WriteFileAtomic writes data to a temporary file beside name, syncs it to
+// disk and renames it over name, so a crash leaves either the old or the new
+// contents and never a partial file that could be committed.
+func WriteFileAtomic(name string, data []byte) error {
+	dir := filepath.Dir(name)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		return err
+	}
+	// Sync the directory too so the rename itself survives a crash.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
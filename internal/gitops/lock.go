@@ -0,0 +1,92 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// lockTimeout is how long to wait for another process to release
+	// the clone before giving up on the change.
+	lockTimeout = 10 * time.Minute
+	// lockPoll is how often the lock is tried while another process
+	// holds it.
+	lockPoll = 100 * time.Millisecond
+)
+
+// CloneLock is an advisory lock on a file beside the clone, held around git
+// operations on it so other instances, or a person who takes the lock, can't
+// change the checkout at the same time. It can be taken again by the holder.
+type CloneLock struct {
+	path string
+
+	mu    sync.Mutex
+	depth int
+	file  *os.File
+}
+
+// NewCloneLock returns the lock for the clone at repoPath, or nil for a clone
+// in memory, which no other process can touch.
+func NewCloneLock(repoPath string, inMemory bool) *CloneLock {
+	if inMemory {
+		return nil
+	}
+	return &CloneLock{path: repoPath + ".lock"}
+}
+
+// Acquire takes the lock, waiting for another process to release it.
+func (l *CloneLock) Acquire(logger *log.Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.depth > 0 {
+		l.depth++
+		return nil
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for waited := false; ; waited = true {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if locked {
+			break
+		}
+		if !waited {
+			logger.Warnf("%s is held by another process, waiting for it", l.path)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return fmt.Errorf("timed out waiting for %s", l.path)
+		}
+		time.Sleep(lockPoll)
+	}
+	l.file = f
+	l.depth = 1
+	return nil
+}
+
+// Release releases the lock once it's released as many times as it was
+// taken.
+func (l *CloneLock) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.depth--
+	if l.depth > 0 {
+		return
+	}
+	err := unlockFile(l.file)
+	if err != nil {
+		log.Printf("error unlocking %s: %s\n", l.path, err)
+	}
+	l.file.Close()
+	l.file = nil
+}
@@ -0,0 +1,131 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// ErrPushRejected is matched by a push rejected because the remote branch
+// has commits the local one doesn't.
+var ErrPushRejected = errors.New("push rejected")
+
+// PushRejectedError wraps the error of a push rejected because the remote
+// branch has commits the local one doesn't. It matches ErrPushRejected.
+type PushRejectedError struct {
+	Err error
+}
+
+// Error returns the push error's message.
+func (e *PushRejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrPushRejected, e.Err)
+}
+
+// Is reports whether target is ErrPushRejected.
+func (e *PushRejectedError) Is(target error) bool {
+	return target == ErrPushRejected
+}
+
+// Unwrap returns the push error.
+func (e *PushRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Repo is the part of a clone that pushes are checked against. Clone is the
+// go-git implementation.
+type Repo interface {
+	// Head returns the reference HEAD points at.
+	Head() (*plumbing.Reference, error)
+	// RemoteRef returns the reference with the name as it is on the remote
+	// now, rather than as it was last fetched.
+	RemoteRef(name plumbing.ReferenceName) (*plumbing.Reference, error)
+	// IsAncestor reports whether the commit ancestor is reachable from
+	// commit, failing if either isn't in the clone.
+	IsAncestor(ancestor, commit plumbing.Hash) (bool, error)
+}
+
+// HasDiverged reports whether local has commits that remote doesn't, or
+// either isn't in the clone.
+func HasDiverged(repo Repo, local, remote plumbing.Hash) bool {
+	if local == remote {
+		return false
+	}
+	ancestor, err := repo.IsAncestor(local, remote)
+	return err != nil || !ancestor
+}
+
+// PushRejected reports whether pushing HEAD failed with err because the
+// remote branch has commits HEAD doesn't. go-git doesn't return an error value
+// for every push it rejects, so unless err is one the remote branch is looked
+// up and compared with HEAD.
+func PushRejected(repo Repo, err error) bool {
+	if errors.Is(err, git.ErrNonFastForwardUpdate) || errors.Is(err, git.ErrForceNeeded) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return false
+	}
+	remote, err := repo.RemoteRef(head.Name())
+	if err != nil {
+		return false
+	}
+	return HasDiverged(repo, remote.Hash(), head.Hash())
+}
+
+// Clone is a go-git repository checked against the remote it pushes to.
+type Clone struct {
+	Repo    *git.Repository
+	Remote  string
+	Auth    transport.AuthMethod
+	Timeout time.Duration
+}
+
+// Head returns the reference HEAD points at.
+func (c *Clone) Head() (*plumbing.Reference, error) {
+	return c.Repo.Head()
+}
+
+// RemoteRef lists the remote's references and returns the one with the name.
+func (c *Clone) RemoteRef(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	remote, err := c.Repo.Remote(c.Remote)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*plumbing.Reference
+	err = WithTimeout("ls-remote", c.Timeout, func(ctx context.Context) error {
+		var err error
+		refs, err = remote.ListContext(ctx, &git.ListOptions{Auth: c.Auth})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref, nil
+		}
+	}
+	return nil, plumbing.ErrReferenceNotFound
+}
+
+// IsAncestor reports whether the commit ancestor is reachable from commit.
+func (c *Clone) IsAncestor(ancestor, commit plumbing.Hash) (bool, error) {
+	a, err := c.Repo.CommitObject(ancestor)
+	if err != nil {
+		return false, err
+	}
+	b, err := c.Repo.CommitObject(commit)
+	if err != nil {
+		return false, err
+	}
+	return a.IsAncestor(b)
+}
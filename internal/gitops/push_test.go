@@ -0,0 +1,117 @@
+package gitops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// fakeRepo is a Repo whose commits each have one parent, given by parents.
+type fakeRepo struct {
+	head    plumbing.Hash
+	remote  *plumbing.Hash
+	parents map[plumbing.Hash]plumbing.Hash
+}
+
+func (r *fakeRepo) Head() (*plumbing.Reference, error) {
+	return plumbing.NewHashReference("refs/heads/main", r.head), nil
+}
+
+func (r *fakeRepo) RemoteRef(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	if r.remote == nil {
+		return nil, plumbing.ErrReferenceNotFound
+	}
+	return plumbing.NewHashReference(name, *r.remote), nil
+}
+
+func (r *fakeRepo) IsAncestor(ancestor, commit plumbing.Hash) (bool, error) {
+	if _, ok := r.parents[ancestor]; !ok {
+		return false, plumbing.ErrObjectNotFound
+	}
+	for c := commit; !c.IsZero(); c = r.parents[c] {
+		if c == ancestor {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var (
+	base    = plumbing.NewHash("1111111111111111111111111111111111111111")
+	local   = plumbing.NewHash("2222222222222222222222222222222222222222")
+	ahead   = plumbing.NewHash("3333333333333333333333333333333333333333")
+	missing = plumbing.NewHash("4444444444444444444444444444444444444444")
+)
+
+// newFakeRepo returns a repo with HEAD at local on top of base, and another
+// commit, ahead, on top of base too.
+func newFakeRepo(remote *plumbing.Hash) *fakeRepo {
+	return &fakeRepo{
+		head:    local,
+		remote:  remote,
+		parents: map[plumbing.Hash]plumbing.Hash{base: plumbing.ZeroHash, local: base, ahead: base},
+	}
+}
+
+func TestPushRejected(t *testing.T) {
+	failed := errors.New("unexpected client error: non-fast-forward update: refs/heads/main")
+	tests := []struct {
+		name   string
+		remote *plumbing.Hash
+		err    error
+		want   bool
+	}{
+		{"non-fast-forward error", &local, git.ErrNonFastForwardUpdate, true},
+		{"force needed error", &local, fmt.Errorf("pushing: %w", git.ErrForceNeeded), true},
+		{"timeout", &ahead, fmt.Errorf("git push timed out: %w", context.DeadlineExceeded), false},
+		{"remote has other commits", &ahead, failed, true},
+		{"remote commit not fetched", &missing, failed, true},
+		{"remote behind", &base, failed, false},
+		{"remote up to date", &local, failed, false},
+		{"no remote branch", nil, failed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PushRejected(newFakeRepo(tt.remote), tt.err); got != tt.want {
+				t.Errorf("PushRejected() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasDiverged(t *testing.T) {
+	repo := newFakeRepo(nil)
+	tests := []struct {
+		name          string
+		local, remote plumbing.Hash
+		want          bool
+	}{
+		{"same commit", local, local, false},
+		{"behind", base, local, false},
+		{"ahead", local, base, true},
+		{"diverged", local, ahead, true},
+		{"not in the clone", missing, local, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasDiverged(repo, tt.local, tt.remote); got != tt.want {
+				t.Errorf("HasDiverged() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushRejectedError(t *testing.T) {
+	cause := errors.New("rejected")
+	var err error = &PushRejectedError{Err: cause}
+	if !errors.Is(err, ErrPushRejected) {
+		t.Error("PushRejectedError doesn't match ErrPushRejected")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("PushRejectedError doesn't match the push error")
+	}
+}
@@ -0,0 +1,134 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Problem is something wrong with a page found by Lint.
+type Problem struct {
+	// Line is the line number, starting at 1.
+	Line    int
+	Message string
+}
+
+// table is a run of lines containing pipes, starting with its header.
+type table struct {
+	start, end int
+}
+
+// tables returns the tables among lines.
+func tables(lines []string) []table {
+	var found []table
+	for i := 0; i < len(lines); i++ {
+		if !strings.Contains(lines[i], "|") {
+			continue
+		}
+		t := table{start: i}
+		for i < len(lines) && strings.Contains(lines[i], "|") {
+			i++
+		}
+		t.end = i
+		found = append(found, t)
+	}
+	return found
+}
+
+// isSeparator reports whether line is the line under a table's header.
+func isSeparator(line string) bool {
+	return strings.Trim(line, "|-: ") == ""
+}
+
+// rowStatus returns the status cell of a streamer's row, without an outer
+// pipe, and whether the row has one.
+func rowStatus(line string) (string, bool) {
+	before := strings.TrimSpace(line[:strings.Index(line, "| `")])
+	outer := strings.HasPrefix(before, "|")
+	return strings.TrimSpace(strings.TrimPrefix(before, "|")), outer
+}
+
+// Lint finds malformed rows, duplicate streamers, rows out of order and
+// status cells not written in style in text.
+func Lint(text string, style Style) []Problem {
+	lines := strings.Split(text, "\n")
+	var problems []Problem
+	seen := map[string]int{}
+	for _, t := range tables(lines) {
+		headings, _ := splitCells(lines[t.start])
+		previous := ""
+		for i := t.start + 1; i < t.end; i++ {
+			line := lines[i]
+			if i == t.start+1 && isSeparator(line) {
+				continue
+			}
+			name := RowLogin(line)
+			if name == "" {
+				problems = append(problems, Problem{i + 1, "malformed row, no name in backticks"})
+				continue
+			}
+			if cells, _ := splitCells(line); len(cells) != len(headings) {
+				problems = append(problems, Problem{i + 1, fmt.Sprintf("%s's row has %d cells, the header has %d", name, len(cells), len(headings))})
+			}
+			if status, _ := rowStatus(line); status != style.Online && status != style.Offline {
+				problems = append(problems, Problem{i + 1, fmt.Sprintf("%s's status is %q rather than %q or %q", name, status, style.Online, style.Offline)})
+			}
+			key := strings.ToLower(name)
+			if first, ok := seen[key]; ok {
+				problems = append(problems, Problem{i + 1, fmt.Sprintf("duplicate row for %s, first on line %d", name, first)})
+			} else {
+				seen[key] = i + 1
+			}
+			if previous != "" && strings.ToLower(previous) > key {
+				problems = append(problems, Problem{i + 1, fmt.Sprintf("%s is out of order, after %s", name, previous)})
+			}
+			previous = name
+		}
+	}
+	return problems
+}
+
+// Format rewrites text in canonical form: each row's status cell is written
+// in style, duplicate rows after the first are removed, and each table's rows
+// are sorted by name ignoring case. Malformed rows are left at the end of
+// their table for a person to fix.
+func Format(text string, style Style) string {
+	lines := strings.Split(text, "\n")
+	seen := map[string]bool{}
+	var out []string
+	last := 0
+	for _, t := range tables(lines) {
+		out = append(out, lines[last:t.start+1]...)
+		last = t.end
+		var rows, malformed []string
+		for i := t.start + 1; i < t.end; i++ {
+			line := lines[i]
+			if i == t.start+1 && isSeparator(line) {
+				out = append(out, line)
+				continue
+			}
+			name := RowLogin(line)
+			if name == "" {
+				malformed = append(malformed, line)
+				continue
+			}
+			if seen[strings.ToLower(name)] {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+			status, outer := rowStatus(line)
+			before := style.Status(strings.Contains(status, Online))
+			if outer {
+				before = "| " + before
+			}
+			rows = append(rows, before+" "+line[strings.Index(line, "| `"):])
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			return strings.ToLower(RowLogin(rows[i])) < strings.ToLower(RowLogin(rows[j]))
+		})
+		out = append(out, rows...)
+		out = append(out, malformed...)
+	}
+	out = append(out, lines[last:]...)
+	return strings.Join(out, "\n")
+}
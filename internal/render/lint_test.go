@@ -0,0 +1,65 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	header := "Status | Twitch Username | Links\n--- | --- | ---\n"
+	tests := []struct {
+		name  string
+		text  string
+		style Style
+		want  []Problem
+	}{
+		{
+			name:  "clean",
+			text:  header + "🟢 | `alice` | x\n&nbsp; | `bob` | x\n",
+			style: Styles["emoji"],
+		},
+		{
+			name:  "malformed row",
+			text:  header + "🟢 | alice | x\n",
+			style: Styles["emoji"],
+			want:  []Problem{{3, "malformed row, no name in backticks"}},
+		},
+		{
+			name:  "wrong number of cells",
+			text:  header + "🟢 | `alice` | x | y\n",
+			style: Styles["emoji"],
+			want:  []Problem{{3, "alice's row has 4 cells, the header has 3"}},
+		},
+		{
+			name:  "status in another style",
+			text:  header + "offline | `alice` | x\n",
+			style: Styles["emoji"],
+			want:  []Problem{{3, `alice's status is "offline" rather than "🟢" or "&nbsp;"`}},
+		},
+		{
+			name:  "status in the text style",
+			text:  header + "🟢 LIVE | `alice` | x\noffline | `bob` | x\n",
+			style: Styles["text"],
+		},
+		{
+			name:  "duplicate ignoring case",
+			text:  header + "🟢 | `alice` | x\n&nbsp; | `Alice` | x\n",
+			style: Styles["emoji"],
+			want:  []Problem{{4, "duplicate row for Alice, first on line 3"}},
+		},
+		{
+			name:  "out of order",
+			text:  header + "🟢 | `bob` | x\n&nbsp; | `alice` | x\n",
+			style: Styles["emoji"],
+			want:  []Problem{{4, "alice is out of order, after bob"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lint(tt.text, tt.style)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
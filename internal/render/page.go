@@ -0,0 +1,221 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultTemplates are the page layouts used when no override is given, one
+// per page: index.md.tmpl and inactive.md.tmpl.
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// The markers around the region of a page laid out from its rows. Everything
+// outside them is kept as it is.
+const (
+	BeginMarker = "<!-- streamstatus:begin -->"
+	EndMarker   = "<!-- streamstatus:end -->"
+	// FooterMarker starts the line SetFooter maintains.
+	FooterMarker = "<!-- streamstatus:footer -->"
+)
+
+// Row is a streamer's row in a page.
+type Row struct {
+	// Status is the status cell as written, Online or Offline.
+	Status string
+	Online bool
+	// Name is the name in backticks, the login or display name.
+	Name string
+	// Columns are the cells after the name, such as the channel links.
+	Columns string
+}
+
+// Page is what a page template is executed with.
+type Page struct {
+	// Headings are the headings of the page's table of streamers, Header the
+	// line they're written on and Separator the line under it.
+	Headings  []string
+	Header    string
+	Separator string
+	// Streamers are the rows in the order they were on the page, and Online
+	// and Offline the same rows split by status.
+	Streamers []Row
+	Online    []Row
+	Offline   []Row
+}
+
+// DefaultHeadings are the headings of the table of streamers on a page that
+// doesn't have one yet.
+var DefaultHeadings = []string{"Status", "Twitch Username", "Links"}
+
+// Headings returns the headings of the first table of streamers in text, so
+// columns added to it are kept when the page is laid out, or DefaultHeadings
+// if it has none.
+func Headings(text string) []string {
+	lines := strings.Split(text, "\n")
+	for _, t := range tables(lines) {
+		for i := t.start + 1; i < t.end; i++ {
+			if RowLogin(lines[i]) != "" {
+				headings, _ := splitCells(lines[t.start])
+				return headings
+			}
+		}
+	}
+	return DefaultHeadings
+}
+
+// ParseRows returns the streamers' rows in text in order.
+func ParseRows(text string) []Row {
+	var rows []Row
+	for _, line := range strings.Split(text, "\n") {
+		name := RowLogin(line)
+		if name == "" {
+			continue
+		}
+		status, outer := rowStatus(line)
+		columns := strings.TrimSpace(line[strings.Index(line, "| `")+len("| `"+name+"`"):])
+		columns = strings.TrimPrefix(columns, "|")
+		if outer {
+			columns = strings.TrimSuffix(columns, "|")
+		}
+		rows = append(rows, Row{
+			Status:  status,
+			Online:  strings.Contains(status, Online),
+			Name:    name,
+			Columns: strings.TrimSpace(columns),
+		})
+	}
+	return rows
+}
+
+// Templates lay out whole pages from their rows.
+type Templates struct {
+	pages map[string]*template.Template
+}
+
+// LoadTemplates parses the built-in page templates, replacing those with a
+// file of the same name in dir, if dir is set.
+func LoadTemplates(dir string) (*Templates, error) {
+	entries, err := defaultTemplates.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{pages: map[string]*template.Template{}}
+	for _, entry := range entries {
+		text, err := defaultTemplates.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			override, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+			if err == nil {
+				text = override
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		page := strings.TrimSuffix(entry.Name(), ".tmpl")
+		t.pages[page], err = template.New(entry.Name()).Parse(string(text))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Render lays out the page, index.md or inactive.md, with rows in a table
+// with headings.
+func (t *Templates) Render(page string, headings []string, rows []Row) (string, error) {
+	separator := make([]string, len(headings))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	data := Page{
+		Headings:  headings,
+		Header:    joinCells(headings, false),
+		Separator: joinCells(separator, false),
+		Streamers: rows,
+	}
+	for _, row := range rows {
+		if row.Online {
+			data.Online = append(data.Online, row)
+		} else {
+			data.Offline = append(data.Offline, row)
+		}
+	}
+	tmpl, ok := t.pages[page]
+	if !ok {
+		return "", fmt.Errorf("no template for %s", page)
+	}
+	var b bytes.Buffer
+	err := tmpl.Execute(&b, data)
+	return b.String(), err
+}
+
+// region returns the start and end of the text between the markers in text,
+// and false if it doesn't have both.
+func region(text string) (int, int, bool) {
+	begin := strings.Index(text, BeginMarker)
+	if begin < 0 {
+		return 0, 0, false
+	}
+	begin += len(BeginMarker)
+	end := strings.Index(text[begin:], EndMarker)
+	if end < 0 {
+		return 0, 0, false
+	}
+	return begin, begin + end, true
+}
+
+// ErrNoRegion is returned by Splice for a page without the markers.
+var ErrNoRegion = errors.New("page has no " + BeginMarker + " and " + EndMarker + " markers")
+
+// Managed returns the part of text laid out from its rows: the text between
+// the markers, or all of it without them.
+func Managed(text string) string {
+	begin, end, ok := region(text)
+	if !ok {
+		return text
+	}
+	return text[begin:end]
+}
+
+// Splice puts the page rendered from text's rows back into text, replacing
+// only the text between the markers by the text between the markers in
+// rendered, or all of it without them. Everything outside the markers is kept
+// as it is. Without the markers, text is returned unchanged with ErrNoRegion,
+// as there's no telling what's safe to replace.
+func Splice(text, rendered string) (string, error) {
+	begin, end, ok := region(text)
+	if !ok {
+		return text, ErrNoRegion
+	}
+	if b, e, ok := region(rendered); ok {
+		rendered = rendered[b:e]
+	} else {
+		rendered = "\n" + strings.TrimSuffix(rendered, "\n") + "\n"
+	}
+	return text[:begin] + rendered + text[end:], nil
+}
+
+// SetFooter replaces the line in text starting with FooterMarker with footer,
+// or adds it at the end of text if there's none.
+func SetFooter(text, footer string) string {
+	line := FooterMarker + " " + strings.Join(strings.Fields(footer), " ")
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), FooterMarker) {
+			lines[i] = line
+			return strings.Join(lines, "\n")
+		}
+	}
+	return strings.TrimRight(text, "\n") + "\n\n" + line + "\n"
+}
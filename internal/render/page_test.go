@@ -0,0 +1,54 @@
+package render
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSplice(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		rendered string
+		want     string
+		err      error
+	}{
+		{
+			name:     "replaces the region",
+			text:     "---\ntitle: Streamers\n---\n# Streamers\n\n<!-- streamstatus:begin -->\nold\n<!-- streamstatus:end -->\n\n## About\n",
+			rendered: "# Template\n<!-- streamstatus:begin -->\nnew\n<!-- streamstatus:end -->\n",
+			want:     "---\ntitle: Streamers\n---\n# Streamers\n\n<!-- streamstatus:begin -->\nnew\n<!-- streamstatus:end -->\n\n## About\n",
+		},
+		{
+			name:     "fills the region with a template without markers",
+			text:     "intro\n<!-- streamstatus:begin -->\nold\n<!-- streamstatus:end -->\noutro",
+			rendered: "new\n",
+			want:     "intro\n<!-- streamstatus:begin -->\nnew\n<!-- streamstatus:end -->\noutro",
+		},
+		{
+			name:     "leaves a page without markers alone",
+			text:     "---\ntitle: Streamers\n---\nStatus | Twitch Username\n",
+			rendered: "<!-- streamstatus:begin -->\nnew\n<!-- streamstatus:end -->\n",
+			want:     "---\ntitle: Streamers\n---\nStatus | Twitch Username\n",
+			err:      ErrNoRegion,
+		},
+		{
+			name:     "leaves a page with only a begin marker alone",
+			text:     "<!-- streamstatus:begin -->\nold\n",
+			rendered: "new\n",
+			want:     "<!-- streamstatus:begin -->\nold\n",
+			err:      ErrNoRegion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Splice(tt.text, tt.rendered)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Splice() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
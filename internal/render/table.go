@@ -0,0 +1,264 @@
+// Package render edits the markdown tables of streamers in index.md and the
+// inactive page. Each streamer has a row with their status, online or
+// offline, followed by their name in backticks:
+//
+//	🟢 | `Streamer` | [...](https://www.twitch.tv/streamer)
+//
+// The functions take and return the whole page, so they don't need a clone
+// of the repository to be tested or reused.
+package render
+
+import (
+	"strings"
+)
+
+const (
+	// Online is the status of a streamer who's live.
+	Online = "🟢"
+	// Offline is the status of a streamer who isn't.
+	Offline = "&nbsp;"
+)
+
+// Style is how a row's status is written. Rows are online when their status
+// has the Online emoji in it, whatever the style.
+type Style struct {
+	Online  string
+	Offline string
+}
+
+// Styles are the status styles by name: the emoji alone, the emoji with text
+// screen readers can read out, or HTML labelling the status for them.
+var Styles = map[string]Style{
+	"emoji": {Online, Offline},
+	"text":  {Online + " LIVE", "offline"},
+	"aria": {
+		`<span role="img" aria-label="live">` + Online + `</span>`,
+		`<span role="img" aria-label="offline">` + Offline + `</span>`,
+	},
+}
+
+// Status returns the status written for a streamer who's online or not.
+func (st Style) Status(online bool) string {
+	if online {
+		return st.Online
+	}
+	return st.Offline
+}
+
+// RowIndex returns the index of the streamer's row among lines, matching the
+// login case-insensitively, or -1 if there is none.
+func RowIndex(lines []string, login string) int {
+	needle := "| `" + strings.ToLower(login) + "` |"
+	for i, line := range lines {
+		if strings.Contains(strings.ToLower(line), needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+// RowOnline reports whether the streamer's row in text shows them live, and
+// whether there is a row.
+func RowOnline(text, login string) (bool, bool) {
+	lines := strings.Split(text, "\n")
+	i := RowIndex(lines, login)
+	if i < 0 {
+		return false, false
+	}
+	row := lines[i]
+	return strings.Contains(row[:strings.Index(row, "| `")], Online), true
+}
+
+// HasRow reports whether text has a row for the streamer.
+func HasRow(text, login string) bool {
+	return RowIndex(strings.Split(text, "\n"), login) >= 0
+}
+
+// SetStatus sets the status of the streamer's row in text to online or
+// offline, written in style, and their name in it to streamer if rename is
+// set. The row is found by login, ignoring case, or by streamer for rows
+// written with a display name. It returns the text, whether there is a row
+// and whether the status changed.
+func SetStatus(text, login, streamer string, online, rename bool, style Style) (string, bool, bool) {
+	lines := strings.Split(text, "\n")
+	i := RowIndex(lines, login)
+	if i < 0 {
+		i = RowIndex(lines, streamer)
+	}
+	if i < 0 {
+		return text, false, false
+	}
+	row := lines[i]
+	status, outer := rowStatus(row)
+	if strings.Contains(status, Online) == online {
+		return text, true, false
+	}
+	before := ""
+	if outer {
+		before = row[:strings.Index(row, "|")+1] + " "
+	}
+	rest := row[strings.Index(row, "| `")+len("| `"+RowLogin(row)+"`"):]
+	if !rename {
+		streamer = RowLogin(row)
+	}
+	lines[i] = before + style.Status(online) + " | `" + streamer + "`" + rest
+	return strings.Join(lines, "\n"), true, true
+}
+
+// RemoveRow removes the streamer's row from text, returning the text, the row
+// and whether there was one.
+func RemoveRow(text, login string) (string, string, bool) {
+	lines := strings.Split(text, "\n")
+	i := RowIndex(lines, login)
+	if i < 0 {
+		return text, "", false
+	}
+	row := lines[i]
+	lines = append(lines[:i], lines[i+1:]...)
+	return strings.Join(lines, "\n"), row, true
+}
+
+// AppendRow adds row after the last table row in text, or at the end if text
+// has no table.
+func AppendRow(text, row string) string {
+	lines := strings.Split(text, "\n")
+	last := -1
+	for i, line := range lines {
+		if strings.Contains(line, "|") {
+			last = i
+		}
+	}
+	if last < 0 {
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		return text + row + "\n"
+	}
+	lines = append(lines[:last+1], append([]string{row}, lines[last+1:]...)...)
+	return strings.Join(lines, "\n")
+}
+
+// RowLogin returns the login in a streamer's row, or "" if line isn't one.
+func RowLogin(line string) string {
+	start := strings.Index(line, "| `")
+	if start < 0 {
+		return ""
+	}
+	login := line[start+len("| `"):]
+	end := strings.Index(login, "` |")
+	if end < 0 {
+		return ""
+	}
+	return login[:end]
+}
+
+// InsertRow adds the row for login to the first table of streamers in text,
+// before the first row whose name sorts after login ignoring case, or after
+// its last row if none does. Without a table of streamers, the row is added
+// after the last table row.
+func InsertRow(text, login, row string) string {
+	lines := strings.Split(text, "\n")
+	for _, t := range tables(lines) {
+		at, streamers := t.end, false
+		for i := t.start; i < t.end; i++ {
+			other := RowLogin(lines[i])
+			if other == "" {
+				continue
+			}
+			streamers = true
+			if strings.ToLower(other) > strings.ToLower(login) {
+				at = i
+				break
+			}
+		}
+		if !streamers {
+			continue
+		}
+		lines = append(lines[:at], append([]string{row}, lines[at:]...)...)
+		return strings.Join(lines, "\n")
+	}
+	return AppendRow(text, row)
+}
+
+// RenameRow rewrites the streamer's row in text with the new display name and
+// login, returning the text and whether there was a row to rewrite.
+func RenameRow(text, oldLogin, login, streamer string) (string, bool) {
+	lines := strings.Split(text, "\n")
+	i := RowIndex(lines, oldLogin)
+	if i < 0 {
+		return text, false
+	}
+	row := lines[i]
+	name := "`" + RowLogin(row) + "`"
+	row = strings.Replace(row, name, "`"+streamer+"`", 1)
+	// Rewrite links to the old channel, whatever their case.
+	link := "twitch.tv/" + strings.ToLower(oldLogin)
+	for {
+		j := strings.Index(strings.ToLower(row), link)
+		if j < 0 {
+			break
+		}
+		row = row[:j] + "twitch.tv/" + login + row[j+len(link):]
+	}
+	lines[i] = row
+	return strings.Join(lines, "\n"), true
+}
+
+// splitCells splits a table line into its trimmed cells, without the optional
+// outer pipes, and reports whether it had them.
+func splitCells(line string) ([]string, bool) {
+	trimmed := strings.TrimSpace(line)
+	outer := strings.HasPrefix(trimmed, "|")
+	if outer {
+		trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "|"), "|")
+	}
+	cells := strings.Split(trimmed, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells, outer
+}
+
+// joinCells joins cells into a table line, with outer pipes if outer is set.
+func joinCells(cells []string, outer bool) string {
+	line := strings.TrimRight(strings.Join(cells, " | "), " ")
+	if outer {
+		line = "| " + line + " |"
+	}
+	return line
+}
+
+// SetCell sets the cell in the column with the heading in the streamer's row,
+// returning the text and whether the row's table has the column.
+func SetCell(text, login, heading, value string) (string, bool) {
+	lines := strings.Split(text, "\n")
+	i := RowIndex(lines, login)
+	if i < 0 {
+		return text, false
+	}
+	// The header is the first line of the table the row is in.
+	header := i
+	for header > 0 && strings.Contains(lines[header-1], "|") {
+		header--
+	}
+	headings, _ := splitCells(lines[header])
+	column := -1
+	for j, h := range headings {
+		if strings.EqualFold(h, heading) {
+			column = j
+		}
+	}
+	if column < 0 {
+		return text, false
+	}
+	cells, outer := splitCells(lines[i])
+	for len(cells) <= column {
+		cells = append(cells, "")
+	}
+	if cells[column] == value {
+		return text, true
+	}
+	cells[column] = value
+	lines[i] = joinCells(cells, outer)
+	return strings.Join(lines, "\n"), true
+}
@@ -0,0 +1,145 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPage = `# Streamers
+
+Status | Twitch Username | Links | Last live
+--- | --- | --- | ---
+🟢 | ` + "`Alice`" + ` | [t](https://www.twitch.tv/alice) | now
+&nbsp; | ` + "`carol`" + ` | [t](https://www.twitch.tv/carol) | 2 days ago
+`
+
+func TestSetCell(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		login   string
+		heading string
+		value   string
+		want    string
+		found   bool
+	}{
+		{
+			name:    "sets the cell",
+			text:    testPage,
+			login:   "carol",
+			heading: "Last live",
+			value:   "1 hour ago",
+			want:    "&nbsp; | `carol` | [t](https://www.twitch.tv/carol) | 1 hour ago",
+			found:   true,
+		},
+		{
+			name:    "matches login and heading ignoring case",
+			text:    testPage,
+			login:   "ALICE",
+			heading: "last LIVE",
+			value:   "5 minutes ago",
+			want:    "🟢 | `Alice` | [t](https://www.twitch.tv/alice) | 5 minutes ago",
+			found:   true,
+		},
+		{
+			name:    "pads short rows",
+			text:    "Status | Twitch Username | Links | Avatar\n--- | --- | --- | ---\n🟢 | `alice` | [t](x)\n",
+			login:   "alice",
+			heading: "Avatar",
+			value:   "![](a.png)",
+			want:    "🟢 | `alice` | [t](x) | ![](a.png)",
+			found:   true,
+		},
+		{
+			name:    "keeps outer pipes",
+			text:    "| Status | Twitch Username | Avatar |\n|---|---|---|\n| 🟢 | `alice` | |\n",
+			login:   "alice",
+			heading: "Avatar",
+			value:   "![](a.png)",
+			want:    "| 🟢 | `alice` | ![](a.png) |",
+			found:   true,
+		},
+		{
+			name:    "no such column",
+			text:    testPage,
+			login:   "alice",
+			heading: "Next stream",
+			value:   "tomorrow",
+			found:   false,
+		},
+		{
+			name:    "no such row",
+			text:    testPage,
+			login:   "bob",
+			heading: "Last live",
+			value:   "now",
+			found:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, found := SetCell(tt.text, tt.login, tt.heading, tt.value)
+			if found != tt.found {
+				t.Fatalf("found = %t, want %t", found, tt.found)
+			}
+			if !found {
+				if text != tt.text {
+					t.Errorf("text changed without a cell to set:\n%s", text)
+				}
+				return
+			}
+			lines := strings.Split(text, "\n")
+			if got := lines[RowIndex(lines, tt.login)]; got != tt.want {
+				t.Errorf("row = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertRow(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		login string
+		want  string
+	}{
+		{
+			name:  "between rows",
+			text:  "A | B\n--- | ---\nx | `alice` |\nx | `carol` |\n",
+			login: "Bob",
+			want:  "A | B\n--- | ---\nx | `alice` |\nx | `Bob` |\nx | `carol` |\n",
+		},
+		{
+			name:  "before the first row",
+			text:  "A | B\n--- | ---\nx | `bob` |\n",
+			login: "alice",
+			want:  "A | B\n--- | ---\nx | `alice` |\nx | `bob` |\n",
+		},
+		{
+			name:  "after the last row",
+			text:  "A | B\n--- | ---\nx | `alice` |\n\nAfter the table.\n",
+			login: "zed",
+			want:  "A | B\n--- | ---\nx | `alice` |\nx | `zed` |\n\nAfter the table.\n",
+		},
+		{
+			name:  "first table of streamers",
+			text:  "Key | Value\n--- | ---\na | b\n\nA | B\n--- | ---\nx | `alice` |\n\nA | B\n--- | ---\nx | `aaron` |\n",
+			login: "bob",
+			want:  "Key | Value\n--- | ---\na | b\n\nA | B\n--- | ---\nx | `alice` |\nx | `bob` |\n\nA | B\n--- | ---\nx | `aaron` |\n",
+		},
+		{
+			name:  "no table",
+			text:  "# Streamers\n",
+			login: "alice",
+			want:  "# Streamers\nx | `alice` |\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InsertRow(tt.text, tt.login, "x | `"+tt.login+"` |")
+			if got != tt.want {
+				t.Errorf("InsertRow() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
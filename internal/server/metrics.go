@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// registered are the counters and gauges served at /metrics, in order.
+var registered []*Counter
+
+// labelSeparator joins a count's label values into its key.
+const labelSeparator = "\x00"
+
+// Counter is a Prometheus counter with labels, or a gauge when kind is
+// "gauge".
+type Counter struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+// CounterValue is the count for one set of label values.
+type CounterValue struct {
+	Labels []string
+	Count  int64
+}
+
+// NewCounter registers a counter to be served at /metrics.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, kind: "counter", labels: labels, values: map[string]int64{}}
+	registered = append(registered, c)
+	return c
+}
+
+// NewGauge registers a gauge to be served at /metrics, whose values are set
+// rather than added to.
+func NewGauge(name, help string, labels ...string) *Counter {
+	c := NewCounter(name, help, labels...)
+	c.kind = "gauge"
+	return c
+}
+
+// Set sets the gauge's value for the label values, given in the order of its
+// labels.
+func (c *Counter) Set(value int64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(values, labelSeparator)] = value
+}
+
+// Inc adds one to the count for the label values, given in the order of the
+// counter's labels.
+func (c *Counter) Inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(values, labelSeparator)]++
+}
+
+// Snapshot returns the counts, sorted by their label values.
+func (c *Counter) Snapshot() []CounterValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	counts := make([]CounterValue, 0, len(keys))
+	for _, k := range keys {
+		counts = append(counts, CounterValue{Labels: strings.Split(k, labelSeparator), Count: c.values[k]})
+	}
+	return counts
+}
+
+// write writes the counter in the Prometheus text format.
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.kind)
+	for _, v := range c.Snapshot() {
+		if len(c.labels) == 0 {
+			fmt.Fprintf(w, "%s %d\n", c.name, v.Count)
+			continue
+		}
+		pairs := make([]string, len(c.labels))
+		for i, label := range c.labels {
+			pairs[i] = fmt.Sprintf("%s=%q", label, v.Labels[i])
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", c.name, strings.Join(pairs, ","), v.Count)
+	}
+}
+
+// ServeMetrics writes every registered counter and gauge.
+func ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, c := range registered {
+		c.write(w)
+	}
+}
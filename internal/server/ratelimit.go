@@ -0,0 +1,109 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// idleBucketExpiry is how long a client's bucket is kept after its last
+// request. A bucket idle this long has refilled anyway.
+const idleBucketExpiry = 10 * time.Minute
+
+// tokenBucket allows bursts of up to burst requests, refilled at rate
+// requests a second.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket for the time since it was last used and takes a
+// token from it if there's one left.
+func (b *tokenBucket) take(now time.Time, rate, burst float64) bool {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimiter limits webhook requests across all clients and from each
+// client IP, so a flood of bogus requests is refused before their signatures
+// are checked.
+type RateLimiter struct {
+	mu      sync.Mutex
+	global  *tokenBucket
+	rate    float64
+	burst   float64
+	clients map[string]*tokenBucket
+	ipRate  float64
+	ipBurst float64
+	pruned  time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests a second across
+// all clients and ipRate from each client IP, in bursts of up to burst and
+// ipBurst, or nil if neither limit is set. A limit of 0 is no limit, and a
+// burst of 0 defaults to the limit.
+func NewRateLimiter(rate, burst, ipRate, ipBurst float64) *RateLimiter {
+	if rate == 0 && ipRate == 0 {
+		return nil
+	}
+	l := &RateLimiter{
+		rate:    rate,
+		burst:   burst,
+		clients: map[string]*tokenBucket{},
+		ipRate:  ipRate,
+		ipBurst: ipBurst,
+		pruned:  time.Now(),
+	}
+	if l.burst == 0 {
+		l.burst = l.rate
+	}
+	if l.ipBurst == 0 {
+		l.ipBurst = l.ipRate
+	}
+	if l.rate > 0 {
+		l.global = &tokenBucket{tokens: l.burst, last: time.Now()}
+	}
+	return l
+}
+
+// Allow reports whether a request from the client IP is within the limits.
+// A request refused by the client's limit doesn't count towards the global
+// one.
+func (l *RateLimiter) Allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.ipRate > 0 {
+		l.prune(now)
+		b, ok := l.clients[ip]
+		if !ok {
+			b = &tokenBucket{tokens: l.ipBurst, last: now}
+			l.clients[ip] = b
+		}
+		if !b.take(now, l.ipRate, l.ipBurst) {
+			return false
+		}
+	}
+	return l.global == nil || l.global.take(now, l.rate, l.burst)
+}
+
+// prune forgets the buckets of clients that have been idle for a while, at
+// most once per idleBucketExpiry.
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < idleBucketExpiry {
+		return
+	}
+	l.pruned = now
+	for ip, b := range l.clients {
+		if now.Sub(b.last) >= idleBucketExpiry {
+			delete(l.clients, ip)
+		}
+	}
+}
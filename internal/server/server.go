@@ -0,0 +1,70 @@
+// Package server holds the HTTP plumbing shared by the webhook, admin and
+// API handlers: JSON error responses, rate limiting, recovering from panics
+// and the counters served at /metrics.
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/getsentry/sentry-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorResponse is the JSON body returned when a request is rejected.
+type ErrorResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// WriteError writes a JSON error response with the given status code.
+func WriteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Status: status, Error: message})
+}
+
+// ClientIP returns the IP address the request came from.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// panicsRecovered counts the panics recovered by where they happened.
+var panicsRecovered = NewCounter("streamstatus_panics_recovered_total", "Panics recovered in handlers and workers.", "where")
+
+// ReportPanic logs the stack of a recovered panic, counts it and sends it to
+// Sentry through hub.
+func ReportPanic(hub *sentry.Hub, where string, p interface{}) {
+	log.Errorf("panic in %s: %v\n%s", where, p, debug.Stack())
+	panicsRecovered.Inc(where)
+	hub.Recover(p)
+}
+
+// RecoverHandler wraps h so a panic while handling a request is reported and
+// answered with a 500 instead of dropping the connection.
+func RecoverHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			hub := sentry.GetHubFromContext(r.Context())
+			if hub == nil {
+				hub = sentry.CurrentHub()
+			}
+			ReportPanic(hub, "http", p)
+			WriteError(w, http.StatusInternalServerError, "internal server error")
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
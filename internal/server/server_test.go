@@ -0,0 +1,73 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name                         string
+		rate, burst, ipRate, ipBurst float64
+		ips                          []string
+		want                         []bool
+	}{
+		{"ip burst", 0, 0, 1, 2, []string{"a", "a", "a", "b"}, []bool{true, true, false, true}},
+		{"global burst", 1, 2, 0, 0, []string{"a", "b", "c"}, []bool{true, true, false}},
+		{"ip limit first", 1, 2, 1, 1, []string{"a", "a", "b", "c"}, []bool{true, false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.rate, tt.burst, tt.ipRate, tt.ipBurst)
+			for i, ip := range tt.ips {
+				if got := l.Allow(ip); got != tt.want[i] {
+					t.Errorf("request %d from %s: Allow() = %t, want %t", i, ip, got, tt.want[i])
+				}
+			}
+		})
+	}
+	if l := NewRateLimiter(0, 5, 0, 5); l != nil {
+		t.Errorf("NewRateLimiter() without limits = %v, want nil", l)
+	}
+}
+
+func TestCounterWrite(t *testing.T) {
+	c := &Counter{name: "test_total", help: "Test.", kind: "counter", labels: []string{"type"}, values: map[string]int64{}}
+	c.Inc("b")
+	c.Inc("a")
+	c.Inc("b")
+	var buf bytes.Buffer
+	c.write(&buf)
+	want := "# HELP test_total Test.\n# TYPE test_total counter\ntest_total{type=\"a\"} 1\ntest_total{type=\"b\"} 2\n"
+	if buf.String() != want {
+		t.Errorf("write() = %q, want %q", buf.String(), want)
+	}
+
+	g := &Counter{name: "test_gauge", help: "Test.", kind: "gauge", values: map[string]int64{}}
+	g.Set(3)
+	g.Set(5)
+	buf.Reset()
+	g.write(&buf)
+	want = "# HELP test_gauge Test.\n# TYPE test_gauge gauge\ntest_gauge 5\n"
+	if buf.String() != want {
+		t.Errorf("write() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	h := RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Status != http.StatusInternalServerError {
+		t.Errorf("body = %+v, %v, want a JSON error", resp, err)
+	}
+}
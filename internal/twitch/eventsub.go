@@ -0,0 +1,132 @@
+// Package twitch verifies and decodes the EventSub notifications Twitch
+// delivers to the webhook, and describes the subscriptions each streamer
+// needs. It doesn't call the Helix API, so it can be tested and reused
+// without credentials.
+package twitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/nicklaw5/helix"
+)
+
+// The message types Twitch sends in the Twitch-Eventsub-Message-Type header.
+const (
+	MessageTypeNotification = "notification"
+	MessageTypeRevocation   = "revocation"
+	MessageTypeVerification = "webhook_callback_verification"
+)
+
+// Notification is the body of an EventSub webhook request. Challenge is only
+// set when Twitch verifies the callback, and Event is left encoded until its
+// type is known.
+type Notification struct {
+	Challenge    string                     `json:"challenge"`
+	Event        json.RawMessage            `json:"event"`
+	Subscription helix.EventSubSubscription `json:"subscription"`
+}
+
+// Verify reports whether the request with the header and body is signed with
+// any of the secrets. Empty secrets are skipped, so a secondary secret only
+// counts while one is being rotated in.
+func Verify(header http.Header, body string, secrets ...string) bool {
+	for _, secret := range secrets {
+		if secret != "" && helix.VerifyEventSubNotification(secret, header, body) {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamEvent is a stream.online or stream.offline event, reduced to the
+// broadcaster and whether they went live. Type is the kind of stream that
+// went live, such as live or rerun.
+type StreamEvent struct {
+	Online    bool
+	Type      string
+	UserID    string
+	UserLogin string
+	UserName  string
+}
+
+// DecodeStreamEvent decodes the event of a stream.online or stream.offline
+// notification.
+func DecodeStreamEvent(n Notification) (StreamEvent, error) {
+	switch n.Subscription.Type {
+	case "stream.online":
+		var e helix.EventSubStreamOnlineEvent
+		err := json.Unmarshal(n.Event, &e)
+		if err != nil {
+			return StreamEvent{}, err
+		}
+		return StreamEvent{
+			Online:    true,
+			Type:      e.Type,
+			UserID:    e.BroadcasterUserID,
+			UserLogin: e.BroadcasterUserLogin,
+			UserName:  e.BroadcasterUserName,
+		}, nil
+	case "stream.offline":
+		var e helix.EventSubStreamOfflineEvent
+		err := json.Unmarshal(n.Event, &e)
+		if err != nil {
+			return StreamEvent{}, err
+		}
+		return StreamEvent{
+			UserID:    e.BroadcasterUserID,
+			UserLogin: e.BroadcasterUserLogin,
+			UserName:  e.BroadcasterUserName,
+		}, nil
+	}
+	return StreamEvent{}, fmt.Errorf("%s is not a stream event", n.Subscription.Type)
+}
+
+// StreamerEventTypes are the EventSub subscription types each streamer is
+// subscribed to: their status changes, and updates to their names, to follow
+// renames, and to their channel, to follow schedule changes.
+var StreamerEventTypes = []string{"stream.online", "stream.offline", "user.update", "channel.update"}
+
+// IsStreamerEvent reports whether the subscription type is one of
+// StreamerEventTypes.
+func IsStreamerEvent(eventType string) bool {
+	for _, t := range StreamerEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// EventCondition returns the condition of a subscription to the event type
+// for the streamer with the user ID.
+func EventCondition(eventType, userID string) helix.EventSubCondition {
+	if eventType == "user.update" {
+		return helix.EventSubCondition{UserID: userID}
+	}
+	return helix.EventSubCondition{BroadcasterUserID: userID}
+}
+
+// EventVersion returns the version of the event type subscribed to.
+func EventVersion(eventType string) string {
+	if eventType == "channel.update" {
+		return "2"
+	}
+	return "1"
+}
+
+// SubscriptionUserID returns the user ID of the streamer a subscription is
+// for, whichever condition it has.
+func SubscriptionUserID(s helix.EventSubSubscription) string {
+	if s.Condition.UserID != "" {
+		return s.Condition.UserID
+	}
+	return s.Condition.BroadcasterUserID
+}
+
+// IsActive reports whether the subscription is enabled or waiting for its
+// callback to be verified, rather than having failed.
+func IsActive(s helix.EventSubSubscription) bool {
+	return s.Status == "enabled" || s.Status == "webhook_callback_verification_pending"
+}
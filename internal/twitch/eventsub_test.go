@@ -0,0 +1,91 @@
+package twitch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// signedHeader returns the EventSub headers signing body with secret.
+func signedHeader(secret, body string) http.Header {
+	id := "e76c6bd4-55c9-4987-8304-da1588d8988b"
+	timestamp := "2021-07-24T08:09:34.816454134Z"
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + timestamp + body))
+	header := http.Header{}
+	header.Set("Twitch-Eventsub-Message-Id", id)
+	header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+	header.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	const body = `{"subscription": {"type": "stream.online"}}`
+	tests := []struct {
+		name    string
+		signer  string
+		secrets []string
+		want    bool
+	}{
+		{"secret", "secret", []string{"secret", ""}, true},
+		{"secondary secret", "old", []string{"secret", "old"}, true},
+		{"wrong secret", "wrong", []string{"secret", "old"}, false},
+		{"empty secret", "", []string{"secret", ""}, false},
+		{"no secrets", "secret", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(signedHeader(tt.signer, body), body, tt.secrets...); got != tt.want {
+				t.Errorf("Verify() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeStreamEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    StreamEvent
+		wantErr bool
+	}{
+		{
+			name: "online",
+			body: `{"subscription": {"type": "stream.online"}, "event": {"broadcaster_user_id": "1", "broadcaster_user_login": "alice", "broadcaster_user_name": "Alice", "type": "rerun"}}`,
+			want: StreamEvent{Online: true, Type: "rerun", UserID: "1", UserLogin: "alice", UserName: "Alice"},
+		},
+		{
+			name: "offline",
+			body: `{"subscription": {"type": "stream.offline"}, "event": {"broadcaster_user_id": "1", "broadcaster_user_login": "alice", "broadcaster_user_name": "Alice"}}`,
+			want: StreamEvent{UserID: "1", UserLogin: "alice", UserName: "Alice"},
+		},
+		{
+			name:    "malformed event",
+			body:    `{"subscription": {"type": "stream.online"}, "event": "live"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not a stream event",
+			body:    `{"subscription": {"type": "channel.update"}, "event": {}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n Notification
+			if err := json.Unmarshal([]byte(tt.body), &n); err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeStreamEvent(n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeStreamEvent() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DecodeStreamEvent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package twitch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ThumbnailURL fills in the size placeholders of a Helix stream thumbnail URL.
+func ThumbnailURL(url string, width, height int) string {
+	url = strings.Replace(url, "{width}", fmt.Sprint(width), 1)
+	return strings.Replace(url, "{height}", fmt.Sprint(height), 1)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamersNotFound counts the status changes that couldn't be applied as
+// the streamer has no row, by platform.
+var streamersNotFound = server.NewCounter("streamstatus_streamers_not_found_total", "Status changes for streamers without a row in index.md.", "platform")
+
+// githubIssue is the subset of an issue used here.
+type githubIssue struct {
+	Title   string `json:"title"`
+	HTMLURL string `json:"html_url"`
+}
+
+// issueReporter opens a GitHub issue for each streamer whose status changed
+// but who has no row, once per streamer unless one is already open.
+type issueReporter struct {
+	// github makes the API requests, which are authorized like those for
+	// pull requests.
+	github   *githubPulls
+	mu       sync.Mutex
+	reported map[string]bool
+}
+
+// newIssueReporter returns an issue reporter for the configured repo, or nil
+// when issues aren't opened.
+func newIssueReporter(cfg *config, auth transport.AuthMethod) (*issueReporter, error) {
+	if !cfg.NotFoundIssues {
+		return nil, nil
+	}
+	owner, repo, err := repoOwnerAndName(cfg.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	return &issueReporter{
+		github: &githubPulls{
+			apiURL: strings.TrimRight(cfg.GitHubAPIURL, "/"),
+			owner:  owner,
+			repo:   repo,
+			token:  githubToken(cfg, auth),
+		},
+		reported: map[string]bool{},
+	}, nil
+}
+
+// notFoundTitle is the title of the issue for a streamer without a row.
+func notFoundTitle(streamer, page string) string {
+	return fmt.Sprintf("No row for %s in %s", streamer, page)
+}
+
+// reportNotFound opens an issue saying the streamer has no row in page,
+// unless it's already been reported or an issue with the same title is open.
+func (r *issueReporter) reportNotFound(n notification, page string, logger *log.Entry) error {
+	key := strings.ToLower(n.Login)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reported[key] {
+		return nil
+	}
+	title := notFoundTitle(n.Streamer, page)
+	open, err := r.openIssues()
+	if err != nil {
+		return fmt.Errorf("error listing issues: %w", err)
+	}
+	for _, issue := range open {
+		if issue.Title == title {
+			r.reported[key] = true
+			return nil
+		}
+	}
+	header, err := r.github.header()
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("StreamStatus received a status change for `%s` (user ID %s, event %s), but %s has no row for them, so it couldn't be applied.\n\nAdd a row for them, or unsubscribe from their events if they shouldn't be listed.", n.Login, n.UserID, n.EventID, page)
+	var created githubIssue
+	err = postJSONResponse(fmt.Sprintf("%s/repos/%s/%s/issues", r.github.apiURL, r.github.owner, r.github.repo), map[string]string{
+		"title": title,
+		"body":  body,
+	}, header, &created)
+	if err != nil {
+		return fmt.Errorf("error creating issue: %w", err)
+	}
+	r.reported[key] = true
+	logger.Printf("opened issue %s for %s\n", created.HTMLURL, n.Streamer)
+	return nil
+}
+
+// openIssues returns the repository's most recently updated open issues.
+func (r *issueReporter) openIssues() ([]githubIssue, error) {
+	header, err := r.github.header()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("per_page", "100")
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/repos/%s/%s/issues?%s", r.github.apiURL, r.github.owner, r.github.repo, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	var open []githubIssue
+	err = doRequest(req, &open)
+	return open, err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Kick's public API and the endpoint its app access tokens are issued by.
+const (
+	kickAPIURL   = "https://api.kick.com/public/v1"
+	kickTokenURL = "https://id.kick.com/oauth/token"
+)
+
+// kickSource polls the Kick public API for live streams.
+type kickSource struct {
+	clientID     string
+	clientSecret string
+	retry        retryPolicy
+	// token is the app access token, reused until it expires.
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newKickSource returns a source using the configured Kick app credentials,
+// or nil when none are configured.
+func newKickSource(cfg *config, retry retryPolicy) *kickSource {
+	if cfg.KickClientID == "" || cfg.KickClientSecret == "" {
+		return nil
+	}
+	return &kickSource{clientID: cfg.KickClientID, clientSecret: cfg.KickClientSecret, retry: retry}
+}
+
+// platform returns the platform the source polls.
+func (k *kickSource) platform() string {
+	return platformKick
+}
+
+// accessToken returns an app access token, requesting a new one when the
+// last has expired.
+func (k *kickSource) accessToken(logger *log.Entry) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.token != "" && time.Now().Before(k.expires) {
+		return k.token, nil
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {k.clientID},
+		"client_secret": {k.clientSecret},
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err := k.retry.do(logger, "kick token request", func() error {
+		req, err := http.NewRequest(http.MethodPost, kickTokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return doRequest(req, &resp)
+	})
+	if err != nil {
+		return "", err
+	}
+	k.token = resp.AccessToken
+	// Renew a minute early so a token doesn't expire in flight.
+	k.expires = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return k.token, nil
+}
+
+// live reports whether the channel with the slug is live.
+func (k *kickSource) live(channel string, logger *log.Entry) (bool, error) {
+	token, err := k.accessToken(logger)
+	if err != nil {
+		return false, err
+	}
+	var resp struct {
+		Data []struct {
+			Stream struct {
+				IsLive bool `json:"is_live"`
+			} `json:"stream"`
+		} `json:"data"`
+	}
+	err = k.retry.do(logger, "kick channel request", func() error {
+		req, err := http.NewRequest(http.MethodGet, kickAPIURL+"/channels?"+url.Values{"slug": {channel}}.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return doRequest(req, &resp)
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Data) > 0 && resp.Data[0].Stream.IsLive, nil
+}
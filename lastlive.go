@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// lastLiveHeading is the heading of the index.md column how long ago
+// streamers were last live is rendered in.
+const lastLiveHeading = "Last live"
+
+// humanizeSince renders how long ago something that happened d ago was, in
+// the largest whole unit.
+func humanizeSince(d time.Duration) string {
+	day := 24 * time.Hour
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * day},
+		{"month", 30 * day},
+		{"week", 7 * day},
+		{"day", day},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, u := range units {
+		n := int(d / u.size)
+		if n == 1 {
+			return "1 " + u.name + " ago"
+		}
+		if n > 1 {
+			return fmt.Sprintf("%d %ss ago", n, u.name)
+		}
+	}
+	return "just now"
+}
+
+// lastLiveCell renders the last live cell of a streamer who's online or went
+// offline at changedAt.
+func lastLiveCell(online bool, changedAt, now time.Time) string {
+	if online {
+		return "live now"
+	}
+	return humanizeSince(now.Sub(changedAt))
+}
+
+// setLastLive renders in text's last live column how long ago each Twitch
+// streamer in the status store, or among the changes being applied, was
+// live.
+func (q *updateQueue) setLastLive(text string, now time.Time) (string, error) {
+	statuses, err := q.statuses.all()
+	if err != nil {
+		return "", err
+	}
+	for _, st := range statuses {
+		if changePlatform(st.UserID) == platformTwitch {
+			text, _ = render.SetCell(text, st.Login, lastLiveHeading, lastLiveCell(st.Online, st.ChangedAt, now))
+		}
+	}
+	// The changes being applied are only recorded once they are pushed.
+	for _, n := range q.repo.applied {
+		text, _ = render.SetCell(text, n.Login, lastLiveHeading, lastLiveCell(n.Online, now, now))
+	}
+	return text, nil
+}
+
+// updateLastLive commits the last live column rendered afresh, so it doesn't
+// only change along with statuses.
+func (q *updateQueue) updateLastLive() error {
+	repo := q.repo
+	return q.commitTask("last live", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		text, err := q.setLastLive(repo.indexMdText, time.Now())
+		if err != nil {
+			return "", err
+		}
+		if text == repo.indexMdText {
+			return "", &NoChangeNeededError{err: "no change in when streamers were last live"}
+		}
+		repo.indexMdText = text
+		return "🕒 Updated when streamers were last live", repo.writefile(repo.indexMdText)
+	}, repo.indexFilePath)
+}
+
+// runLastLiveUpdates commits the last live column every interval until the
+// queue is done.
+func (q *updateQueue) runLastLiveUpdates(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+		q.scheduleTask("last live", q.updateLastLive)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into each pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// leaseTimeFormat is the MicroTime format the Lease API uses.
+const leaseTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// leaseLock is a leaderLock held through a coordination.k8s.io/v1 Lease, so
+// only the leader among a deployment's replicas takes changes.
+type leaseLock struct {
+	client   *http.Client
+	duration time.Duration
+	id       string
+	// leasesURL is the namespace's leases collection.
+	leasesURL string
+	name      string
+	namespace string
+	token     string
+
+	// mu serialises lock and unlock, which run from the redis queue's loop
+	// and from updates holding the lock, and guards renewed.
+	mu      sync.Mutex
+	renewed time.Time
+}
+
+// lease is the subset of a Lease object used here.
+type lease struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Metadata   leaseMetadata      `json:"metadata"`
+	Spec       leaseSpecification `json:"spec"`
+}
+
+// leaseMetadata is the subset of a Lease's metadata used here.
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// fetchedLease is a Lease as read from the API. It keeps the whole object, so
+// that updating it doesn't drop the metadata and fields not in lease.
+type fetchedLease struct {
+	lease
+	object map[string]interface{}
+}
+
+// leaseSpecification is the spec of a Lease.
+type leaseSpecification struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int64  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int64  `json:"leaseTransitions"`
+}
+
+// newLeaseLock returns a lock on the configured Lease using the pod's service
+// account, or nil when no lease is configured.
+func newLeaseLock(cfg *config) (*leaseLock, error) {
+	if cfg.LeaseName == "" {
+		return nil, nil
+	}
+	duration, err := time.ParseDuration(cfg.LeaseDuration)
+	if err != nil {
+		return nil, err
+	}
+	if duration < time.Second {
+		return nil, fmt.Errorf("lease duration must be at least 1s: %s", duration)
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("kubernetes leases need to run in a pod")
+	}
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s/ca.crt", serviceAccountDir)
+	}
+	namespace := cfg.LeaseNamespace
+	if namespace == "" {
+		data, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	// The pod name is the hostname, which tells operators who leads.
+	id, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return &leaseLock{
+		client: &http.Client{
+			Timeout:   notifyTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		duration: duration,
+		id:       id,
+		leasesURL: fmt.Sprintf("https://%s/apis/coordination.k8s.io/v1/namespaces/%s/leases",
+			net.JoinHostPort(host, port), namespace),
+		name:      cfg.LeaseName,
+		namespace: namespace,
+		token:     strings.TrimSpace(string(token)),
+	}, nil
+}
+
+// url returns the URL of the lease.
+func (l *leaseLock) url() string {
+	return l.leasesURL + "/" + l.name
+}
+
+// request sends a request for the lease, decoding the response into out.
+func (l *leaseLock) request(method, url string, body interface{}, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+l.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return doClientRequest(l.client, req, out)
+}
+
+// lock takes the lease if it is free or expired, or renews it when this pod
+// holds it. It only calls the API once a third of the lease has passed since
+// it was last renewed.
+func (l *leaseLock) lock() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.renewed) < l.duration/3 {
+		return true, nil
+	}
+	current, err := l.get()
+	if hasStatus(err, http.StatusNotFound) {
+		return l.create(now)
+	}
+	if err != nil {
+		return false, err
+	}
+	spec := &current.Spec
+	if spec.HolderIdentity != l.id {
+		renewed, err := time.Parse(leaseTimeFormat, spec.RenewTime)
+		held := spec.HolderIdentity != "" && err == nil &&
+			now.Before(renewed.Add(time.Duration(spec.LeaseDurationSeconds)*time.Second))
+		if held {
+			return false, nil
+		}
+		spec.HolderIdentity = l.id
+		spec.AcquireTime = now.UTC().Format(leaseTimeFormat)
+		spec.LeaseTransitions++
+	}
+	spec.LeaseDurationSeconds = int64(l.duration / time.Second)
+	spec.RenewTime = now.UTC().Format(leaseTimeFormat)
+	// The resource version makes the update fail if another pod changed the
+	// lease since it was read.
+	err = l.update(current)
+	if hasStatus(err, http.StatusConflict) {
+		l.renewed = time.Time{}
+		return false, nil
+	}
+	if err != nil {
+		l.renewed = time.Time{}
+		return false, err
+	}
+	l.renewed = now
+	return true, nil
+}
+
+// create creates the lease held by this pod. It's called from lock, holding
+// mu.
+func (l *leaseLock) create(now time.Time) (bool, error) {
+	created := lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMetadata{Name: l.name, Namespace: l.namespace},
+		Spec: leaseSpecification{
+			HolderIdentity:       l.id,
+			LeaseDurationSeconds: int64(l.duration / time.Second),
+			AcquireTime:          now.UTC().Format(leaseTimeFormat),
+			RenewTime:            now.UTC().Format(leaseTimeFormat),
+		},
+	}
+	err := l.request(http.MethodPost, l.leasesURL, created, nil)
+	if hasStatus(err, http.StatusConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	l.renewed = now
+	return true, nil
+}
+
+// unlock gives up the lease if this pod holds it, so another can take over
+// without waiting for it to expire.
+func (l *leaseLock) unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.renewed.IsZero() {
+		return nil
+	}
+	l.renewed = time.Time{}
+	current, err := l.get()
+	if err != nil || current.Spec.HolderIdentity != l.id {
+		return err
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.AcquireTime = ""
+	current.Spec.RenewTime = ""
+	return l.update(current)
+}
+
+// get reads the lease.
+func (l *leaseLock) get() (*fetchedLease, error) {
+	var data json.RawMessage
+	err := l.request(http.MethodGet, l.url(), nil, &data)
+	if err != nil {
+		return nil, err
+	}
+	current := &fetchedLease{}
+	err = json.Unmarshal(data, &current.object)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &current.lease)
+	if err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// update writes current's spec into the object it was read from and puts
+// that, keeping the rest of the object, including its resource version.
+func (l *leaseLock) update(current *fetchedLease) error {
+	data, err := json.Marshal(current.Spec)
+	if err != nil {
+		return err
+	}
+	var changed map[string]interface{}
+	err = json.Unmarshal(data, &changed)
+	if err != nil {
+		return err
+	}
+	spec, _ := current.object["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = make(map[string]interface{})
+		current.object["spec"] = spec
+	}
+	// Fields cleared on unlock are left out of changed.
+	for _, field := range []string{"holderIdentity", "acquireTime", "renewTime"} {
+		delete(spec, field)
+	}
+	for field, value := range changed {
+		spec[field] = value
+	}
+	return l.request(http.MethodPut, l.url(), current.object, nil)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeases serves a single Lease like the Kubernetes API, rejecting updates
+// with a stale resource version.
+type fakeLeases struct {
+	mu     sync.Mutex
+	object map[string]interface{}
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		if f.object == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.object)
+	case http.MethodPost, http.MethodPut:
+		var object map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&object); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		metadata, _ := object["metadata"].(map[string]interface{})
+		version := 0
+		if f.object != nil {
+			current := f.object["metadata"].(map[string]interface{})
+			version, _ = strconv.Atoi(current["resourceVersion"].(string))
+			if r.Method == http.MethodPost || metadata["resourceVersion"] != current["resourceVersion"] {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		metadata["resourceVersion"] = strconv.Itoa(version + 1)
+		f.object = object
+	}
+}
+
+// holder returns the lease's holder identity.
+func (f *fakeLeases) holder() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	spec, _ := f.object["spec"].(map[string]interface{})
+	holder, _ := spec["holderIdentity"].(string)
+	return holder
+}
+
+func newTestLeaseLock(t *testing.T, leases *fakeLeases, id string) *leaseLock {
+	server := httptest.NewServer(leases)
+	t.Cleanup(server.Close)
+	// A zero duration renews the lease on every call.
+	return &leaseLock{client: server.Client(), id: id, leasesURL: server.URL, name: "streamstatus", namespace: "default"}
+}
+
+func TestLeaseLock(t *testing.T) {
+	tests := []struct {
+		name   string
+		lease  map[string]interface{}
+		held   bool
+		holder string
+	}{
+		{"missing", nil, true, "pod-a"},
+		{"free", map[string]interface{}{"spec": map[string]interface{}{}}, true, "pod-a"},
+		{"expired", map[string]interface{}{"spec": map[string]interface{}{
+			"holderIdentity":       "pod-b",
+			"renewTime":            time.Now().Add(-time.Minute).UTC().Format(leaseTimeFormat),
+			"leaseDurationSeconds": 15,
+		}}, true, "pod-a"},
+		{"held elsewhere", map[string]interface{}{"spec": map[string]interface{}{
+			"holderIdentity":       "pod-b",
+			"renewTime":            time.Now().UTC().Format(leaseTimeFormat),
+			"leaseDurationSeconds": 15,
+		}}, false, "pod-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leases := &fakeLeases{object: tt.lease}
+			if leases.object != nil {
+				leases.object["metadata"] = map[string]interface{}{
+					"name":            "streamstatus",
+					"resourceVersion": "1",
+					"labels":          map[string]interface{}{"app": "streamstatus"},
+				}
+			}
+			l := newTestLeaseLock(t, leases, "pod-a")
+			held, err := l.lock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if held != tt.held {
+				t.Errorf("held = %t, want %t", held, tt.held)
+			}
+			if holder := leases.holder(); holder != tt.holder {
+				t.Errorf("holder = %q, want %q", holder, tt.holder)
+			}
+			if tt.lease != nil {
+				metadata := leases.object["metadata"].(map[string]interface{})
+				if _, ok := metadata["labels"]; !ok {
+					t.Errorf("labels dropped from the lease: %v", metadata)
+				}
+			}
+		})
+	}
+}
+
+func TestLeaseLockConcurrent(t *testing.T) {
+	leases := &fakeLeases{}
+	l := newTestLeaseLock(t, leases, "pod-a")
+	r := &redisQueue{leader: l}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				held, err := l.lock()
+				if err != nil || !held {
+					t.Errorf("lock() = %t, %v, want true", held, err)
+				}
+			}
+		}()
+	}
+	err := r.hold(func() {})
+	if err != nil {
+		t.Errorf("hold() = %v", err)
+	}
+	wg.Wait()
+	err = l.unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder := leases.holder(); holder != "" {
+		t.Errorf("holder after unlock = %q, want none", holder)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// pageProblems are the problems found in a page.
+type pageProblems struct {
+	path     string
+	problems []render.Problem
+}
+
+// lintPages reads index.md, and the inactive page if there is one, and
+// returns the problems found in them.
+func (q *updateQueue) lintPages() ([]pageProblems, error) {
+	repo := q.repo
+	if repo.contents != nil {
+		text, _, err := repo.contents.get(repo.indexFilePath)
+		if err != nil {
+			return nil, err
+		}
+		return []pageProblems{{repo.indexFilePath, render.Lint(text, repo.style)}}, nil
+	}
+	err := repo.withCloneLock(func() error {
+		err := repo.retry.do(repo.logger, "sync", repo.syncRepo)
+		if err != nil {
+			return err
+		}
+		return repo.readFile()
+	})
+	if err != nil {
+		return nil, err
+	}
+	found := []pageProblems{{repo.indexFilePath, render.Lint(repo.indexMdText, repo.style)}}
+	if repo.hasInactivePage() {
+		found = append(found, pageProblems{repo.inactiveFilePath, render.Lint(repo.inactiveMdText, repo.style)})
+	}
+	return found, nil
+}
+
+// formatPages commits index.md, and the inactive page if there is one,
+// rewritten in canonical form. It returns a NoChangeNeededError if they
+// already are.
+func (q *updateQueue) formatPages() error {
+	repo := q.repo
+	if repo.contents != nil {
+		return fmt.Errorf("formatting needs the git backend")
+	}
+	return q.commitTask("lint", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		index, inactive := render.Format(repo.indexMdText, repo.style), render.Format(repo.inactiveMdText, repo.style)
+		if index == repo.indexMdText && inactive == repo.inactiveMdText {
+			return "", &NoChangeNeededError{err: "pages are already formatted"}
+		}
+		repo.indexMdText, repo.inactiveMdText = index, inactive
+		err = repo.writeFiles()
+		if err != nil {
+			return "", err
+		}
+		err = repo.addFile(repo.indexFilePath)
+		if err == nil && repo.hasInactivePage() {
+			err = repo.addFile(repo.inactiveFilePath)
+		}
+		return "🧹 Formatted the streamer list", err
+	})
+}
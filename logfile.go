@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFileTimeFormat stamps the names of rotated log files, so they sort in
+// the order they were rotated.
+const logFileTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotatingFile is a log file that's renamed with the time once it reaches
+// maxSize bytes or has been written to for longer than maxAge, and a new one
+// started. Rotated files older than maxAge are deleted.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// opened is when the file was opened, so it's rotated maxAge later.
+	opened time.Time
+}
+
+// openRotatingFile opens the log file at path, appending to it if it exists.
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file for appending.
+func (f *rotatingFile) open() error {
+	err := os.MkdirAll(filepath.Dir(f.path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+// Write writes p to the log file, rotating it first if p would take it over
+// the maximum size or it's older than the maximum age.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tooOld := f.maxAge > 0 && time.Since(f.opened) > f.maxAge
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || tooOld) {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the log file with the time, starts a new one and deletes
+// rotated files older than the maximum age. If it can't, it carries on
+// writing to the file at the original path.
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), time.Now().UTC().Format(logFileTimeFormat), ext)
+	err = os.Rename(f.path, rotated)
+	if err != nil {
+		return f.reopen(err)
+	}
+	err = f.open()
+	if err != nil {
+		// Put the old file back to keep writing to it.
+		os.Rename(rotated, f.path)
+		return f.reopen(err)
+	}
+	f.prune()
+	return nil
+}
+
+// reopen opens the file at the original path again after rotating it failed
+// with err, returning err if it could be opened.
+func (f *rotatingFile) reopen(err error) error {
+	openErr := f.open()
+	if openErr != nil {
+		return fmt.Errorf("%s, and reopening %s: %s", err, f.path, openErr)
+	}
+	return err
+}
+
+// prune deletes rotated log files last written longer than the maximum age
+// ago. Errors are ignored, as there's nowhere to log them.
+func (f *rotatingFile) prune() {
+	if f.maxAge == 0 {
+		return
+	}
+	ext := filepath.Ext(f.path)
+	rotated, err := filepath.Glob(strings.TrimSuffix(f.path, ext) + "-*" + ext)
+	if err != nil {
+		return
+	}
+	for _, name := range rotated {
+		info, err := os.Stat(name)
+		if err == nil && time.Since(info.ModTime()) > f.maxAge {
+			os.Remove(name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redacted replaces secrets in logged payloads and headers.
+const redacted = "[redacted]"
+
+// secretWords are the parts of field and header names whose values are
+// redacted.
+var secretWords = []string{"secret", "token", "password", "authorization", "cookie", "key"}
+
+// redactURL replaces secret in the URL of a failed request's error, which
+// would otherwise be logged along with the error.
+func redactURL(err error, secret string) error {
+	var urlErr *url.Error
+	if secret == "" || !errors.As(err, &urlErr) {
+		return err
+	}
+	return &url.Error{Op: urlErr.Op, URL: strings.ReplaceAll(urlErr.URL, secret, redacted), Err: urlErr.Err}
+}
+
+// setupLogging configures the global logger's level and output format, and
+// writes to the log file as well as stderr if there is one.
+func setupLogging(cfg *config) error {
+	err := setLogLevel(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.LogFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{})
+	}
+	if cfg.LogFile == "" {
+		return nil
+	}
+	maxAge, err := time.ParseDuration(cfg.LogFileMaxAge)
+	if err != nil {
+		return err
+	}
+	file, err := openRotatingFile(cfg.LogFile, cfg.LogFileMaxSize<<20, maxAge)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, file))
+	return nil
+}
+
+// setLogLevel sets the global logger's level to the configured one.
+func setLogLevel(cfg *config) error {
+	level, err := log.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	return nil
+}
+
+// isSecret reports whether a field or header called name holds a secret.
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue replaces the values of secret fields in a decoded JSON value.
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, value := range v {
+			if isSecret(name) {
+				v[name] = redacted
+			} else {
+				v[name] = redactValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+// redactPayload returns the JSON payload with the values of secret fields
+// redacted, to be logged. Payloads that aren't JSON aren't logged, as they
+// can't be redacted.
+func redactPayload(payload []byte) string {
+	var v interface{}
+	err := json.Unmarshal(payload, &v)
+	if err != nil {
+		return fmt.Sprintf("(%d bytes, not JSON)", len(payload))
+	}
+	redactedPayload, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return fmt.Sprintf("(%d bytes, not JSON)", len(payload))
+	}
+	return string(redactedPayload)
+}
+
+// redactHeaders returns header with the values of secret headers redacted, to
+// be logged.
+func redactHeaders(header http.Header) http.Header {
+	redactedHeader := http.Header{}
+	for name, values := range header {
+		if isSecret(name) {
+			values = []string{redacted}
+		}
+		redactedHeader[name] = values
+	}
+	return redactedHeader
+}
+
+// debugPayload logs the headers and payload of a request at debug level, with
+// secrets redacted.
+func debugPayload(logger log.FieldLogger, header http.Header, payload []byte) {
+	if !log.IsLevelEnabled(log.DebugLevel) {
+		return
+	}
+	logger.WithField("headers", redactHeaders(header)).Debugf("payload: %s", redactPayload(payload))
+}
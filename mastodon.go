@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// defaultMastodonTemplate is the toot posted when no template is configured.
+const defaultMastodonTemplate = "{{.Streamer}} is live: {{.Title}} {{.URL}}"
+
+// mastodonNotifier posts a status to a Mastodon account when a streamer goes live.
+type mastodonNotifier struct {
+	server   string
+	token    string
+	template *template.Template
+}
+
+// newMastodonNotifier returns a notifier for the configured Mastodon account,
+// or nil if none is configured.
+func newMastodonNotifier(cfg *config) (*mastodonNotifier, error) {
+	if cfg.MastodonServer == "" || cfg.MastodonToken == "" {
+		return nil, nil
+	}
+	text := cfg.MastodonTemplate
+	if text == "" {
+		text = defaultMastodonTemplate
+	}
+	tmpl, err := template.New("mastodon").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing mastodon template: %s", err)
+	}
+	return &mastodonNotifier{
+		server:   strings.TrimRight(cfg.MastodonServer, "/"),
+		token:    cfg.MastodonToken,
+		template: tmpl,
+	}, nil
+}
+
+// mastodonStatus is the body of a Mastodon create status request.
+type mastodonStatus struct {
+	Status string `json:"status"`
+}
+
+// notify toots the rendered template when the streamer goes live.
+func (m *mastodonNotifier) notify(n notification) error {
+	if !n.Online {
+		return nil
+	}
+	text, err := renderTemplate(m.template, n)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+m.token)
+	// Mastodon de-duplicates statuses with the same key, so a redelivered
+	// event won't toot twice.
+	header.Set("Idempotency-Key", n.EventID)
+	err = postJSON(m.server+"/api/v1/statuses", mastodonStatus{Status: text}, header)
+	if err != nil {
+		return fmt.Errorf("mastodon: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// matrixNotifier sends go-live and offline messages to Matrix rooms.
+type matrixNotifier struct {
+	homeserver string
+	token      string
+	rooms      []string
+}
+
+// newMatrixNotifier returns a notifier for the configured homeserver and rooms,
+// or nil if none are configured.
+func newMatrixNotifier(cfg *config) *matrixNotifier {
+	if cfg.MatrixHomeserver == "" || cfg.MatrixToken == "" || len(cfg.MatrixRooms) == 0 {
+		return nil
+	}
+	return &matrixNotifier{
+		homeserver: strings.TrimRight(cfg.MatrixHomeserver, "/"),
+		token:      cfg.MatrixToken,
+		rooms:      cfg.MatrixRooms,
+	}
+}
+
+// matrixMessage is an m.room.message event with an HTML formatted body.
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+// newMatrixMessage formats n as plain text and HTML.
+func newMatrixMessage(n notification) matrixMessage {
+	name := html.EscapeString(n.Streamer)
+	link := fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(n.URL), name)
+	msg := matrixMessage{MsgType: "m.text", Format: "org.matrix.custom.html"}
+	if !n.Online {
+		msg.Body = fmt.Sprintf("%s has gone offline.", n.Streamer)
+		msg.FormattedBody = fmt.Sprintf("⚫ <b>%s</b> has gone offline.", link)
+		return msg
+	}
+	msg.Body = fmt.Sprintf("%s is live! %s", n.Streamer, n.URL)
+	msg.FormattedBody = fmt.Sprintf("🔴 <b>%s</b> is live!", link)
+	if n.Title != "" {
+		msg.Body += "\n" + n.Title
+		msg.FormattedBody += "<br>" + html.EscapeString(n.Title)
+	}
+	if n.Game != "" {
+		msg.Body += "\nPlaying " + n.Game
+		msg.FormattedBody += "<br>Playing <i>" + html.EscapeString(n.Game) + "</i>"
+	}
+	return msg
+}
+
+// notify sends the message to each room.
+func (m *matrixNotifier) notify(n notification) error {
+	// The transaction ID makes redelivered events idempotent per room.
+	return m.send(newMatrixMessage(n), n.EventID)
+}
+
+// alert sends the message to each room as a notice.
+func (m *matrixNotifier) alert(message string) error {
+	msg := matrixMessage{
+		MsgType:       "m.notice",
+		Body:          message,
+		Format:        "org.matrix.custom.html",
+		FormattedBody: html.EscapeString(message),
+	}
+	return m.send(msg, fmt.Sprintf("alert-%d", time.Now().UnixNano()))
+}
+
+// send sends msg to each room, with a transaction ID made from txn.
+func (m *matrixNotifier) send(msg matrixMessage, txn string) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, room := range m.rooms {
+		txnID := url.PathEscape(txn + "-" + room)
+		endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", m.homeserver, url.PathEscape(room), txnID)
+		req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(body))
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		req.Header.Set("Authorization", "Bearer "+m.token)
+		req.Header.Set("Content-Type", "application/json")
+		err = doRequest(req, nil)
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("matrix: %d of %d rooms failed: %v", len(failed), len(m.rooms), failed)
+	}
+	return nil
+}
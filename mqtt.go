@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// defaultMQTTTopicPrefix is prepended to the streamer's login to form the topic.
+	defaultMQTTTopicPrefix = "streamstatus"
+	// mqttTimeout bounds connecting to the broker and each publish.
+	mqttTimeout = 10 * time.Second
+)
+
+// mqttNotifier publishes retained status messages to an MQTT broker.
+type mqttNotifier struct {
+	client mqtt.Client
+	prefix string
+}
+
+// newMQTTNotifier returns a notifier for the configured broker, or nil if none
+// is configured. The connection is made lazily and re-established automatically.
+func newMQTTNotifier(cfg *config) *mqttNotifier {
+	if cfg.MQTTBroker == "" {
+		return nil
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.MQTTBroker).
+		SetClientID(cfg.MQTTClientID).
+		SetUsername(cfg.MQTTUsername).
+		SetPassword(cfg.MQTTPassword).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(true)
+	prefix := strings.TrimRight(cfg.MQTTTopicPrefix, "/")
+	if prefix == "" {
+		prefix = defaultMQTTTopicPrefix
+	}
+	return &mqttNotifier{
+		client: mqtt.NewClient(opts),
+		prefix: prefix,
+	}
+}
+
+// notify publishes a retained JSON message to <prefix>/<login>.
+func (m *mqttNotifier) notify(n notification) error {
+	if !m.client.IsConnected() {
+		token := m.client.Connect()
+		if !token.WaitTimeout(mqttTimeout) {
+			return fmt.Errorf("mqtt: timed out connecting to broker")
+		}
+		if token.Error() != nil {
+			return fmt.Errorf("mqtt: %s", token.Error())
+		}
+	}
+	payload, err := json.Marshal(newWebhookPayload(n))
+	if err != nil {
+		return err
+	}
+	topic := m.prefix + "/" + strings.ToLower(n.Login)
+	token := m.client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("mqtt: timed out publishing to %s", topic)
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("mqtt: %s", token.Error())
+	}
+	return nil
+}
+
+// close disconnects from the broker, waiting up to 250ms for publishes in
+// flight, so a notifier replacing it with the same client ID isn't
+// disconnected in turn.
+func (m *mqttNotifier) close() {
+	if m.client.IsConnected() {
+		m.client.Disconnect(250)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+	log "github.com/sirupsen/logrus"
+)
+
+// notifyTimeout bounds each outbound notification request.
+const notifyTimeout = 10 * time.Second
+
+// notifyClient is the HTTP client used by notifiers.
+var notifyClient = &http.Client{Timeout: notifyTimeout}
+
+// notification holds the details of a status change sent to notifiers.
+type notification struct {
+	EventID      string
+	Game         string
+	Login        string
+	Online       bool
+	Platform     string
+	Streamer     string
+	ThumbnailURL string
+	Title        string
+	URL          string
+	UserID       string
+}
+
+// notifier announces status changes somewhere other than the site repository.
+type notifier interface {
+	notify(n notification) error
+}
+
+// alerter is a notifier that can also send messages about the service
+// itself, such as pushes failing.
+type alerter interface {
+	alert(message string) error
+}
+
+// closer is a notifier holding a connection, to close once it's replaced or
+// the service stops.
+type closer interface {
+	close()
+}
+
+// newNotifiers returns a notifier for each integration configured in cfg.
+func newNotifiers(cfg *config) ([]notifier, error) {
+	var notifiers []notifier
+	if len(cfg.DiscordWebhooks) > 0 {
+		notifiers = append(notifiers, &discordNotifier{webhooks: cfg.DiscordWebhooks})
+	}
+	if slack := newSlackNotifier(cfg); slack != nil {
+		notifiers = append(notifiers, slack)
+	}
+	mastodon, err := newMastodonNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if mastodon != nil {
+		notifiers = append(notifiers, mastodon)
+	}
+	bluesky, err := newBlueskyNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if bluesky != nil {
+		notifiers = append(notifiers, bluesky)
+	}
+	telegram, err := newTelegramNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if telegram != nil {
+		notifiers = append(notifiers, telegram)
+	}
+	if len(cfg.OutboundWebhooks) > 0 {
+		notifiers = append(notifiers, &webhookNotifier{urls: cfg.OutboundWebhooks, secret: cfg.OutboundWebhookSecret})
+	}
+	if mqtt := newMQTTNotifier(cfg); mqtt != nil {
+		notifiers = append(notifiers, mqtt)
+	}
+	if matrix := newMatrixNotifier(cfg); matrix != nil {
+		notifiers = append(notifiers, matrix)
+	}
+	return notifiers, nil
+}
+
+// newNotification builds a notification for c. For Twitch changes, when a
+// Helix client is available it uses the streamer's canonical login and
+// display name, and adds the stream title, game and thumbnail when the
+// streamer is online.
+func newNotification(c statusChange, client *twitchClient, logger *log.Entry) notification {
+	n := notification{
+		EventID:  c.id,
+		Login:    c.login,
+		Online:   c.online,
+		Platform: changePlatform(c.userID),
+		Streamer: c.streamer,
+		UserID:   c.userID,
+	}
+	if n.Platform != platformTwitch {
+		n.URL = channelURL(n.Platform, strings.TrimPrefix(c.userID, n.Platform+":"))
+		return n
+	}
+	if client != nil {
+		user, err := client.getUser(c.userID, logger)
+		if err != nil {
+			logger.Printf("error getting canonical names: %s\n", err)
+		} else {
+			n.Login = user.Login
+			n.Streamer = user.DisplayName
+		}
+	}
+	n.URL = "https://www.twitch.tv/" + n.Login
+	if !c.online || client == nil {
+		return n
+	}
+	stream, err := client.getStream(c.userID, logger)
+	if err != nil {
+		logger.Printf("error getting stream details: %s\n", err)
+		return n
+	}
+	if stream != nil {
+		n.Game = stream.GameName
+		n.Title = stream.Title
+		n.ThumbnailURL = twitch.ThumbnailURL(stream.ThumbnailURL, 1280, 720)
+	}
+	return n
+}
+
+// notifyAll sends n to every notifier, logging any failures.
+func notifyAll(notifiers []notifier, n notification, logger *log.Entry) {
+	for _, nt := range notifiers {
+		err := nt.notify(n)
+		if err != nil {
+			logger.Printf("error sending notification: %s\n", err)
+		}
+	}
+}
+
+// closeNotifiers closes every notifier that's a closer.
+func closeNotifiers(notifiers []notifier) {
+	for _, nt := range notifiers {
+		if c, ok := nt.(closer); ok {
+			c.close()
+		}
+	}
+}
+
+// alertAll sends the message through every notifier that's an alerter.
+func alertAll(notifiers []notifier, message string, logger *log.Entry) {
+	for _, nt := range notifiers {
+		a, ok := nt.(alerter)
+		if !ok {
+			continue
+		}
+		err := a.alert(message)
+		if err != nil {
+			logger.Printf("error sending alert: %s\n", err)
+		}
+	}
+}
+
+// renderTemplate executes t with n and returns the trimmed result.
+func renderTemplate(t *template.Template, n notification) (string, error) {
+	var buf bytes.Buffer
+	err := t.Execute(&buf, n)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// postJSON POSTs body encoded as JSON to url and returns an error for non-2xx responses.
+func postJSON(url string, body interface{}, header http.Header) error {
+	return postJSONResponse(url, body, header, nil)
+}
+
+// postJSONResponse POSTs body encoded as JSON to url and decodes the JSON
+// response into out if it is not nil.
+func postJSONResponse(url string, body interface{}, header http.Header, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(req, out)
+}
+
+// statusError is returned for a non-2xx response.
+type statusError struct {
+	code   int
+	host   string
+	status string
+}
+
+// Error returns the host and status of the response.
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status from %s: %s", e.host, e.status)
+}
+
+// hasStatus reports whether err is, or wraps, a response with the status
+// code.
+func hasStatus(err error, code int) bool {
+	var e *statusError
+	return errors.As(err, &e) && e.code == code
+}
+
+// doRequest sends req with the notify client, returns an error for non-2xx
+// responses and decodes the JSON response into out if it is not nil.
+func doRequest(req *http.Request, out interface{}) error {
+	return doClientRequest(notifyClient, req, out)
+}
+
+// doClientRequest is doRequest with the given client.
+func doClientRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{code: resp.StatusCode, host: req.URL.Host, status: resp.Status}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeNotifier records the notifications and alerts sent through it, waiting
+// for release before each one if it's set.
+type fakeNotifier struct {
+	release chan struct{}
+	sent    chan string
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{sent: make(chan string, 10)}
+}
+
+func (f *fakeNotifier) notify(n notification) error {
+	if f.release != nil {
+		<-f.release
+	}
+	f.sent <- n.Streamer
+	return nil
+}
+
+func (f *fakeNotifier) alert(message string) error {
+	f.sent <- message
+	return nil
+}
+
+func (f *fakeNotifier) close() {
+	f.sent <- "closed"
+}
+
+// sentMessages takes what the notifier has sent so far.
+func (f *fakeNotifier) sentMessages() []string {
+	var sent []string
+	for {
+		select {
+		case s := <-f.sent:
+			sent = append(sent, s)
+		default:
+			return sent
+		}
+	}
+}
+
+func TestNotificationWorker(t *testing.T) {
+	q := newUpdateQueue(&StreamersRepo{logger: log.NewEntry(log.StandardLogger())}, 1)
+	slow := newFakeNotifier()
+	slow.release = make(chan struct{})
+	q.notifiers = []notifier{slow}
+	go q.run()
+
+	// The queue goes on while the notifier is stuck.
+	done := make(chan struct{})
+	q.schedule(func() {
+		q.repo.applied = []notification{{Streamer: "Alice"}, {Streamer: "Bob"}}
+		q.notifyApplied(q.repo)
+		q.alert("pushes failing", q.repo.logger)
+		close(done)
+	})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifying blocked the update queue")
+	}
+
+	// Notifiers replaced by a reload are closed after what was queued for them.
+	replaced := make(chan struct{})
+	q.schedule(func() {
+		old := q.notifiers
+		q.notifiers = []notifier{newFakeNotifier()}
+		if !q.queueNotification(func() { closeNotifiers(old) }) {
+			t.Error("notification queue full")
+		}
+		close(replaced)
+	})
+	<-replaced
+	close(slow.release)
+	err := q.shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := slow.sentMessages()
+	want := []string{"Alice", "Bob", "pushes failing", "closed"}
+	if len(got) != len(want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sent %q, want %q", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+)
+
+// openAPIObject is a JSON object in the OpenAPI document.
+type openAPIObject map[string]interface{}
+
+// apiParam describes a query parameter.
+type apiParam struct {
+	name        string
+	kind        string
+	description string
+	required    bool
+}
+
+// apiOperation describes an endpoint's method.
+type apiOperation struct {
+	summary string
+	params  []apiParam
+	// responses maps status codes to their description, and result to the
+	// schema of the 200 response, if it's JSON.
+	responses map[string]string
+	result    openAPIObject
+	admin     bool
+}
+
+// object returns the operation in the OpenAPI document.
+func (o apiOperation) object() openAPIObject {
+	var params []openAPIObject
+	for _, p := range o.params {
+		params = append(params, openAPIObject{
+			"name":        p.name,
+			"in":          "query",
+			"description": p.description,
+			"required":    p.required,
+			"schema":      openAPIObject{"type": p.kind},
+		})
+	}
+	responses := openAPIObject{}
+	for code, description := range o.responses {
+		response := openAPIObject{"description": description}
+		if code == "200" && o.result != nil {
+			response["content"] = openAPIObject{"application/json": openAPIObject{"schema": o.result}}
+		} else if code != "200" {
+			response["content"] = openAPIObject{"application/json": openAPIObject{"schema": schemaRef("Error")}}
+		}
+		responses[code] = response
+	}
+	op := openAPIObject{"summary": o.summary, "responses": responses}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if o.admin {
+		op["security"] = []openAPIObject{{"adminToken": []string{}}}
+		responses["401"] = openAPIObject{
+			"description": "Missing or invalid admin token",
+			"content":     openAPIObject{"application/json": openAPIObject{"schema": schemaRef("Error")}},
+		}
+	}
+	return op
+}
+
+// schemaRef refers to a schema in the document's components.
+func schemaRef(name string) openAPIObject {
+	return openAPIObject{"$ref": "#/components/schemas/" + name}
+}
+
+// arrayOf is the schema of an array of the named schema.
+func arrayOf(name string) openAPIObject {
+	return openAPIObject{"type": "array", "items": schemaRef(name)}
+}
+
+// objectSchema is the schema of a JSON object with the properties, by name
+// and type. Types starting with # refer to other schemas.
+func objectSchema(properties ...string) openAPIObject {
+	props := openAPIObject{}
+	for i := 0; i+1 < len(properties); i += 2 {
+		name, kind := properties[i], properties[i+1]
+		switch {
+		case kind[0] == '#':
+			props[name] = schemaRef(kind[1:])
+		case kind == "date-time":
+			props[name] = openAPIObject{"type": "string", "format": "date-time"}
+		default:
+			props[name] = openAPIObject{"type": kind}
+		}
+	}
+	return openAPIObject{"type": "object", "properties": props}
+}
+
+// openAPISpec returns the OpenAPI 3 document describing the HTTP endpoints.
+// Endpoints that need settings which aren't set are described anyway, noting
+// what they need.
+func openAPISpec(webhookPath string) openAPIObject {
+	paths := map[string]map[string]apiOperation{
+		webhookPath: {"post": {
+			summary: "Receive a signed Twitch EventSub notification or challenge",
+			responses: map[string]string{
+				"200": "The event was accepted, ignored, or the challenge is echoed",
+				"400": "Malformed or unsupported notification",
+				"403": "Invalid signature",
+				"413": "Request body too large",
+				"429": "Over SS_WEBHOOK_RATE_LIMIT or SS_WEBHOOK_IP_RATE_LIMIT",
+				"503": "Update queue unavailable, Twitch retries the event",
+			},
+		}},
+		"/healthz": {"get": {
+			summary:   "Report that the process is alive",
+			responses: map[string]string{"200": "ok"},
+		}},
+		"/readyz": {"get": {
+			summary: "Report whether the repository is cloned, the git credentials work and the secret is present",
+			responses: map[string]string{
+				"200": "ok",
+				"503": "Not ready, listing the failing checks",
+			},
+		}},
+		"/calendar.ics": {"get": {
+			summary: "Fetch the iCalendar of scheduled streams (needs SS_CALENDAR_FILE)",
+			responses: map[string]string{
+				"200": "text/calendar",
+				"503": "Calendar not rendered yet",
+			},
+		}},
+		"/metrics": {"get": {
+			summary:   "Fetch counters in the Prometheus text format",
+			responses: map[string]string{"200": "text/plain"},
+		}},
+		"/openapi.json": {"get": {
+			summary:   "Fetch this document",
+			responses: map[string]string{"200": "The OpenAPI document"},
+		}},
+		"/admin/reload": {"post": {
+			summary:   "Reload the settings that can change without a restart",
+			responses: map[string]string{"200": "ok", "500": "A setting is invalid, nothing was applied"},
+			admin:     true,
+		}},
+		"/dashboard": {"get": {
+			summary:   "Show the queue, latest push, statuses and events as HTML, also accepting the admin token as a basic auth password",
+			responses: map[string]string{"200": "text/html"},
+			admin:     true,
+		}},
+		"/admin/subscriptions": {"get": {
+			summary:   "Show the app's EventSub subscription count and cost (needs the Twitch app credentials)",
+			responses: map[string]string{"200": "The usage at the last check", "502": "Error checking subscriptions"},
+			result:    schemaRef("SubscriptionUsage"),
+			admin:     true,
+		}},
+		"/admin/streamers": {
+			"post": {
+				summary:   "Subscribe to a streamer's events and commit a row for them (needs the Twitch app credentials, the git backend and SS_CALLBACK_URL)",
+				params:    []apiParam{{name: "login", kind: "string", description: "The streamer's Twitch login", required: true}},
+				responses: map[string]string{"200": "The streamer, changed false if they already had a row", "400": "No login", "404": "No such streamer", "501": "No SS_CALLBACK_URL", "503": "Another instance is taking changes"},
+				result:    schemaRef("StreamerResponse"),
+				admin:     true,
+			},
+			"delete": {
+				summary: "Delete a streamer's subscriptions and rows (needs the Twitch app credentials and the git backend)",
+				params: []apiParam{
+					{name: "login", kind: "string", description: "The streamer's Twitch login", required: true},
+					{name: "archive", kind: "boolean", description: "Move their row to SS_INACTIVE_FILE instead"},
+				},
+				responses: map[string]string{"200": "The streamer, changed false if they had no row", "400": "No login", "404": "No such streamer", "503": "Another instance is taking changes"},
+				result:    schemaRef("StreamerResponse"),
+				admin:     true,
+			},
+		},
+		"/admin/reconcile": {"post": {
+			summary:   "Queue changes for the rows of index.md that disagree with Twitch (needs the Twitch app credentials and the git backend)",
+			responses: map[string]string{"200": "How many changes were queued", "503": "Another instance is taking changes"},
+			result:    schemaRef("ReconcileResponse"),
+			admin:     true,
+		}},
+		"/admin/dead-letters": {"get": {
+			summary:   "List the dead-lettered changes (needs SS_DEAD_LETTER_PATH)",
+			responses: map[string]string{"200": "The dead-lettered changes"},
+			result:    arrayOf("DeadLetter"),
+			admin:     true,
+		}},
+		"/admin/dead-letters/replay": {"post": {
+			summary:   "Queue dead-lettered changes again (needs SS_DEAD_LETTER_PATH)",
+			params:    []apiParam{{name: "id", kind: "string", description: "Only replay the changes for this event"}},
+			responses: map[string]string{"200": "How many changes were replayed and rejected"},
+			result:    schemaRef("ReplayResponse"),
+			admin:     true,
+		}},
+		"/history": {"get": {
+			summary: "List processed events newest first (needs SS_STATUS_DB_PATH)",
+			params: []apiParam{
+				{name: "streamer", kind: "string", description: "Only list this streamer's events"},
+				{name: "since", kind: "string", description: "Only list events processed since this RFC 3339 time, by default a day ago"},
+				{name: "limit", kind: "integer", description: "List up to this many events, 1 to 1000, by default 100"},
+			},
+			responses: map[string]string{"200": "The events", "400": "Invalid parameter"},
+			result:    arrayOf("HistoryEvent"),
+			admin:     true,
+		}},
+		"/graphql": {
+			"get": {
+				summary: "Query streamers and processed events with GraphQL (needs SS_STATUS_DB_PATH)",
+				params: []apiParam{
+					{name: "query", kind: "string", description: "The GraphQL query", required: true},
+					{name: "operationName", kind: "string", description: "The operation to run"},
+					{name: "variables", kind: "string", description: "The query's variables as a JSON object"},
+				},
+				responses: map[string]string{"200": "The GraphQL response, with any errors", "400": "Malformed variables"},
+				admin:     true,
+			},
+			"post": {
+				summary:   "Query streamers and processed events with GraphQL, given a JSON body of query, operationName and variables (needs SS_STATUS_DB_PATH)",
+				responses: map[string]string{"200": "The GraphQL response, with any errors", "400": "Malformed request"},
+				admin:     true,
+			},
+		},
+		"/admin/revocations": {"get": {
+			summary:   "List the streamers who revoked the app's authorization (needs SS_STATUS_DB_PATH)",
+			responses: map[string]string{"200": "The revocations, newest first"},
+			result:    arrayOf("Revocation"),
+			admin:     true,
+		}},
+		"/debug/simulate": {"post": {
+			summary: "Feed a signed fake event to the webhook (needs SS_DEBUG_SIMULATE)",
+			params: []apiParam{
+				{name: "login", kind: "string", description: "The streamer's Twitch login", required: true},
+				{name: "type", kind: "string", description: "stream.online or stream.offline", required: true},
+				{name: "user_id", kind: "string", description: "The streamer's user ID"},
+				{name: "name", kind: "string", description: "The streamer's display name"},
+				{name: "stream_type", kind: "string", description: "The stream type of a stream.online event, by default live"},
+			},
+			responses: map[string]string{"200": "The webhook's response"},
+			admin:     true,
+		}},
+	}
+	pathObjects := openAPIObject{}
+	for path, methods := range paths {
+		item := openAPIObject{}
+		for method, op := range methods {
+			item[method] = op.object()
+		}
+		pathObjects[path] = item
+	}
+	return openAPIObject{
+		"openapi": "3.0.3",
+		"info": openAPIObject{
+			"title":       "StreamStatus",
+			"description": "Updates a streamer list's online status from Twitch EventSub and other platforms.",
+			"version":     "1",
+		},
+		"paths": pathObjects,
+		"components": openAPIObject{
+			"securitySchemes": openAPIObject{
+				"adminToken": openAPIObject{"type": "http", "scheme": "bearer", "description": "SS_ADMIN_TOKEN"},
+			},
+			"schemas": openAPIObject{
+				"Error":             objectSchema("status", "integer", "error", "string"),
+				"SubscriptionUsage": objectSchema("count", "integer", "total_cost", "integer", "max_total_cost", "integer", "checked_at", "date-time"),
+				"StreamerResponse":  objectSchema("user_id", "string", "login", "string", "streamer", "string", "changed", "boolean"),
+				"ReconcileResponse": objectSchema("queued", "integer"),
+				"ReplayResponse":    objectSchema("replayed", "integer", "rejected", "integer"),
+				"Change":            objectSchema("id", "string", "login", "string", "online", "boolean", "streamer", "string", "user_id", "string", "queued_at", "date-time"),
+				"DeadLetter":        objectSchema("change", "#Change", "error", "string", "failed_at", "date-time"),
+				"HistoryEvent": objectSchema("event_id", "string", "user_id", "string", "login", "string", "streamer", "string",
+					"type", "string", "queued_at", "date-time", "processed_at", "date-time", "outcome", "string", "error", "string"),
+				"Revocation": objectSchema("user_id", "string", "login", "string", "streamer", "string", "revoked_at", "date-time", "event_id", "string"),
+			},
+		},
+	}
+}
+
+// openAPIHandler serves the OpenAPI document.
+type openAPIHandler struct {
+	spec []byte
+}
+
+// newOpenAPIHandler renders the OpenAPI document for the webhook path.
+func newOpenAPIHandler(webhookPath string) (*openAPIHandler, error) {
+	spec, err := json.MarshalIndent(openAPISpec(webhookPath), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &openAPIHandler{spec: spec}, nil
+}
+
+// serve writes the OpenAPI document.
+func (h *openAPIHandler) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(h.spec)
+}
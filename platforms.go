@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// Platforms streamers can be live on. Changes from EventSub are on Twitch.
+const (
+	platformTwitch  = "twitch"
+	platformYouTube = "youtube"
+	platformKick    = "kick"
+	platformTrovo   = "trovo"
+)
+
+// rosterEntry is what the roster file records about a streamer.
+type rosterEntry struct {
+	// Platforms maps the platforms the streamer streams on besides Twitch to
+	// their channel there.
+	Platforms map[string]string `json:"platforms"`
+	// Links maps the headings of index.md columns, such as GitHub or
+	// Mastodon, to the streamer's link or handle to render in them.
+	Links map[string]string `json:"links"`
+}
+
+// roster is the roster file, mapping each streamer's Twitch login to what is
+// known about them.
+type roster map[string]rosterEntry
+
+// loadRoster reads the roster file at the configured path, or returns nil
+// when no path is configured.
+func loadRoster(cfg *config) (roster, error) {
+	if cfg.RosterPath == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(cfg.RosterPath)
+	if err != nil {
+		return nil, err
+	}
+	var r roster
+	err = json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", cfg.RosterPath, err)
+	}
+	return r, nil
+}
+
+// channels returns the channel of each streamer on the platform, by login.
+func (r roster) channels(platform string) map[string]string {
+	channels := map[string]string{}
+	for login, entry := range r {
+		if channel := entry.Platforms[platform]; channel != "" {
+			channels[strings.ToLower(login)] = channel
+		}
+	}
+	return channels
+}
+
+// platformUserID returns the user ID the changes for a channel on a platform
+// other than Twitch are recorded under.
+func platformUserID(platform, channel string) string {
+	return platform + ":" + channel
+}
+
+// changePlatform returns the platform a change with the user ID is for.
+func changePlatform(userID string) string {
+	if i := strings.Index(userID, ":"); i > 0 {
+		return userID[:i]
+	}
+	return platformTwitch
+}
+
+// channelURL returns the URL of the channel on the platform. Channels that are
+// URLs themselves, such as Owncast servers, are their own.
+func channelURL(platform, channel string) string {
+	if strings.Contains(channel, "://") {
+		return channel
+	}
+	switch platform {
+	case platformYouTube:
+		return "https://www.youtube.com/channel/" + channel + "/live"
+	case platformKick:
+		return "https://kick.com/" + channel
+	case platformTrovo:
+		return "https://trovo.live/s/" + channel
+	}
+	return "https://www.twitch.tv/" + channel
+}
+
+// statusSource polls a platform other than Twitch for whether channels are
+// live.
+type statusSource interface {
+	platform() string
+	live(channel string, logger *log.Entry) (bool, error)
+}
+
+// streamerRoster is what the queue knows about streamers beyond index.md:
+// their channels on platforms other than Twitch, polled for their status, and
+// links to render in their rows. The roster file is one.
+type streamerRoster interface {
+	channels(platform string) map[string]string
+	hasLinks() bool
+	setLinks(text string) string
+}
+
+// setRoster replaces the roster the pollers poll the channels of.
+func (q *updateQueue) setRoster(r streamerRoster) {
+	q.rosterMu.Lock()
+	defer q.rosterMu.Unlock()
+	q.roster = r
+}
+
+// currentRoster returns the roster, as last loaded, or an empty one before
+// one is.
+func (q *updateQueue) currentRoster() streamerRoster {
+	q.rosterMu.RLock()
+	defer q.rosterMu.RUnlock()
+	if q.roster == nil {
+		return roster(nil)
+	}
+	return q.roster
+}
+
+// channels returns the channel of each streamer in the roster on the
+// platform, by login.
+func (q *updateQueue) channels(platform string) map[string]string {
+	return q.currentRoster().channels(platform)
+}
+
+// runPoller polls source for whether each of the roster's channels on its
+// platform is live every interval until the queue is done, and queues a
+// change whenever one goes live or offline. The first poll of a channel only
+// queues it if it's live, as it's unknown whether it was before, and a change
+// the queue can't accept is queued again on the next poll. With a shared queue
+// only the instance taking changes polls.
+func (q *updateQueue) runPoller(source statusSource, interval time.Duration) {
+	logger := log.WithField("event_id", source.platform()+"-poller")
+	known := map[string]bool{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if q.redis == nil || q.redis.isLeading() {
+			q.poll(source, known, logger)
+		}
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll polls source once for each of the roster's channels on its platform,
+// queueing a change for those that went live or offline since they were known
+// to be and recording them in known once the change is queued.
+func (q *updateQueue) poll(source statusSource, known map[string]bool, logger *log.Entry) {
+	for login, channel := range q.channels(source.platform()) {
+		live, err := source.live(channel, logger)
+		if err != nil {
+			logger.Printf("error polling %s for %s: %s\n", source.platform(), login, err)
+			continue
+		}
+		was, polled := known[channel]
+		if live == was || (!polled && !live) {
+			known[channel] = live
+			continue
+		}
+		accepted := q.enqueue(statusChange{
+			id:       fmt.Sprintf("%s-%s-%d", source.platform(), channel, time.Now().UnixNano()),
+			login:    login,
+			online:   live,
+			streamer: login,
+			userID:   platformUserID(source.platform(), channel),
+		})
+		if !accepted {
+			logger.Printf("error queueing %s change for %s: update queue unavailable\n", source.platform(), login)
+			continue
+		}
+		known[channel] = live
+	}
+}
+
+// platformHeadings are the headings of the index.md columns showing whether
+// streamers are live on each platform. Other platforms' columns are headed by
+// the platform's name.
+var platformHeadings = map[string]string{
+	platformTwitch:  "Twitch",
+	platformYouTube: "YouTube",
+	platformKick:    "Kick",
+	platformTrovo:   "Trovo",
+}
+
+// platformName returns the name the platform is shown under.
+func platformName(platform string) string {
+	if heading := platformHeadings[platform]; heading != "" {
+		return heading
+	}
+	return platform
+}
+
+// setPlatformStatus renders whether the streamer is live on the platform in
+// the platform's column, if index.md's table has one, in the status style, and
+// reports whether that changed it.
+func (s *StreamersRepo) setPlatformStatus(login, platform string, online bool) bool {
+	text, _ := render.SetCell(s.indexMdText, login, platformName(platform), s.style.Status(online))
+	if text == s.indexMdText {
+		return false
+	}
+	s.indexMdText = text
+	return true
+}
+
+// setLive records whether the streamer is live on the platform, and returns
+// whether they're live on any, which is what their row shows.
+func (s *StreamersRepo) setLive(login, platform string, online bool) bool {
+	login = strings.ToLower(login)
+	if s.live == nil {
+		s.live = map[string]map[string]bool{}
+	}
+	if s.live[login] == nil {
+		s.live[login] = map[string]bool{}
+	}
+	s.live[login][platform] = online
+	for _, live := range s.live[login] {
+		if live {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeSource is a statusSource reporting the channels in online as live, and
+// failing for those in failing.
+type fakeSource struct {
+	online  map[string]bool
+	failing map[string]bool
+}
+
+func (s *fakeSource) platform() string {
+	return platformKick
+}
+
+func (s *fakeSource) live(channel string, logger *log.Entry) (bool, error) {
+	if s.failing[channel] {
+		return false, errors.New("unavailable")
+	}
+	return s.online[channel], nil
+}
+
+// fakeRoster is a streamerRoster with the channels on each platform, by
+// login, and no links.
+type fakeRoster map[string]map[string]string
+
+func (r fakeRoster) channels(platform string) map[string]string {
+	return r[platform]
+}
+
+func (r fakeRoster) hasLinks() bool {
+	return false
+}
+
+func (r fakeRoster) setLinks(text string) string {
+	return text
+}
+
+// queued takes the changes waiting in the queue.
+func queued(q *updateQueue) []statusChange {
+	var changes []statusChange
+	for {
+		select {
+		case c := <-q.changes:
+			changes = append(changes, c)
+		default:
+			return changes
+		}
+	}
+}
+
+// expectQueued checks the changes waiting in the queue against want, by
+// login, status and user ID.
+func expectQueued(t *testing.T, q *updateQueue, want ...statusChange) {
+	t.Helper()
+	got := queued(q)
+	if len(got) != len(want) {
+		t.Fatalf("queued %+v, want %+v", got, want)
+	}
+	for i, c := range got {
+		if c.login != want[i].login || c.online != want[i].online || c.userID != want[i].userID {
+			t.Errorf("queued %+v, want %+v", c, want[i])
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	q := newUpdateQueue(&StreamersRepo{}, 1)
+	q.setRoster(fakeRoster{platformKick: {"alice": "alice_k", "bob": "bob_k", "carol": "carol_k"}})
+	source := &fakeSource{failing: map[string]bool{"carol_k": true}}
+	known := map[string]bool{}
+	logger := log.NewEntry(log.StandardLogger())
+
+	// The first poll only queues the channels that are live.
+	source.online = map[string]bool{"alice_k": true}
+	q.poll(source, known, logger)
+	expectQueued(t, q, statusChange{login: "alice", online: true, userID: "kick:alice_k"})
+	q.poll(source, known, logger)
+	expectQueued(t, q)
+
+	// Bob's change fills the queue, so alice's is refused until it's taken.
+	source.online = map[string]bool{"alice_k": true, "bob_k": true}
+	q.poll(source, known, logger)
+	source.online = map[string]bool{"bob_k": true}
+	q.poll(source, known, logger)
+	expectQueued(t, q, statusChange{login: "bob", online: true, userID: "kick:bob_k"})
+	q.poll(source, known, logger)
+	expectQueued(t, q, statusChange{login: "alice", online: false, userID: "kick:alice_k"})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Git hosting providers the site repository can live on.
+const (
+	providerGitHub = "github"
+	providerGitLab = "gitlab"
+	providerGitea  = "gitea"
+)
+
+// ciSkipMarkers are the commit message markers each provider recognises to
+// skip CI for the automated commits.
+var ciSkipMarkers = map[string]string{
+	providerGitHub: "[no ci]",
+	providerGitLab: "[skip ci]",
+	providerGitea:  "[skip ci]",
+}
+
+// providerRepoURL adjusts url for the provider's remote conventions. GitLab
+// only redirects project URLs without a .git suffix, which pushes don't
+// follow.
+func providerRepoURL(provider, url string) string {
+	if provider == providerGitLab && !isSSHURL(url) && !strings.HasSuffix(url, ".git") {
+		return strings.TrimRight(url, "/") + ".git"
+	}
+	return url
+}
+
+// giteaAPIURL returns the API base URL of the Gitea instance hosting url.
+func giteaAPIURL(url string) string {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return ""
+	}
+	return "https://" + endpoint.Host + "/api/v1"
+}
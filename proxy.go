@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+)
+
+// trustedProxies are the networks of reverse proxies, such as nginx or Cloud
+// Run's front end, whose X-Forwarded-For headers are believed.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses CIDRs and bare IP addresses.
+func parseTrustedProxies(list []string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", s)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusted reports whether the address is one of the proxies.
+func (p trustedProxies) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP returns the client's IP address. When the request came through
+// trusted proxies it is the last address in X-Forwarded-For that isn't one
+// of them, as addresses before it could have been sent by the client.
+func (p trustedProxies) realIP(r *http.Request) string {
+	ip := server.ClientIP(r)
+	if !p.trusted(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		if net.ParseIP(addr) == nil {
+			break
+		}
+		ip = addr
+		if !p.trusted(addr) {
+			break
+		}
+	}
+	return ip
+}
+
+// handler sets the RemoteAddr of requests through trusted proxies to the
+// client's address, so logs and rate limits see the client rather than the
+// proxy.
+func (p trustedProxies) handler(h http.Handler) http.Handler {
+	if len(p) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := p.realIP(r); ip != server.ClientIP(r) {
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// pullRequestBody is the description of the automated pull request.
+const pullRequestBody = "Automated stream status updates. New status changes are pushed to this branch until it is merged."
+
+// pullRequest is the subset of a pull request used here. GitHub and Gitea
+// use the same field names.
+type pullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+// pullRequestAPI lists and opens pull requests with a provider's API.
+type pullRequestAPI interface {
+	// openPullRequests returns the open pull requests from head into base.
+	openPullRequests(head, base string) ([]pullRequest, error)
+	// createPullRequest opens a pull request from head into base.
+	createPullRequest(head, base, title string) (*pullRequest, error)
+}
+
+// pullRequester opens a pull request from the status branch to the default
+// branch for repos where the default branch can't be pushed to directly.
+type pullRequester struct {
+	api    pullRequestAPI
+	branch string
+}
+
+// newPullRequester returns a pull requester for the configured repo and
+// provider, or nil when changes are pushed directly.
+func newPullRequester(cfg *config, auth transport.AuthMethod) (*pullRequester, error) {
+	if cfg.PushMode != "pull_request" {
+		return nil, nil
+	}
+	owner, repo, err := repoOwnerAndName(cfg.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	p := &pullRequester{branch: cfg.PullRequestBranch}
+	switch cfg.Provider {
+	case providerGitHub:
+		p.api = &githubPulls{
+			apiURL: strings.TrimRight(cfg.GitHubAPIURL, "/"),
+			owner:  owner,
+			repo:   repo,
+			token:  githubToken(cfg, auth),
+		}
+	case providerGitea:
+		p.api = &giteaPulls{
+			apiURL: strings.TrimRight(cfg.GiteaAPIURL, "/"),
+			owner:  owner,
+			repo:   repo,
+			token:  cfg.Token,
+		}
+	default:
+		return nil, fmt.Errorf("pull requests aren't supported for %s", cfg.Provider)
+	}
+	return p, nil
+}
+
+// ensurePullRequest opens a pull request from the status branch into base
+// unless one is already open. Pushing to the branch updates an open one.
+func (p *pullRequester) ensurePullRequest(base, title string) (*pullRequest, error) {
+	open, err := p.api.openPullRequests(p.branch, base)
+	if err != nil {
+		return nil, fmt.Errorf("error listing pull requests: %w", err)
+	}
+	if len(open) > 0 {
+		return &open[0], nil
+	}
+	created, err := p.api.createPullRequest(p.branch, base, title)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pull request: %w", err)
+	}
+	return created, nil
+}
+
+// repoOwnerAndName returns the owner and name of the repository at url.
+func repoOwnerAndName(url string) (string, string, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.SplitN(strings.Trim(endpoint.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("can't find owner and repo in %s", url)
+	}
+	return parts[0], strings.TrimSuffix(path.Base(parts[1]), ".git"), nil
+}
+
+// githubToken returns a function giving the token for GitHub API requests,
+// from the GitHub App when one is configured or the personal access token.
+func githubToken(cfg *config, auth transport.AuthMethod) func() (string, error) {
+	if app, ok := auth.(*githubAppAuth); ok {
+		return app.installationToken
+	}
+	return func() (string, error) { return cfg.Token, nil }
+}
+
+// githubPulls opens pull requests with the GitHub REST API.
+type githubPulls struct {
+	apiURL string
+	owner  string
+	repo   string
+	token  func() (string, error)
+}
+
+// header returns the headers for a GitHub API request.
+func (g *githubPulls) header() (http.Header, error) {
+	token, err := g.token()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("Accept", "application/vnd.github+json")
+	return header, nil
+}
+
+// openPullRequests returns the open pull requests from head into base.
+func (g *githubPulls) openPullRequests(head, base string) ([]pullRequest, error) {
+	header, err := g.header()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("head", g.owner+":"+head)
+	query.Set("base", base)
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/repos/%s/%s/pulls?%s", g.apiURL, g.owner, g.repo, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	var open []pullRequest
+	err = doRequest(req, &open)
+	return open, err
+}
+
+// createPullRequest opens a pull request from head into base.
+func (g *githubPulls) createPullRequest(head, base, title string) (*pullRequest, error) {
+	header, err := g.header()
+	if err != nil {
+		return nil, err
+	}
+	var created pullRequest
+	err = postJSONResponse(fmt.Sprintf("%s/repos/%s/%s/pulls", g.apiURL, g.owner, g.repo), map[string]string{
+		"title": title,
+		"head":  head,
+		"base":  base,
+		"body":  pullRequestBody,
+	}, header, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
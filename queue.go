@@ -0,0 +1,845 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/infosecstreams/StreamStatus/internal/gitops"
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// statusChange describes a streamer going online or offline.
+type statusChange struct {
+	// id is the EventSub message ID, used to correlate log lines.
+	id       string
+	login    string
+	online   bool
+	streamer string
+	userID   string
+	// queuedAt is when the change was first queued, kept across retries.
+	queuedAt time.Time
+	// rechecks is how many times the change has been checked against Helix
+	// again after disagreeing with it.
+	rechecks int
+	// notification is the verified EventSub notification the change was
+	// decoded from, if it came from one, so it can be replayed as delivered.
+	notification []byte
+}
+
+// Helix Get Streams lags behind EventSub, so a change that disagrees with it
+// is checked again up to unverifiedRechecks times, unverifiedRecheckDelay
+// apart, before it's dropped.
+const (
+	unverifiedRechecks     = 3
+	unverifiedRecheckDelay = time.Minute
+)
+
+// notificationQueueSize is how many notifications and alerts can wait to be
+// sent before more are dropped.
+const notificationQueueSize = 100
+
+// notificationsDropped counts the notifications and alerts dropped because
+// too many were waiting to be sent.
+var notificationsDropped = server.NewCounter("streamstatus_notifications_dropped_total", "Notifications and alerts dropped because too many were waiting to be sent.")
+
+// eventsProcessed counts the status changes processed by event type and the
+// outcome recorded for them.
+var eventsProcessed = server.NewCounter("streamstatus_events_processed_total", "Status changes processed, by event type and outcome.", "type", "outcome")
+
+// eventType returns the EventSub type of the change.
+func (c statusChange) eventType() string {
+	if c.online {
+		return "stream.online"
+	}
+	return "stream.offline"
+}
+
+// updateQueue serialises status changes so only one git operation runs at a time.
+type updateQueue struct {
+	mu     sync.Mutex
+	closed bool
+	// batchWindow is how long to wait for more changes to commit together.
+	batchWindow time.Duration
+	// calendar is the calendar of scheduled streams, if there is one.
+	calendar *calendar
+	changes  chan statusChange
+	// ciSkipMarker is added to the messages of commits other than status
+	// changes.
+	ciSkipMarker string
+	// deadLetters records changes that failed permanently or ran out of
+	// retries.
+	deadLetters *deadLetterLog
+	done        chan struct{}
+	// inactiveAfter is how long a streamer can be offline before their row
+	// is moved to the inactive page.
+	inactiveAfter time.Duration
+	// failed stores changes that couldn't be pushed to retry them later.
+	failed *retryQueue
+	// lastApplied is when the latest change applied for each user ID was
+	// queued, so retried changes don't undo newer ones.
+	lastApplied map[string]time.Time
+	notifiers   []notifier
+	// notifications are the sends to notifiers waiting for the notification
+	// worker, which runs alongside run so slow notifiers don't hold up
+	// changes. It's nil when run isn't running and sends are made at once.
+	notifications chan func()
+	// redis shares changes with other instances when set, so only one
+	// performs git operations at a time.
+	redis *redisQueue
+	repo  *StreamersRepo
+	// roster maps streamers to their channels on platforms that are polled.
+	rosterMu sync.RWMutex
+	roster   streamerRoster
+	// statuses persists the last status applied for each streamer.
+	statuses *statusStore
+	// scheduleInterval is how often the next scheduled streams are rendered,
+	// or 0 if they aren't.
+	scheduleInterval time.Duration
+	// lastLiveInterval is how often the last live column is rendered afresh,
+	// or 0 if it isn't rendered.
+	lastLiveInterval time.Duration
+	// summaryFilePath is where the weekly summary is written.
+	summaryFilePath string
+	// tasks are other repository updates run between changes, in the order
+	// they were scheduled, and taskReady is signalled when one is added.
+	tasks     []func()
+	taskReady chan struct{}
+	// team is the Twitch team whose members are added to index.md.
+	team   *teamRoster
+	twitch *twitchClient
+	// verifyStatus checks Twitch changes against Helix before applying them.
+	verifyStatus bool
+	// watchers are the gRPC clients watching status changes, if the gRPC API
+	// is served.
+	watchers *statusWatchers
+	// lastPush is the outcome of the latest attempt to publish a change, and
+	// pushFailures how many attempts in a row have failed.
+	pushMu       sync.Mutex
+	lastPush     pushResult
+	pushFailures int
+	// pushAlertAfter is how many pushes in a row must fail before alerting,
+	// or 0 to never alert.
+	pushAlertAfter int
+	// ready is failed while pushes keep failing, if the server is running.
+	ready *readiness
+}
+
+// pushResult is the outcome of publishing a change to the site repository.
+type pushResult struct {
+	At    time.Time
+	Event string
+	Error string
+}
+
+// newUpdateQueue returns a queue holding up to size pending changes for repo.
+func newUpdateQueue(repo *StreamersRepo, size int) *updateQueue {
+	return &updateQueue{
+		changes:     make(chan statusChange, size),
+		done:        make(chan struct{}),
+		lastApplied: map[string]time.Time{},
+		repo:        repo,
+		taskReady:   make(chan struct{}, 1),
+	}
+}
+
+// loadStatuses sets when the last change applied for each streamer was queued
+// from the status store, so changes retried after a restart can't undo newer
+// ones, and which platforms they're live on.
+func (q *updateQueue) loadStatuses() error {
+	statuses, err := q.statuses.all()
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		q.lastApplied[st.UserID] = st.ChangedAt
+		q.repo.setLive(st.Login, changePlatform(st.UserID), st.Online)
+	}
+	return nil
+}
+
+// enqueue adds a change to the queue, or the shared redis queue when there is
+// one, and returns false if it could not be accepted.
+func (q *updateQueue) enqueue(c statusChange) bool {
+	if c.queuedAt.IsZero() {
+		c.queuedAt = time.Now()
+	}
+	if q.redis == nil {
+		return q.enqueueLocal(c)
+	}
+	err := q.redis.push(c)
+	if err != nil {
+		log.WithField("event_id", c.id).Errorf("error adding change for %s to redis queue: %s", c.streamer, err)
+		return false
+	}
+	return true
+}
+
+// enqueueLocal adds a change to this instance's queue and returns false if it
+// could not be accepted.
+func (q *updateQueue) enqueueLocal(c statusChange) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.changes <- c:
+		return true
+	default:
+		log.WithField("event_id", c.id).Errorf("update queue is full, dropping change for %s", c.streamer)
+		return false
+	}
+}
+
+// schedule queues task to run between changes, after the tasks already
+// queued, and returns false if the queue is closed.
+func (q *updateQueue) schedule(task func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.tasks = append(q.tasks, task)
+	q.signalTask()
+	return true
+}
+
+// signalTask wakes run to take the next task. q.mu must be held.
+func (q *updateQueue) signalTask() {
+	select {
+	case q.taskReady <- struct{}{}:
+	default:
+	}
+}
+
+// nextTask removes and returns the first queued task, or nil if there is
+// none.
+func (q *updateQueue) nextTask() func() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		return nil
+	}
+	task := q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	// Changes get a turn between tasks.
+	if len(q.tasks) > 0 {
+		q.signalTask()
+	}
+	return task
+}
+
+// pendingTasks returns how many tasks are waiting to run.
+func (q *updateQueue) pendingTasks() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// scheduleTask schedules fn, which commits a change to the repository other
+// than a status change, and logs its outcome. With a shared queue only the
+// instance taking changes runs it, as it has the history. It returns false if
+// fn wasn't scheduled.
+func (q *updateQueue) scheduleTask(name string, fn func() error) bool {
+	if q.redis != nil && !q.redis.isLeading() {
+		return false
+	}
+	accepted := q.schedule(func() {
+		err := fn()
+		if errors.Is(err, ErrNoChangeNeeded) {
+			q.repo.logger.Warnf("%s made no changes, nothing to commit", name)
+			return
+		}
+		if err != nil {
+			q.repo.logger.Printf("error committing %s: %s\n", name, err)
+			reportChangeError(err, name, q.repo)
+			return
+		}
+		q.repo.logger.Printf("%s committed.\n", name)
+	})
+	if !accepted {
+		log.Errorf("couldn't schedule %s", name)
+	}
+	return accepted
+}
+
+// errQueueClosed is returned when a task is scheduled after shutdown began.
+var errQueueClosed = fmt.Errorf("update queue is shutting down")
+
+// errNotLeading is returned by runTask on an instance that isn't taking
+// changes from the shared queue.
+var errNotLeading = fmt.Errorf("another instance is taking changes")
+
+// runTask runs fn between changes, like scheduleTask, and waits for it to
+// finish or ctx to be done. fn carries on running if ctx is done first.
+func (q *updateQueue) runTask(ctx context.Context, fn func() error) error {
+	if q.redis != nil && !q.redis.isLeading() {
+		return errNotLeading
+	}
+	result := make(chan error, 1)
+	task := func() {
+		err := errTaskPanicked
+		defer func() { result <- err }()
+		err = fn()
+	}
+	if !q.schedule(task) {
+		return errQueueClosed
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run processes queued changes and tasks until the queue is closed and its
+// changes are drained.
+func (q *updateQueue) run() {
+	defer close(q.done)
+	q.notifications = make(chan func(), notificationQueueSize)
+	sent := make(chan struct{})
+	go q.sendNotifications(q.notifications, sent)
+	// The notifications already queued are sent before the queue is done.
+	defer func() {
+		close(q.notifications)
+		<-sent
+		q.notifications = nil
+	}()
+	for {
+		select {
+		case c, ok := <-q.changes:
+			if !ok {
+				return
+			}
+			batch := q.collect(c)
+			err := q.whileLeading(func() { q.process(batch) })
+			if err != nil {
+				log.Errorf("error taking leader lock, returning %d changes: %s", len(batch), err)
+				q.redis.returnChanges(batch)
+			}
+		case <-q.taskReady:
+			if task := q.nextTask(); task != nil {
+				err := q.whileLeading(func() { runRecovering("task", task) })
+				if err != nil {
+					log.Errorf("error taking leader lock, dropping task: %s", err)
+				}
+			}
+		}
+	}
+}
+
+// sendNotifications makes the sends queued in notifications one at a time
+// until it's closed, then closes sent.
+func (q *updateQueue) sendNotifications(notifications <-chan func(), sent chan<- struct{}) {
+	defer close(sent)
+	for send := range notifications {
+		runRecovering("notifications", send)
+	}
+}
+
+// queueNotification queues send for the notification worker, or makes it at
+// once when run isn't running. It returns false if too many sends are waiting
+// already.
+func (q *updateQueue) queueNotification(send func()) bool {
+	if q.notifications == nil {
+		send()
+		return true
+	}
+	select {
+	case q.notifications <- send:
+		return true
+	default:
+		notificationsDropped.Inc()
+		return false
+	}
+}
+
+// whileLeading runs fn, holding the shared queue's lock throughout if there
+// is one, so git sync, commit and push all happen on one instance at a time.
+// It returns an error without running fn if the lock couldn't be taken.
+func (q *updateQueue) whileLeading(fn func()) error {
+	if q.redis == nil {
+		fn()
+		return nil
+	}
+	return q.redis.hold(fn)
+}
+
+// collect returns c along with any changes queued within the batch window
+// after it, keeping only the latest change for each streamer.
+func (q *updateQueue) collect(c statusChange) []statusChange {
+	batch := []statusChange{c}
+	if q.batchWindow <= 0 {
+		return batch
+	}
+	timer := time.NewTimer(q.batchWindow)
+	defer timer.Stop()
+	for {
+		select {
+		case c, ok := <-q.changes:
+			if !ok {
+				return batch
+			}
+			batch = coalesce(batch, c)
+		case <-timer.C:
+			return batch
+		}
+	}
+}
+
+// coalesce adds c to batch, replacing any earlier change for the same streamer.
+func coalesce(batch []statusChange, c statusChange) []statusChange {
+	for i, b := range batch {
+		if b.userID == c.userID {
+			batch[i] = c
+			return batch
+		}
+	}
+	return append(batch, c)
+}
+
+// closeStores closes the retry queue and status database, if there are any.
+func (q *updateQueue) closeStores() {
+	if q.failed != nil {
+		err := q.failed.close()
+		if err != nil {
+			log.Printf("error closing retry queue: %s\n", err)
+		}
+	}
+	if q.statuses != nil {
+		err := q.statuses.close()
+		if err != nil {
+			log.Printf("error closing status database: %s\n", err)
+		}
+	}
+}
+
+// shutdown stops accepting changes and waits for the queued ones to be processed
+// or for ctx to expire.
+func (q *updateQueue) shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.changes)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// process looks up the stream details for a batch of changes, updates the
+// markdown, commits and pushes it, then sends notifications for the changes
+// that were made.
+func (q *updateQueue) process(batch []statusChange) {
+	repo := q.repo
+	// A panic dead-letters the batch rather than killing the worker.
+	defer func() {
+		if p := recover(); p != nil {
+			server.ReportPanic(sentry.CurrentHub(), "process", p)
+			err := fmt.Errorf("panic processing changes: %v", p)
+			q.deadLetter(batch, err, repo.logger)
+			q.recordEvents(batch, outcomeFailed, err, repo.logger)
+		}
+	}()
+	batch = q.dropStale(batch)
+	if q.verifyStatus && q.twitch != nil {
+		batch = q.dropUnverified(batch)
+	}
+	if len(batch) == 0 {
+		return
+	}
+	var ids []string
+	for _, c := range batch {
+		ids = append(ids, c.id)
+	}
+	repo.eventID = strings.Join(ids, ",")
+	repo.logger = log.WithField("event_id", repo.eventID)
+	repo.pending = nil
+	for _, c := range batch {
+		repo.pending = append(repo.pending, newNotification(c, q.twitch, repo.logger))
+	}
+	var err error
+	if repo.contents != nil {
+		err = q.processContents(repo)
+	} else {
+		err = repo.withCloneLock(func() error {
+			return q.processGit(repo)
+		})
+	}
+	noChange := errors.Is(err, ErrNoChangeNeeded)
+	if err != nil && !noChange {
+		if q.failed != nil && isRetryable(err) {
+			q.storeFailed(batch, repo.logger)
+			q.recordEvents(batch, outcomeRetrying, err, repo.logger)
+		} else {
+			q.deadLetter(batch, err, repo.logger)
+			q.recordEvents(batch, failedOutcome(err), err, repo.logger)
+		}
+		return
+	}
+	// Notifications are only sent once the change is pushed, not when
+	// pushing failed or another instance already pushed it.
+	if err == nil {
+		q.notifyApplied(repo)
+	}
+	for _, c := range batch {
+		q.lastApplied[c.userID] = c.queuedAt
+		outcome := outcomeNoChange
+		if err == nil && repo.wasApplied(c.login) {
+			outcome = outcomeUpdated
+		} else if n, ok := repo.wasNotFound(c.login); ok {
+			outcome = outcomeNotFound
+			repo.streamerNotFound(n)
+		}
+		q.recordEvents([]statusChange{c}, outcome, nil, repo.logger)
+		if q.statuses == nil {
+			continue
+		}
+		recordErr := q.statuses.record(c)
+		if recordErr != nil {
+			repo.logger.Printf("error recording status of %s: %s\n", c.streamer, recordErr)
+		}
+	}
+	if q.failed != nil {
+		err = q.failed.resolve(batch)
+		if err != nil {
+			repo.logger.Printf("error updating retry queue: %s\n", err)
+		}
+	}
+}
+
+// processGit updates, commits and pushes index.md in the local clone.
+func (q *updateQueue) processGit(repo *StreamersRepo) error {
+	err := updateMarkdown(repo)
+	if err == nil && repo.statsFilePath != "" {
+		// Stale stats are better than holding up the status change.
+		statsErr := q.writeStats(repo)
+		if statsErr != nil {
+			repo.logger.Printf("error writing %s: %s\n", repo.statsFilePath, statsErr)
+		}
+	}
+	if err == nil && q.lastLiveInterval > 0 {
+		// Likewise for the last live column, which is refreshed regularly.
+		text, lastLiveErr := q.setLastLive(repo.indexMdText, time.Now())
+		if lastLiveErr == nil && text != repo.indexMdText {
+			repo.indexMdText = text
+			lastLiveErr = repo.writefile(text)
+		}
+		if lastLiveErr != nil {
+			repo.logger.Printf("error updating last live column: %s\n", lastLiveErr)
+		}
+	}
+	if err == nil && repo.avatarDir != "" {
+		// Likewise for avatars, which are cached with the next change.
+		avatarErr := q.updateAvatars(repo)
+		if avatarErr != nil {
+			repo.logger.Printf("error updating avatars: %s\n", avatarErr)
+		}
+	}
+	if err == nil {
+		err = updateRepo(repo)
+	}
+	if err == nil {
+		err = pushRepo(repo)
+		// Nothing was pushed if the remote already had the changes.
+		if errors.Is(err, ErrNoChangeNeeded) {
+			return err
+		}
+		q.recordPush(repo.eventID, err)
+		if err != nil {
+			return &pushFailedError{err: err}
+		}
+	}
+	return err
+}
+
+// commitTask syncs the clone and calls update to change files in the
+// worktree, then commits the files at paths with the message update returns
+// and pushes them, starting again if the remote moved on. The id tags the log
+// lines like an event ID.
+func (q *updateQueue) commitTask(id string, update func() (string, error), paths ...string) error {
+	repo := q.repo
+	repo.eventID = id
+	repo.logger = log.WithField("event_id", repo.eventID)
+	repo.pending = nil
+	return repo.withCloneLock(func() error {
+		for attempt := 1; ; attempt++ {
+			err := repo.retry.do(repo.logger, "sync", repo.syncRepo)
+			if err != nil {
+				return err
+			}
+			message, err := update()
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				err = repo.addFile(path)
+				if err != nil {
+					return err
+				}
+			}
+			// The data file follows index.md, whichever task changed it.
+			if repo.dataFilePath != "" && repo.hasRepoFile(repo.dataFilePath) {
+				err = repo.addFile(repo.dataFilePath)
+				if err != nil {
+					return err
+				}
+			}
+			if q.ciSkipMarker != "" {
+				message += " " + q.ciSkipMarker
+			}
+			err = repo.commit(message)
+			if err != nil {
+				return err
+			}
+			err = repo.retry.do(repo.logger, "push", repo.gitPush)
+			if !errors.Is(err, gitops.ErrPushRejected) || attempt == maxPushAttempts {
+				q.recordPush(id, err)
+				return err
+			}
+			repo.logger.Warnf("remote has new commits, retrying %s (attempt %d)", id, attempt+1)
+		}
+	})
+}
+
+// pushFailedError wraps the error pushing a change, as opposed to preparing
+// it, so the events are recorded as push_failed.
+type pushFailedError struct {
+	err error
+}
+
+// Error returns the push error's message.
+func (e *pushFailedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the push error.
+func (e *pushFailedError) Unwrap() error {
+	return e.err
+}
+
+// failedOutcome returns the outcome of events whose change failed with err.
+func failedOutcome(err error) string {
+	var pushErr *pushFailedError
+	if errors.As(err, &pushErr) {
+		return outcomePushFailed
+	}
+	return outcomeFailed
+}
+
+// recordPush stores the outcome of pushing the change for the event. Only
+// pushes are recorded, not the steps preparing the change.
+func (q *updateQueue) recordPush(eventID string, err error) {
+	result := pushResult{At: time.Now(), Event: eventID}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	q.pushMu.Lock()
+	q.lastPush = result
+	before := q.pushFailures
+	q.pushFailures = 0
+	if err != nil {
+		q.pushFailures = before + 1
+	}
+	after := q.pushFailures
+	q.pushMu.Unlock()
+	q.alertPushFailures(before, after, err)
+}
+
+// alertPushFailures alerts through the notifiers and fails readiness when
+// pushes have failed pushAlertAfter times in a row, going from before to
+// after failures, and alerts again once one succeeds.
+func (q *updateQueue) alertPushFailures(before, after int, err error) {
+	if q.pushAlertAfter == 0 {
+		return
+	}
+	logger := log.WithField("event_id", "push-alert")
+	if after == q.pushAlertAfter {
+		logger.Errorf("pushing has failed %d times in a row: %s", after, err)
+		if q.ready != nil {
+			q.ready.setPushFailing(true)
+		}
+		q.alert(fmt.Sprintf("StreamStatus couldn't push status changes to the site %d times in a row: %s", after, err), logger)
+	}
+	if after == 0 && before >= q.pushAlertAfter {
+		logger.Printf("pushing works again after %d failures\n", before)
+		if q.ready != nil {
+			q.ready.setPushFailing(false)
+		}
+		q.alert(fmt.Sprintf("StreamStatus is pushing status changes to the site again after %d failures.", before), logger)
+	}
+}
+
+// alert queues the message to be sent through the notifiers that alert.
+func (q *updateQueue) alert(message string, logger *log.Entry) {
+	notifiers := q.notifiers
+	if !q.queueNotification(func() { alertAll(notifiers, message, logger) }) {
+		logger.Errorf("notification queue is full, dropping alert: %s", message)
+	}
+}
+
+// pushed returns the outcome of the latest attempt to publish a change.
+func (q *updateQueue) pushed() pushResult {
+	q.pushMu.Lock()
+	defer q.pushMu.Unlock()
+	return q.lastPush
+}
+
+// dropStale removes changes queued before the last change applied for the
+// same streamer, which happens when a failed change is retried.
+func (q *updateQueue) dropStale(batch []statusChange) []statusChange {
+	var fresh []statusChange
+	for _, c := range batch {
+		if c.queuedAt.Before(q.lastApplied[c.userID]) {
+			logger := log.WithField("event_id", c.id)
+			logger.Warnf("dropping change for %s superseded by a newer one", c.streamer)
+			q.recordEvents([]statusChange{c}, outcomeSuperseded, nil, logger)
+			continue
+		}
+		fresh = append(fresh, c)
+	}
+	return fresh
+}
+
+// dropUnverified removes Twitch changes that disagree with whether Helix Get
+// Streams says the streamer is live, which happens when events arrive late or
+// out of order. As Helix also lags behind events, a change is only dropped
+// once it still disagrees after being rechecked, and is queued again later
+// until then. Changes are kept if Helix can't be reached.
+func (q *updateQueue) dropUnverified(batch []statusChange) []statusChange {
+	var userIDs []string
+	for _, c := range batch {
+		if changePlatform(c.userID) == platformTwitch {
+			userIDs = append(userIDs, c.userID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return batch
+	}
+	logger := log.WithField("event_id", batch[0].id)
+	streams, err := q.twitch.getLiveStreams(userIDs, logger)
+	if err != nil {
+		logger.Printf("error verifying status changes, applying them anyway: %s\n", err)
+		return batch
+	}
+	var verified []statusChange
+	for _, c := range batch {
+		_, live := streams[c.userID]
+		if changePlatform(c.userID) == platformTwitch && live != c.online {
+			logger := log.WithField("event_id", c.id)
+			if c.rechecks < unverifiedRechecks {
+				logger.Warnf("deferring change for %s: event says online=%t but Helix says online=%t, checking again in %s", c.streamer, c.online, live, unverifiedRecheckDelay)
+				q.recheckLater(c, logger)
+				continue
+			}
+			logger.Warnf("skipping change for %s: event says online=%t but Helix still says online=%t", c.streamer, c.online, live)
+			q.recordEvents([]statusChange{c}, outcomeUnverified, nil, logger)
+			continue
+		}
+		verified = append(verified, c)
+	}
+	return verified
+}
+
+// recheckLater queues c again after unverifiedRecheckDelay to be checked
+// against Helix once more, dead-lettering it if it can't be queued.
+func (q *updateQueue) recheckLater(c statusChange, logger *log.Entry) {
+	c.rechecks++
+	time.AfterFunc(unverifiedRecheckDelay, func() {
+		if !q.enqueue(c) {
+			err := fmt.Errorf("couldn't be queued to be verified again")
+			q.deadLetter([]statusChange{c}, err, logger)
+			q.recordEvents([]statusChange{c}, outcomeFailed, err, logger)
+		}
+	})
+}
+
+// storeFailed stores changes in the retry queue.
+func (q *updateQueue) storeFailed(batch []statusChange, logger *log.Entry) {
+	err := q.failed.add(batch)
+	if err != nil {
+		logger.Printf("error storing changes to retry: %s\n", err)
+		return
+	}
+	logger.Warnf("stored %d change(s) to retry later", len(batch))
+}
+
+// deadLetter records changes that won't be retried in the dead-letter log, if
+// there is one.
+func (q *updateQueue) deadLetter(batch []statusChange, reason error, logger *log.Entry) {
+	if q.deadLetters == nil {
+		return
+	}
+	err := q.deadLetters.add(batch, reason)
+	if err != nil {
+		logger.Printf("error writing dead letters: %s\n", err)
+		return
+	}
+	logger.Errorf("dead-lettered %d change(s): %s", len(batch), reason)
+}
+
+// recordEvents counts the outcome of processing changes, and adds it to the
+// event history if there is one.
+func (q *updateQueue) recordEvents(changes []statusChange, outcome string, reason error, logger *log.Entry) {
+	for _, c := range changes {
+		eventsProcessed.Inc(c.eventType(), outcome)
+	}
+	if q.statuses == nil {
+		return
+	}
+	for _, c := range changes {
+		err := q.statuses.recordEvent(c, outcome, reason)
+		if err != nil {
+			logger.Printf("error recording event history: %s\n", err)
+		}
+	}
+}
+
+// notifyApplied queues notifications for each change made to index.md.
+func (q *updateQueue) notifyApplied(repo *StreamersRepo) {
+	notifiers, logger := q.notifiers, repo.logger
+	for _, n := range repo.applied {
+		n := n
+		if !q.queueNotification(func() { notifyAll(notifiers, n, logger) }) {
+			logger.Errorf("notification queue is full, dropping notification for %s", n.Streamer)
+		}
+		if q.watchers != nil {
+			q.watchers.publish(n)
+		}
+	}
+}
+
+// processContents updates index.md with the GitHub Contents API.
+func (q *updateQueue) processContents(repo *StreamersRepo) error {
+	var pushErr error
+	err := updateContents(repo, func(err error) {
+		pushErr = err
+		q.recordPush(repo.eventID, err)
+	})
+	if errors.Is(err, ErrNoChangeNeeded) {
+		return err
+	}
+	if err != nil && pushErr != nil {
+		err = &pushFailedError{err: err}
+	}
+	if err != nil {
+		repo.logger.Printf("error updating index.md with the github api: %s\n", err)
+		reportChangeError(err, "contents", repo)
+		return err
+	}
+	repo.logger.Println("remote repo updated.", repo.indexFilePath)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+)
+
+// getLiveStreams returns the live streams of the broadcasters with the user
+// IDs, by user ID.
+func (t *twitchClient) getLiveStreams(userIDs []string, logger *log.Entry) (map[string]helix.Stream, error) {
+	streams := map[string]helix.Stream{}
+	// Helix looks up to 100 streams at a time.
+	for start := 0; start < len(userIDs); start += 100 {
+		end := start + 100
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		var resp *helix.StreamsResponse
+		err := t.do(logger, "twitch stream lookup", func() error {
+			var err error
+			resp, err = t.client.GetStreams(&helix.StreamsParams{UserIDs: userIDs[start:end], First: 100})
+			if err != nil {
+				return err
+			}
+			return helixError(resp.StatusCode, "error getting streams", resp.ErrorMessage)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Data.Streams {
+			streams[s.UserID] = s
+		}
+	}
+	return streams, nil
+}
+
+// reconcile looks up whether each streamer in index.md is live on Twitch and
+// queues a change for each whose row disagrees, such as after a missed event.
+// It returns how many changes were queued.
+func (q *updateQueue) reconcile() (int, error) {
+	repo := q.repo
+	if q.twitch == nil || repo.contents != nil {
+		return 0, fmt.Errorf("reconciling needs the Twitch app credentials and the git backend")
+	}
+	err := repo.withCloneLock(func() error {
+		err := repo.retry.do(repo.logger, "sync", repo.syncRepo)
+		if err != nil {
+			return err
+		}
+		return repo.readFile()
+	})
+	if err != nil {
+		return 0, err
+	}
+	users, err := q.twitch.getUsersByLogin(rosterLogins(repo.indexMdText), repo.logger)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	streams, err := q.twitch.getLiveStreams(ids, repo.logger)
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	for _, u := range users {
+		_, live := streams[u.ID]
+		// Rows also show streamers live on other platforms.
+		expected := live
+		for platform, online := range repo.live[strings.ToLower(u.Login)] {
+			if platform != platformTwitch && online {
+				expected = true
+			}
+		}
+		online, ok := render.RowOnline(repo.indexMdText, u.Login)
+		if !ok || online == expected {
+			continue
+		}
+		repo.logger.Printf("%s is shown as online: %v but is online: %v, queueing a change\n", u.Login, online, expected)
+		accepted := q.enqueue(statusChange{
+			id:       fmt.Sprintf("reconcile-%s-%d", u.Login, time.Now().UnixNano()),
+			login:    u.Login,
+			online:   live,
+			streamer: u.DisplayName,
+			userID:   u.ID,
+		})
+		if accepted {
+			queued++
+		}
+	}
+	return queued, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/infosecstreams/StreamStatus/internal/server"
+)
+
+// workerRestartDelay is how long a worker that panicked waits before it's
+// started again, so one panicking on every run doesn't spin.
+const workerRestartDelay = 10 * time.Second
+
+// errTaskPanicked is returned by runTask when the task panicked.
+var errTaskPanicked = fmt.Errorf("task panicked")
+
+// runRecovering calls fn, reporting a panic in it rather than letting it
+// kill the process. It returns whether fn panicked.
+func runRecovering(where string, fn func()) (panicked bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			server.ReportPanic(sentry.CurrentHub(), where, p)
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// goWorker runs fn in a goroutine, starting it again after a delay if it
+// panics.
+func goWorker(where string, fn func()) {
+	go func() {
+		for runRecovering(where, fn) {
+			time.Sleep(workerRestartDelay)
+		}
+	}()
+}
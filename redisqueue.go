@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// redisPollInterval is how long a redis worker waits before trying for the
+// lock again, and the longest it blocks waiting for a change.
+const redisPollInterval = time.Second
+
+// leaderLock decides which instance takes changes off the shared queue.
+type leaderLock interface {
+	// lock takes or extends the lock and reports whether this instance
+	// holds it.
+	lock() (bool, error)
+	// unlock releases the lock if this instance holds it.
+	unlock() error
+}
+
+// lockScript takes the lock, or extends it when this instance already holds
+// it, returning nil if another instance holds it.
+var lockScript = redis.NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
+`)
+
+// unlockScript releases the lock if this instance holds it.
+var unlockScript = redis.NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// redisQueue shares status changes between instances through a Redis list.
+// Any instance can add changes, but only the one holding the lock takes them
+// off the list, so only one performs git operations at a time.
+type redisQueue struct {
+	key    string
+	leader leaderLock
+	// leading is 1 while this instance holds the lock.
+	leading int32
+	pool    *redis.Pool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// redisLock is a leaderLock held by setting a key in Redis that expires
+// unless it is extended.
+type redisLock struct {
+	id   string
+	key  string
+	pool *redis.Pool
+	ttl  time.Duration
+}
+
+// newRedisQueue returns a queue using the configured Redis server, or nil when
+// none is configured. Instances take turns with a lock in Redis unless a
+// Kubernetes lease is configured.
+func newRedisQueue(cfg *config) (*redisQueue, error) {
+	if cfg.RedisURL == "" {
+		return nil, nil
+	}
+	lockTTL, err := time.ParseDuration(cfg.RedisLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if lockTTL <= redisPollInterval {
+		return nil, fmt.Errorf("redis lock ttl must be longer than %s: %s", redisPollInterval, lockTTL)
+	}
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(cfg.RedisURL)
+		},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("PING")
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	r := &redisQueue{
+		key:     cfg.RedisPrefix + ":queue",
+		pool:    pool,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	lease, err := newLeaseLock(cfg)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if lease != nil {
+		r.leader = lease
+	} else {
+		r.leader = &redisLock{
+			id:   instanceID(),
+			key:  cfg.RedisPrefix + ":lock",
+			pool: pool,
+			ttl:  lockTTL,
+		}
+	}
+	return r, nil
+}
+
+// instanceID returns an identifier for this process, unique across hosts.
+func instanceID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// push adds c to the shared list.
+func (r *redisQueue) push(c statusChange) error {
+	data, err := json.Marshal(newStoredChange(c))
+	if err != nil {
+		return err
+	}
+	conn := r.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("LPUSH", r.key, data)
+	return err
+}
+
+// pushBack returns c to the end of the list it is taken from, so it is next.
+func (r *redisQueue) pushBack(c statusChange) error {
+	data, err := json.Marshal(newStoredChange(c))
+	if err != nil {
+		return err
+	}
+	conn := r.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("RPUSH", r.key, data)
+	return err
+}
+
+// pop takes the oldest change off the list, waiting up to redisPollInterval
+// for one, and returns false if there was none.
+func (r *redisQueue) pop() (statusChange, bool, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	reply, err := redis.ByteSlices(conn.Do("BRPOP", r.key, int(redisPollInterval/time.Second)))
+	if errors.Is(err, redis.ErrNil) {
+		return statusChange{}, false, nil
+	}
+	if err != nil {
+		return statusChange{}, false, err
+	}
+	var s storedChange
+	err = json.Unmarshal(reply[1], &s)
+	if err != nil {
+		return statusChange{}, false, err
+	}
+	return s.change(), true, nil
+}
+
+// lock takes or extends the lock and reports whether this instance holds it.
+func (l *redisLock) lock() (bool, error) {
+	conn := l.pool.Get()
+	defer conn.Close()
+	reply, err := lockScript.Do(conn, l.key, l.id, int64(l.ttl/time.Millisecond))
+	return reply != nil, err
+}
+
+// unlock releases the lock if this instance holds it.
+func (l *redisLock) unlock() error {
+	conn := l.pool.Get()
+	defer conn.Close()
+	_, err := unlockScript.Do(conn, l.key, l.id)
+	return err
+}
+
+// wait sleeps for redisPollInterval and returns false if stopped meanwhile.
+func (r *redisQueue) wait() bool {
+	select {
+	case <-r.stop:
+		return false
+	case <-time.After(redisPollInterval):
+		return true
+	}
+}
+
+// run moves changes from the shared list to q while this instance holds the
+// lock, until stopped.
+func (r *redisQueue) run(q *updateQueue) {
+	defer close(r.stopped)
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		held, err := r.leader.lock()
+		if err != nil {
+			log.Printf("error taking leader lock: %s\n", err)
+		}
+		var leading int32
+		if held {
+			leading = 1
+		}
+		atomic.StoreInt32(&r.leading, leading)
+		// Leave changes for another instance until this one can take them.
+		if !held || len(q.changes) == cap(q.changes) {
+			if !r.wait() {
+				return
+			}
+			continue
+		}
+		c, ok, err := r.pop()
+		if err != nil {
+			log.Printf("error reading redis queue: %s\n", err)
+			if !r.wait() {
+				return
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !q.enqueueLocal(c) {
+			err = r.pushBack(c)
+			if err != nil {
+				log.WithField("event_id", c.id).Errorf("error returning change for %s to redis queue: %s", c.streamer, err)
+			}
+			// Try again once the queue has room, unless stopped meanwhile.
+			if !r.wait() {
+				return
+			}
+		}
+	}
+}
+
+// hold runs fn while extending the lock, so it isn't lost partway through an
+// update however long that takes, even after run has stopped. It returns
+// errNotLeading without running fn if another instance holds the lock.
+func (r *redisQueue) hold(fn func()) error {
+	held, err := r.leader.lock()
+	if err != nil {
+		return err
+	}
+	if !held {
+		atomic.StoreInt32(&r.leading, 0)
+		return errNotLeading
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(redisPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := r.leader.lock()
+				if err != nil {
+					log.Printf("error extending leader lock: %s\n", err)
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	fn()
+	return nil
+}
+
+// returnChanges puts batch back on the shared list in the order it was taken,
+// for the instance holding the lock.
+func (r *redisQueue) returnChanges(batch []statusChange) {
+	for i := len(batch) - 1; i >= 0; i-- {
+		c := batch[i]
+		err := r.pushBack(c)
+		if err != nil {
+			log.WithField("event_id", c.id).Errorf("error returning change for %s to redis queue: %s", c.streamer, err)
+		}
+	}
+}
+
+// isLeading reports whether this instance held the lock when last checked.
+func (r *redisQueue) isLeading() bool {
+	return atomic.LoadInt32(&r.leading) == 1
+}
+
+// shutdown stops taking changes from the shared list.
+func (r *redisQueue) shutdown() {
+	close(r.stop)
+	<-r.stopped
+}
+
+// close releases the lock so another instance can take over, and closes the
+// connections.
+func (r *redisQueue) close() error {
+	err := r.leader.unlock()
+	if err != nil {
+		r.pool.Close()
+		return err
+	}
+	return r.pool.Close()
+}
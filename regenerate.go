@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// regeneratePages commits index.md, and the inactive page if there is one,
+// laid out in full with pages from their rows. Streamers in r on neither page
+// get a new row and everyone's links from r are rendered. Each Twitch
+// streamer in the status store has their status set from it, and duplicate
+// rows are dropped. It returns a NoChangeNeededError if the pages are already
+// what they'd be regenerated as.
+func (q *updateQueue) regeneratePages(pages *render.Templates, r roster) error {
+	repo := q.repo
+	if repo.contents != nil {
+		return fmt.Errorf("regenerating the pages needs the git backend")
+	}
+	online := map[string]bool{}
+	if q.statuses != nil {
+		statuses, err := q.statuses.all()
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			if changePlatform(st.UserID) == platformTwitch {
+				online[strings.ToLower(st.Login)] = st.Online
+				online[strings.ToLower(st.Streamer)] = st.Online
+			}
+		}
+	}
+	logins := make([]string, 0, len(r))
+	for login := range r {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	return q.commitTask("render", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		oldIndex, oldInactive := repo.indexMdText, repo.inactiveMdText
+		for _, login := range logins {
+			_, err = repo.addRow(notification{Login: login, Streamer: login})
+			if err != nil {
+				return "", err
+			}
+		}
+		repo.indexMdText = r.setLinks(repo.indexMdText)
+		repo.inactiveMdText = r.setLinks(repo.inactiveMdText)
+		index, err := regeneratePage(pages, repo.style, "index.md", repo.indexMdText, online)
+		if err != nil {
+			return "", err
+		}
+		inactive := repo.inactiveMdText
+		if repo.hasInactivePage() {
+			inactive, err = regeneratePage(pages, repo.style, "inactive.md", inactive, online)
+			if err != nil {
+				return "", err
+			}
+		}
+		if index == oldIndex && inactive == oldInactive {
+			return "", &NoChangeNeededError{err: "pages are already up to date"}
+		}
+		repo.indexMdText, repo.inactiveMdText = index, inactive
+		err = repo.writeFiles()
+		if err != nil {
+			return "", err
+		}
+		err = repo.addFile(repo.indexFilePath)
+		if err == nil && repo.hasInactivePage() {
+			err = repo.addFile(repo.inactiveFilePath)
+		}
+		return "🏗️ Regenerated the streamer list", err
+	})
+}
+
+// regeneratePage lays out the page, index.md or inactive.md, from the rows in
+// text's managed region sorted by name, with their status from online where
+// it has them written in style.
+func regeneratePage(pages *render.Templates, style render.Style, page, text string, online map[string]bool) (string, error) {
+	var rows []render.Row
+	seen := map[string]bool{}
+	for _, row := range render.ParseRows(render.Managed(text)) {
+		name := strings.ToLower(row.Name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if live, ok := online[name]; ok {
+			row.Online = live
+		}
+		row.Status = style.Status(row.Online)
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return strings.ToLower(rows[i].Name) < strings.ToLower(rows[j].Name)
+	})
+	rendered, err := pages.Render(page, render.Headings(render.Managed(text)), rows)
+	if err != nil {
+		return "", err
+	}
+	spliced, err := render.Splice(text, rendered)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", page, err)
+	}
+	return spliced, nil
+}
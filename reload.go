@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+// reloader applies the settings that can change without a restart: the
+// roster, notifiers, broadcaster filters, live only setting, log level and
+// commit author and templates. Secrets and everything else need a restart.
+type reloader struct {
+	// mu serialises reloads from signals and the admin endpoint.
+	mu      sync.Mutex
+	handler *webhookHandler
+	queue   *updateQueue
+}
+
+// reload loads the config, including the config file and roster again, and
+// applies the settings that can change. Nothing is applied if any are
+// invalid.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	streamers, err := loadRoster(cfg)
+	if err != nil {
+		return fmt.Errorf("error loading roster: %s", err)
+	}
+	notifiers, err := newNotifiers(cfg)
+	if err != nil {
+		return fmt.Errorf("error setting up notifiers: %s", err)
+	}
+	templates := &StreamersRepo{}
+	err = templates.loadCommitTemplates(cfg)
+	if err != nil {
+		return err
+	}
+	// The repo and notifiers are only used between changes, so the old
+	// notifiers are closed once the notifications queued for them are sent.
+	accepted := r.queue.schedule(func() {
+		repo := r.queue.repo
+		repo.authorName, repo.authorEmail = templates.authorName, templates.authorEmail
+		repo.onlineMessage, repo.offlineMessage = templates.onlineMessage, templates.offlineMessage
+		repo.newRow, repo.autoAddRows = templates.newRow, templates.autoAddRows
+		repo.footer, repo.footerLocation = templates.footer, templates.footerLocation
+		old := r.queue.notifiers
+		r.queue.notifiers = notifiers
+		if !r.queue.queueNotification(func() { closeNotifiers(old) }) {
+			closeNotifiers(old)
+		}
+	})
+	if !accepted {
+		closeNotifiers(notifiers)
+		return errQueueClosed
+	}
+	r.queue.setRoster(streamers)
+	if streamers.hasLinks() && r.queue.repo.contents == nil {
+		r.queue.scheduleTask("roster links", r.queue.updateRosterLinks)
+	}
+	r.handler.setSettings(newBroadcasterFilter(cfg), cfg.LiveOnly)
+	err = setLogLevel(cfg)
+	if err != nil {
+		return err
+	}
+	log.Println("config reloaded.")
+	return nil
+}
+
+// reloadConfig reloads the config, for POST requests.
+func (h *adminHandler) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	err := h.reloader.reload()
+	if err != nil {
+		log.Printf("error reloading config: %s\n", err)
+		server.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("error reloading config: %s", err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
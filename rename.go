@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// A rename that fails in a way that can be retried is scheduled again up to
+// renameRetries times, renameRetryDelay apart.
+const (
+	renameRetries    = 5
+	renameRetryDelay = time.Minute
+)
+
+// scheduleRename schedules the rename of the streamer with the user ID, as
+// attempt, scheduling it again later if it fails in a way that can be
+// retried. It returns false if it wasn't scheduled.
+func (q *updateQueue) scheduleRename(userID, login, streamer string, attempt int) bool {
+	return q.scheduleTask("rename of "+streamer, func() error {
+		err := q.renameStreamer(userID, login, streamer)
+		if err != nil && isRetryable(err) && attempt <= renameRetries {
+			q.repo.logger.Warnf("retrying rename of %s in %s (attempt %d)", streamer, renameRetryDelay, attempt+1)
+			time.AfterFunc(renameRetryDelay, func() {
+				q.scheduleRename(userID, login, streamer, attempt+1)
+			})
+		}
+		return err
+	})
+}
+
+// renameStreamer rewrites the rows of the streamer with the user ID for its
+// new login and display name, then updates its stored status and history so
+// later events match. The old login is only known from the status database.
+func (q *updateQueue) renameStreamer(userID, login, streamer string) error {
+	st, ok, err := q.statuses.get(userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &NoChangeNeededError{err: "no status stored for user ID " + userID}
+	}
+	if st.Login == login && st.Streamer == streamer {
+		return &NoChangeNeededError{err: "no rename needed for " + streamer}
+	}
+	repo := q.repo
+	err = q.commitTask("rename-"+userID, func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		var renamed, renamedInactive bool
+		repo.indexMdText, renamed = render.RenameRow(repo.indexMdText, st.Login, login, streamer)
+		repo.inactiveMdText, renamedInactive = render.RenameRow(repo.inactiveMdText, st.Login, login, streamer)
+		if !renamed && !renamedInactive {
+			return "", &NoChangeNeededError{err: "no row for " + st.Login, cause: ErrStreamerNotFound}
+		}
+		repo.logger.Printf("renaming %s to %s\n", st.Streamer, streamer)
+		err = repo.writeFiles()
+		if err != nil {
+			return "", err
+		}
+		err = repo.addFile(repo.indexFilePath)
+		if err == nil && repo.hasInactivePage() {
+			err = repo.addFile(repo.inactiveFilePath)
+		}
+		return fmt.Sprintf("✏️ Renamed %s to %s", st.Streamer, streamer), err
+	})
+	// Store the new names even if no row had them, so later events match.
+	if err != nil && !errors.Is(err, ErrNoChangeNeeded) {
+		return err
+	}
+	return q.statuses.rename(userID, login, streamer)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/infosecstreams/StreamStatus/internal/gitops"
+	log "github.com/sirupsen/logrus"
+)
+
+// retryPolicy retries transient failures with exponential backoff and jitter.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	// jitter is the most random delay added to each backoff.
+	jitter time.Duration
+}
+
+// jitterRand supplies the random jitter. It is seeded once as the global
+// math/rand source is deterministic.
+var jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// newRetryPolicy returns the retry policy described by cfg.
+func newRetryPolicy(cfg *config) (retryPolicy, error) {
+	p := retryPolicy{maxAttempts: int(cfg.RetryMaxAttempts)}
+	var err error
+	if p.baseDelay, err = time.ParseDuration(cfg.RetryBaseDelay); err != nil {
+		return p, fmt.Errorf("invalid retry base delay: %s", err)
+	}
+	if p.maxDelay, err = time.ParseDuration(cfg.RetryMaxDelay); err != nil {
+		return p, fmt.Errorf("invalid retry max delay: %s", err)
+	}
+	if p.jitter, err = time.ParseDuration(cfg.RetryJitter); err != nil {
+		return p, fmt.Errorf("invalid retry jitter: %s", err)
+	}
+	if p.baseDelay < 0 || p.maxDelay < 0 || p.jitter < 0 {
+		return p, fmt.Errorf("retry delays must not be negative")
+	}
+	return p, nil
+}
+
+// backoff returns the delay before the given retry, starting from 1.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	delay := p.baseDelay
+	for i := 1; i < retry && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	if p.jitter > 0 {
+		jitterRand.Lock()
+		delay += time.Duration(jitterRand.Int63n(int64(p.jitter)))
+		jitterRand.Unlock()
+	}
+	return delay
+}
+
+// do calls fn until it succeeds, returns an error that retrying won't fix or
+// the attempts run out, and returns the last error.
+func (p retryPolicy) do(logger *log.Entry, operation string, fn func() error) error {
+	err := fn()
+	for attempt := 1; err != nil && isRetryable(err) && attempt < p.maxAttempts; attempt++ {
+		delay := p.backoff(attempt)
+		logger.Warnf("%s failed, retrying in %s (attempt %d of %d): %s", operation, delay, attempt+1, p.maxAttempts, err)
+		time.Sleep(delay)
+		err = fn()
+	}
+	return err
+}
+
+// isRetryable reports whether err may be transient. Errors caused by the
+// credentials, the state of the repository or the change itself are not.
+func isRetryable(err error) bool {
+	for _, permanent := range []error{
+		transport.ErrAuthenticationRequired, transport.ErrAuthorizationFailed,
+		transport.ErrRepositoryNotFound, transport.ErrInvalidAuthMethod,
+		git.NoErrAlreadyUpToDate, ErrNoChangeNeeded, gitops.ErrPushRejected,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	var helixErr *helixPermanentError
+	if errors.As(err, &helixErr) {
+		return false
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// failedBucket holds the changes waiting to be retried, keyed by event ID.
+var failedBucket = []byte("failed")
+
+// retryQueue persists status changes that couldn't be pushed so they can be
+// retried in the background, surviving restarts.
+type retryQueue struct {
+	db       *bolt.DB
+	expiry   time.Duration
+	interval time.Duration
+}
+
+// storedChange is a status change as stored in the retry queue.
+type storedChange struct {
+	ID       string    `json:"id"`
+	Login    string    `json:"login"`
+	Online   bool      `json:"online"`
+	Streamer string    `json:"streamer"`
+	UserID   string    `json:"user_id"`
+	QueuedAt time.Time `json:"queued_at"`
+	Rechecks int       `json:"rechecks,omitempty"`
+	// Notification is the EventSub notification the change came from.
+	Notification json.RawMessage `json:"notification,omitempty"`
+}
+
+// newStoredChange returns c in the form it is stored.
+func newStoredChange(c statusChange) storedChange {
+	return storedChange{
+		ID:           c.id,
+		Login:        c.login,
+		Online:       c.online,
+		Streamer:     c.streamer,
+		UserID:       c.userID,
+		QueuedAt:     c.queuedAt,
+		Rechecks:     c.rechecks,
+		Notification: c.notification,
+	}
+}
+
+// change returns the status change that s stores.
+func (s storedChange) change() statusChange {
+	return statusChange{
+		id:           s.ID,
+		login:        s.Login,
+		online:       s.Online,
+		streamer:     s.Streamer,
+		userID:       s.UserID,
+		queuedAt:     s.QueuedAt,
+		rechecks:     s.Rechecks,
+		notification: s.Notification,
+	}
+}
+
+// newRetryQueue opens the retry queue database at path, or returns nil when
+// no path is configured.
+func newRetryQueue(cfg *config) (*retryQueue, error) {
+	if cfg.RetryQueuePath == "" {
+		return nil, nil
+	}
+	interval, err := time.ParseDuration(cfg.RetryQueueInterval)
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := time.ParseDuration(cfg.RetryQueueExpiry)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(cfg.RetryQueuePath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(failedBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &retryQueue{db: db, expiry: expiry, interval: interval}, nil
+}
+
+// add stores changes to be retried later.
+func (r *retryQueue) add(changes []statusChange) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(failedBucket)
+		for _, c := range changes {
+			data, err := json.Marshal(newStoredChange(c))
+			if err != nil {
+				return err
+			}
+			err = b.Put([]byte(c.id), data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resolve removes stored changes that are superseded by the given changes,
+// which have been applied: any for the same streamer queued no later.
+func (r *retryQueue) resolve(changes []statusChange) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(failedBucket)
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var s storedChange
+			if err := json.Unmarshal(v, &s); err != nil {
+				// Drop entries that can't be read rather than retry them forever.
+				stale = append(stale, k)
+				return nil
+			}
+			for _, c := range changes {
+				if s.UserID == c.userID && !s.QueuedAt.After(c.queuedAt) {
+					stale = append(stale, k)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// take removes the stored changes and returns them, separating those older
+// than the expiry.
+func (r *retryQueue) take() (changes, expired []statusChange, err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(failedBucket)
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			var s storedChange
+			if err := json.Unmarshal(v, &s); err != nil {
+				return nil
+			}
+			if time.Since(s.QueuedAt) > r.expiry {
+				log.WithField("event_id", s.ID).Errorf("giving up on change for %s queued at %s", s.Streamer, s.QueuedAt)
+				expired = append(expired, s.change())
+				return nil
+			}
+			changes = append(changes, s.change())
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return changes, expired, err
+}
+
+// run re-queues stored changes on q every interval until q is done. Changes
+// that fail again are stored again by q, and expired ones are dead-lettered.
+func (r *retryQueue) run(q *updateQueue) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+		changes, expired, err := r.take()
+		if err != nil {
+			log.Printf("error reading retry queue: %s\n", err)
+			continue
+		}
+		if len(expired) > 0 {
+			q.deadLetter(expired, fmt.Errorf("not applied within %s", r.expiry), log.NewEntry(log.StandardLogger()))
+		}
+		var rejected []statusChange
+		for _, c := range changes {
+			log.WithField("event_id", c.id).Warnf("retrying change for %s", c.streamer)
+			if !q.enqueue(c) {
+				rejected = append(rejected, c)
+			}
+		}
+		if len(rejected) > 0 {
+			err = r.add(rejected)
+			if err != nil {
+				log.Printf("error storing changes to retry: %s\n", err)
+			}
+		}
+	}
+}
+
+// close closes the retry queue database.
+func (r *retryQueue) close() error {
+	return r.db.Close()
+}
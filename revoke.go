@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+)
+
+// authorizationsRevoked counts user.authorization.revoke events.
+var authorizationsRevoked = server.NewCounter("streamstatus_authorizations_revoked_total", "Streamers revoking the app's authorization.")
+
+// subscriptionsRevoked counts EventSub subscriptions Twitch revoked.
+var subscriptionsRevoked = server.NewCounter("streamstatus_subscriptions_revoked_total", "EventSub subscriptions revoked by Twitch, by type and status.", "type", "status")
+
+// subscriptionRevoked records Twitch revoking a subscription in a revocation
+// message, such as when the user was banned or the webhook kept failing. The
+// streamer's events stop until they're subscribed again.
+func (h *webhookHandler) subscriptionRevoked(logger *log.Entry, s helix.EventSubSubscription) {
+	logger.Errorf("twitch revoked the %s subscription %s for %s: %s", s.Type, s.ID, twitch.SubscriptionUserID(s), s.Status)
+	subscriptionsRevoked.Inc(s.Type, s.Status)
+}
+
+// subscribeRevocations subscribes the webhook at callback to
+// user.authorization.revoke events for the app's client ID, if it isn't
+// already.
+func (t *twitchClient) subscribeRevocations(callback, secret string, logger *log.Entry) error {
+	subscription := &helix.EventSubSubscription{
+		Type:      "user.authorization.revoke",
+		Version:   "1",
+		Condition: helix.EventSubCondition{ClientID: t.clientID},
+		Transport: helix.EventSubTransport{Method: "webhook", Callback: callback, Secret: secret},
+	}
+	return t.do(logger, "eventsub subscription", func() error {
+		resp, err := t.client.CreateEventSubSubscription(subscription)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusConflict {
+			return nil
+		}
+		err = helixError(resp.StatusCode, "error subscribing to user.authorization.revoke", resp.ErrorMessage)
+		if err == nil {
+			t.recordUsage(-1, resp.Data.TotalCost, resp.Data.MaxTotalCost, logger)
+		}
+		return err
+	})
+}
+
+// revokeAuthorization records a streamer revoking the app's authorization in
+// a user.authorization.revoke event, so the features that needed it failing
+// later can be traced back to it.
+func (h *webhookHandler) revokeAuthorization(logger *log.Entry, eventID string, e helix.EventSubUserAuthenticationRevokeEvent) {
+	// The login and name are left out when the user was deleted.
+	streamer := e.UserName
+	if streamer == "" {
+		streamer = e.UserID
+	}
+	logger.Errorf("%s revoked the app's authorization, its subscriptions needing it have stopped", streamer)
+	authorizationsRevoked.Inc()
+	if h.queue.twitch != nil {
+		h.queue.twitch.forgetUser(e.UserID)
+	}
+	if h.queue.statuses == nil {
+		return
+	}
+	err := h.queue.statuses.recordRevocation(revocation{
+		UserID:    e.UserID,
+		Login:     e.UserLogin,
+		Streamer:  e.UserName,
+		RevokedAt: time.Now(),
+		EventID:   eventID,
+	})
+	if err != nil {
+		logger.Printf("error recording revocation by %s: %s\n", streamer, err)
+	}
+}
+
+// revocations returns the streamers who revoked the app's authorization as
+// JSON.
+func (h *adminHandler) revocations(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	revoked, err := h.statuses.revocations()
+	if err != nil {
+		log.Printf("error reading revocations: %s\n", err)
+		server.WriteError(w, http.StatusInternalServerError, "error reading revocations")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revoked)
+}
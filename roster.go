@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// addRow adds an offline row for the streamer to index.md when they're on
+// neither page, reporting whether it did.
+func (s *StreamersRepo) addRow(n notification) (bool, error) {
+	if render.HasRow(s.indexMdText, n.Login) || render.HasRow(s.inactiveMdText, n.Login) {
+		return false, nil
+	}
+	columns, err := renderTemplate(s.newRow, n)
+	if err != nil {
+		return false, err
+	}
+	s.indexMdText = render.InsertRow(s.indexMdText, n.Login, s.style.Offline+" | "+columns)
+	return true, nil
+}
+
+// moveToInactive moves the streamer's row from index.md to the inactive page,
+// reporting whether it was moved.
+func (s *StreamersRepo) moveToInactive(login string) bool {
+	text, row, ok := render.RemoveRow(s.indexMdText, login)
+	if !ok {
+		return false
+	}
+	s.indexMdText = text
+	s.inactiveMdText = render.AppendRow(s.inactiveMdText, row)
+	return true
+}
+
+// restoreFromInactive moves the streamer's row back from the inactive page to
+// index.md, if it is only on the inactive page, reporting whether it was moved.
+func (s *StreamersRepo) restoreFromInactive(login string) bool {
+	if render.HasRow(s.indexMdText, login) {
+		return false
+	}
+	text, row, ok := render.RemoveRow(s.inactiveMdText, login)
+	if !ok {
+		return false
+	}
+	s.inactiveMdText = text
+	s.indexMdText = render.AppendRow(s.indexMdText, row)
+	return true
+}
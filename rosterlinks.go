@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+)
+
+// linkIcons are the Font Awesome icons links are rendered with in columns
+// with these headings, like the Twitch link in new rows.
+var linkIcons = map[string]string{
+	"discord":  "fab fa-discord",
+	"github":   "fab fa-github",
+	"mastodon": "fab fa-mastodon",
+	"twitter":  "fab fa-twitter",
+	"youtube":  "fab fa-youtube",
+}
+
+// linkCell renders a streamer's link or handle in the column with the
+// heading. Links are shown as the column's icon, or its heading if it has
+// none, and handles as they are.
+func linkCell(heading, value string) string {
+	// Cells are split on every pipe, escaped or not.
+	value = strings.ReplaceAll(value, "|", "&#124;")
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	text := heading
+	if icon := linkIcons[strings.ToLower(heading)]; icon != "" {
+		text = `<i class="` + icon + `"></i>`
+	}
+	return "[" + text + "](" + value + ")"
+}
+
+// hasLinks reports whether any streamer in the roster has links.
+func (r roster) hasLinks() bool {
+	for _, entry := range r {
+		if len(entry.Links) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// setLinks renders the links of each streamer in the roster in the columns of
+// text with their headings.
+func (r roster) setLinks(text string) string {
+	for login, entry := range r {
+		headings := make([]string, 0, len(entry.Links))
+		for heading := range entry.Links {
+			headings = append(headings, heading)
+		}
+		sort.Strings(headings)
+		for _, heading := range headings {
+			text, _ = render.SetCell(text, login, heading, linkCell(heading, entry.Links[heading]))
+		}
+	}
+	return text
+}
+
+// updateRosterLinks commits the links in the roster rendered in index.md and
+// the inactive page, so they're edited in the roster rather than by hand.
+func (q *updateQueue) updateRosterLinks() error {
+	repo := q.repo
+	if repo.contents != nil {
+		return fmt.Errorf("rendering the roster's links needs the git backend")
+	}
+	r := q.currentRoster()
+	return q.commitTask("roster links", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		index, inactive := r.setLinks(repo.indexMdText), r.setLinks(repo.inactiveMdText)
+		if index == repo.indexMdText && inactive == repo.inactiveMdText {
+			return "", &NoChangeNeededError{err: "no change in the roster's links"}
+		}
+		repo.indexMdText, repo.inactiveMdText = index, inactive
+		err = repo.writeFiles()
+		if err != nil {
+			return "", err
+		}
+		err = repo.addFile(repo.indexFilePath)
+		if err == nil && repo.hasInactivePage() {
+			err = repo.addFile(repo.inactiveFilePath)
+		}
+		return "🔗 Updated streamers' links from the roster", err
+	})
+}
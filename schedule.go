@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduleHeading is the heading of the index.md column next streams are
+// rendered in.
+const scheduleHeading = "Next stream"
+
+// scheduleTimeFormat is how the start of the next stream is rendered.
+const scheduleTimeFormat = "Mon 2 Jan 15:04 MST"
+
+// scheduleSegment is a scheduled stream.
+type scheduleSegment struct {
+	ID            string    `json:"id"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	Title         string    `json:"title"`
+	CanceledUntil string    `json:"canceled_until"`
+	Category      *struct {
+		Name string `json:"name"`
+	} `json:"category"`
+}
+
+// getSchedule returns the scheduled streams of the broadcaster with the user
+// ID, starting with the next, up to first of them.
+func (t *twitchClient) getSchedule(userID string, first int, logger *log.Entry) ([]scheduleSegment, error) {
+	var resp struct {
+		Data struct {
+			Segments []scheduleSegment `json:"segments"`
+		} `json:"data"`
+	}
+	query := url.Values{"broadcaster_id": {userID}, "first": {fmt.Sprint(first)}}
+	err := t.helixGet(logger, "twitch schedule lookup", "/schedule", query, &resp)
+	// Broadcasters without a schedule aren't found.
+	if hasStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var segments []scheduleSegment
+	for _, s := range resp.Data.Segments {
+		if s.CanceledUntil == "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments, nil
+}
+
+// getUsersByLogin returns the users with the logins, caching them.
+func (t *twitchClient) getUsersByLogin(logins []string, logger *log.Entry) ([]helix.User, error) {
+	var users []helix.User
+	// Helix looks up to 100 users at a time.
+	for start := 0; start < len(logins); start += 100 {
+		end := start + 100
+		if end > len(logins) {
+			end = len(logins)
+		}
+		var resp *helix.UsersResponse
+		err := t.do(logger, "twitch user lookup", func() error {
+			var err error
+			resp, err = t.client.GetUsers(&helix.UsersParams{Logins: logins[start:end]})
+			if err != nil {
+				return err
+			}
+			return helixError(resp.StatusCode, "error getting users", resp.ErrorMessage)
+		})
+		if err != nil {
+			return nil, err
+		}
+		t.mu.Lock()
+		for _, u := range resp.Data.Users {
+			t.users[u.ID] = cachedUser{user: u, fetched: time.Now()}
+		}
+		t.mu.Unlock()
+		users = append(users, resp.Data.Users...)
+	}
+	return users, nil
+}
+
+// rosterLogins returns the logins of the streamers with rows in text.
+func rosterLogins(text string) []string {
+	var logins []string
+	for _, line := range strings.Split(text, "\n") {
+		if login := render.RowLogin(line); login != "" {
+			logins = append(logins, strings.ToLower(login))
+		}
+	}
+	return logins
+}
+
+// updateSchedules renders the start of each streamer's next scheduled stream
+// in index.md's next stream column, for the streamers with the logins or for
+// everyone when there are none.
+func (q *updateQueue) updateSchedules(logins ...string) error {
+	repo := q.repo
+	return q.commitTask("schedules", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		if len(logins) == 0 {
+			logins = rosterLogins(repo.indexMdText)
+		}
+		users, err := q.twitch.getUsersByLogin(logins, repo.logger)
+		if err != nil {
+			return "", err
+		}
+		text := repo.indexMdText
+		for _, u := range users {
+			segments, err := q.twitch.getSchedule(u.ID, 1, repo.logger)
+			if err != nil {
+				return "", err
+			}
+			var cell string
+			if len(segments) > 0 {
+				cell = segments[0].StartTime.UTC().Format(scheduleTimeFormat)
+			}
+			text, _ = render.SetCell(text, u.Login, scheduleHeading, cell)
+		}
+		if text == repo.indexMdText {
+			return "", &NoChangeNeededError{err: "no change in the next streams"}
+		}
+		repo.indexMdText = text
+		return "📅 Updated the next scheduled streams", repo.writefile(repo.indexMdText)
+	}, repo.indexFilePath)
+}
+
+// updateSchedulesAndCalendar renders everyone's next streams and then the
+// calendar, if there is one, in the same task. It returns the error updating
+// the next streams, logging the calendar's, unless only the calendar failed
+// or changed.
+func (q *updateQueue) updateSchedulesAndCalendar() error {
+	err := q.updateSchedules()
+	if q.calendar == nil {
+		return err
+	}
+	calendarErr := q.updateCalendar()
+	switch {
+	case errors.Is(err, ErrNoChangeNeeded):
+		return calendarErr
+	case err == nil && errors.Is(calendarErr, ErrNoChangeNeeded):
+		return nil
+	case err == nil:
+		return calendarErr
+	case calendarErr != nil && !errors.Is(calendarErr, ErrNoChangeNeeded):
+		q.repo.logger.Printf("error committing calendar: %s\n", calendarErr)
+	}
+	return err
+}
+
+// runScheduleUpdates renders everyone's next streams, and the calendar if
+// there is one, now and then every interval until the queue is done.
+func (q *updateQueue) runScheduleUpdates(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		q.scheduleTask("next streams", q.updateSchedulesAndCalendar)
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
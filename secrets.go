@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// secretEnvNames are the variables holding secrets, which can be read from
+// the file named by the variable with _FILE appended instead, such as Docker
+// and Kubernetes secrets.
+var secretEnvNames = []string{
+	"SS_ADMIN_TOKEN",
+	"SS_BLUESKY_PASSWORD",
+	"SS_DISCORD_WEBHOOKS",
+	"SS_GH_APP_PRIVATE_KEY",
+	"SS_KICK_CLIENT_SECRET",
+	"SS_MASTODON_TOKEN",
+	"SS_MATRIX_TOKEN",
+	"SS_MQTT_PASSWORD",
+	"SS_OUTBOUND_WEBHOOK_SECRET",
+	"SS_REDIS_URL",
+	"SS_SECRETKEY",
+	"SS_SECRETKEY_SECONDARY",
+	"SS_SENTRY_DSN",
+	"SS_SIGNING_KEY",
+	"SS_SIGNING_KEY_PASSPHRASE",
+	"SS_SLACK_WEBHOOKS",
+	"SS_SSH_KEY",
+	"SS_SSH_KEY_PASSPHRASE",
+	"SS_TELEGRAM_TOKEN",
+	"SS_TOKEN",
+	"SS_TWITCH_CLIENT_SECRET",
+	"SS_VAULT_TOKEN",
+	"SS_YOUTUBE_API_KEY",
+}
+
+// loadSecrets sets the secret variables that are unset from their files, then
+// the variables that are still unset from the Vault secret at SS_VAULT_PATH
+// if SS_VAULT_ADDR is set.
+func loadSecrets() error {
+	for _, name := range secretEnvNames {
+		envNames[name+"_FILE"] = true
+		path := os.Getenv(name + "_FILE")
+		if path == "" || os.Getenv(name) != "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s_FILE: %s", name, err)
+		}
+		os.Setenv(name, strings.TrimRight(string(data), "\r\n"))
+	}
+	for _, name := range []string{"SS_VAULT_ADDR", "SS_VAULT_PATH"} {
+		envNames[name] = true
+	}
+	if os.Getenv("SS_VAULT_ADDR") == "" {
+		return nil
+	}
+	secrets, err := readVaultSecret(os.Getenv("SS_VAULT_ADDR"), os.Getenv("SS_VAULT_PATH"), os.Getenv("SS_VAULT_TOKEN"))
+	if err != nil {
+		return fmt.Errorf("error reading vault secret: %s", err)
+	}
+	for name, value := range secrets {
+		if strings.HasPrefix(name, "SS_") && os.Getenv(name) == "" {
+			os.Setenv(name, value)
+		}
+	}
+	return nil
+}
+
+// readVaultSecret reads the key/value secret at path from the Vault server at
+// addr, such as secret/data/streamstatus for version 2 of the key/value
+// engine, whose keys are variable names.
+func readVaultSecret(addr, path, token string) (map[string]string, error) {
+	if path == "" || token == "" {
+		return nil, fmt.Errorf("no SS_VAULT_PATH and/or SS_VAULT_TOKEN specified in environment")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err = doRequest(req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	data := resp.Data
+	// Version 2 nests the secret's data beside its metadata.
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	secrets := map[string]string{}
+	for name, value := range data {
+		if s, ok := value.(string); ok {
+			secrets[name] = s
+		}
+	}
+	return secrets, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	sentryhttp "github.com/getsentry/sentry-go/http"
+)
+
+const (
+	// sentryFlushTimeout is how long to wait for buffered events on exit.
+	sentryFlushTimeout = 2 * time.Second
+	// verifyFailureReportInterval reports every Nth consecutive signature
+	// verification failure to Sentry rather than each one.
+	verifyFailureReportInterval = 5
+)
+
+// setupSentry initialises the Sentry client when a DSN is configured.
+// Without a DSN the capture functions below are no-ops.
+func setupSentry(cfg *config) error {
+	if cfg.SentryDSN == "" {
+		return nil
+	}
+	return sentry.Init(sentry.ClientOptions{
+		Dsn:         cfg.SentryDSN,
+		Environment: cfg.SentryEnvironment,
+	})
+}
+
+// sentryHandler wraps h so panics while handling requests are reported.
+func sentryHandler(h http.Handler) http.Handler {
+	return sentryhttp.New(sentryhttp.Options{Repanic: true}).Handle(h)
+}
+
+// reportChangeError sends err to Sentry tagged with the changes being processed.
+func reportChangeError(err error, operation string, repo *StreamersRepo) {
+	online := map[string]bool{}
+	for _, n := range repo.pending {
+		online[n.Streamer] = n.Online
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("operation", operation)
+		scope.SetTag("event_id", repo.eventID)
+		scope.SetExtra("online", online)
+		scope.SetExtra("repo", repo.url)
+		sentry.CaptureException(err)
+	})
+}
+
+// reportVerifyFailures sends a message to Sentry when signature verification
+// has failed count times in a row.
+func reportVerifyFailures(count int32, r *http.Request) {
+	if count%verifyFailureReportInterval != 0 {
+		return
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetRequest(r)
+		scope.SetExtra("consecutive_failures", count)
+		scope.SetTag("event_id", r.Header.Get("Twitch-Eventsub-Message-Id"))
+		sentry.CaptureMessage("repeated EventSub signature verification failures")
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSignatureNamespace is the namespace git uses for SSH commit signatures.
+const sshSignatureNamespace = "git"
+
+// loadSigningKey reads the configured commit signing key and sets it on s.
+func (s *StreamersRepo) loadSigningKey(cfg *config) error {
+	if cfg.SigningFormat == "" {
+		return nil
+	}
+	keyBytes := []byte(cfg.SigningKey)
+	if len(keyBytes) == 0 {
+		var err error
+		keyBytes, err = os.ReadFile(cfg.SigningKeyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch cfg.SigningFormat {
+	case "gpg":
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyBytes))
+		if err != nil {
+			return err
+		}
+		if len(entities) == 0 {
+			return fmt.Errorf("no keys found in gpg signing key")
+		}
+		entity := entities[0]
+		if entity.PrivateKey == nil {
+			return fmt.Errorf("gpg signing key has no private key")
+		}
+		if entity.PrivateKey.Encrypted {
+			err = entity.PrivateKey.Decrypt([]byte(cfg.SigningKeyPassphrase))
+			if err != nil {
+				return err
+			}
+		}
+		s.gpgSignKey = entity
+	case "ssh":
+		var signer ssh.Signer
+		var err error
+		if cfg.SigningKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(cfg.SigningKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(keyBytes)
+		}
+		if err != nil {
+			return err
+		}
+		s.sshSigner = signer
+	default:
+		return fmt.Errorf("unknown signing format: %s", cfg.SigningFormat)
+	}
+	return nil
+}
+
+// signHeadSSH replaces the commit at HEAD with a copy carrying an SSH signature.
+func (s *StreamersRepo) signHeadSSH() error {
+	ref, err := s.repo.Head()
+	if err != nil {
+		return err
+	}
+	commit, err := s.repo.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+
+	unsigned := s.repo.Storer.NewEncodedObject()
+	err = commit.EncodeWithoutSignature(unsigned)
+	if err != nil {
+		return err
+	}
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	message, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	commit.PGPSignature, err = sshSign(s.sshSigner, message)
+	if err != nil {
+		return err
+	}
+
+	signed := s.repo.Storer.NewEncodedObject()
+	err = commit.Encode(signed)
+	if err != nil {
+		return err
+	}
+	hash, err := s.repo.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return err
+	}
+	return s.repo.Storer.SetReference(plumbing.NewHashReference(ref.Name(), hash))
+}
+
+// sshSign returns an armored SSHSIG signature of message, the format git
+// stores in the gpgsig header for SSH signed commits.
+func sshSign(signer ssh.Signer, message []byte) (string, error) {
+	digest := sha512.Sum512(message)
+	signedData := ssh.Marshal(struct {
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Hash      string
+	}{sshSignatureNamespace, "", "sha512", string(digest[:])})
+	signedData = append([]byte("SSHSIG"), signedData...)
+
+	var sig *ssh.Signature
+	var err error
+	// RSA keys must use SHA-2 rather than the legacy ssh-rsa SHA-1 algorithm.
+	if algSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = algSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, signedData)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := ssh.Marshal(struct {
+		Version   uint32
+		PublicKey string
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Signature string
+	}{1, string(signer.PublicKey().Marshal()), sshSignatureNamespace, "", "sha512", string(ssh.Marshal(sig))})
+	blob = append([]byte("SSHSIG"), blob...)
+
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var armored strings.Builder
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n-----END SSH SIGNATURE-----\n")
+	return armored.String(), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/server"
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+)
+
+// simulate builds a stream.online or stream.offline notification for the
+// streamer in the query, signs it with the webhook secret and hands it to the
+// webhook handler as if Twitch had delivered it, so the whole pipeline can be
+// exercised without going live. The query takes the type, defaulting to
+// stream.online, the login, and optionally the user_id, name and stream_type.
+func (h *adminHandler) simulate(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		server.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	login := query.Get("login")
+	if login == "" {
+		server.WriteError(w, http.StatusBadRequest, "missing login")
+		return
+	}
+	eventType := query.Get("type")
+	if eventType == "" {
+		eventType = "stream.online"
+	}
+	userID := query.Get("user_id")
+	if userID == "" {
+		userID = login
+	}
+	name := query.Get("name")
+	if name == "" {
+		name = login
+	}
+	var event interface{}
+	switch eventType {
+	case "stream.online":
+		streamType := query.Get("stream_type")
+		if streamType == "" {
+			streamType = "live"
+		}
+		event = helix.EventSubStreamOnlineEvent{
+			ID:                   fmt.Sprint(time.Now().UnixNano()),
+			BroadcasterUserID:    userID,
+			BroadcasterUserLogin: login,
+			BroadcasterUserName:  name,
+			Type:                 streamType,
+			StartedAt:            helix.Time{Time: time.Now().UTC()},
+		}
+	case "stream.offline":
+		event = helix.EventSubStreamOfflineEvent{
+			BroadcasterUserID:    userID,
+			BroadcasterUserLogin: login,
+			BroadcasterUserName:  name,
+		}
+	default:
+		server.WriteError(w, http.StatusBadRequest, "type must be stream.online or stream.offline")
+		return
+	}
+	body, err := json.Marshal(struct {
+		Subscription helix.EventSubSubscription `json:"subscription"`
+		Event        interface{}                `json:"event"`
+	}{
+		Subscription: helix.EventSubSubscription{
+			Type:      eventType,
+			Version:   "1",
+			Status:    "enabled",
+			Condition: helix.EventSubCondition{BroadcasterUserID: userID},
+		},
+		Event: event,
+	})
+	if err != nil {
+		log.Printf("error building simulated event: %s\n", err)
+		server.WriteError(w, http.StatusInternalServerError, "error building simulated event")
+		return
+	}
+	id := fmt.Sprintf("simulated-%d", time.Now().UnixNano())
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	mac := hmac.New(sha256.New, []byte(h.webhook.secret))
+	mac.Write([]byte(id + timestamp + string(body)))
+	req, err := http.NewRequest(http.MethodPost, r.URL.Path, bytes.NewReader(body))
+	if err != nil {
+		server.WriteError(w, http.StatusInternalServerError, "error building simulated event")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Twitch-Eventsub-Message-Id", id)
+	req.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+	req.Header.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("Twitch-Eventsub-Message-Type", twitch.MessageTypeNotification)
+	req.Header.Set("Twitch-Eventsub-Subscription-Type", eventType)
+	log.WithField("event_id", id).Printf("simulating %s for %s\n", eventType, login)
+	h.webhook.eventsubStatus(w, req)
+}
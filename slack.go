@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// slackNotifier posts go-live and offline messages to Slack incoming webhooks.
+type slackNotifier struct {
+	// webhooks receive messages for every streamer.
+	webhooks []string
+	// streamers maps a lowercase login to webhooks for that streamer only.
+	streamers map[string][]string
+}
+
+// newSlackNotifier returns a notifier for the global and per-streamer Slack
+// webhooks in cfg, or nil if none are configured.
+func newSlackNotifier(cfg *config) *slackNotifier {
+	s := &slackNotifier{
+		webhooks:  cfg.SlackWebhooks,
+		streamers: map[string][]string{},
+	}
+	for login, sc := range cfg.Streamers {
+		if len(sc.SlackWebhooks) > 0 {
+			s.streamers[strings.ToLower(login)] = sc.SlackWebhooks
+		}
+	}
+	if len(s.webhooks) == 0 && len(s.streamers) == 0 {
+		return nil
+	}
+	return s
+}
+
+// slackMessage is the body of a Slack incoming webhook request.
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// slackBlock is a Block Kit layout block.
+type slackBlock struct {
+	Type      string      `json:"type"`
+	Text      *slackText  `json:"text,omitempty"`
+	Elements  []slackText `json:"elements,omitempty"`
+	Accessory *slackImage `json:"accessory,omitempty"`
+}
+
+// slackText is a Block Kit text object.
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackImage is a Block Kit image element.
+type slackImage struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+// notify posts a message to the global webhooks and any for the streamer.
+func (s *slackNotifier) notify(n notification) error {
+	webhooks := append(append([]string{}, s.webhooks...), s.streamers[strings.ToLower(n.Login)]...)
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	var msg slackMessage
+	if n.Online {
+		msg.Text = fmt.Sprintf("%s is live! %s", n.Streamer, n.URL)
+		section := slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf(":red_circle: *<%s|%s>* is live!", n.URL, n.Streamer)},
+		}
+		if n.Title != "" {
+			section.Text.Text += "\n>" + n.Title
+		}
+		if n.ThumbnailURL != "" {
+			section.Accessory = &slackImage{Type: "image", ImageURL: n.ThumbnailURL, AltText: n.Title}
+		}
+		msg.Blocks = append(msg.Blocks, section)
+		if n.Game != "" {
+			msg.Blocks = append(msg.Blocks, slackBlock{
+				Type:     "context",
+				Elements: []slackText{{Type: "mrkdwn", Text: fmt.Sprintf("Playing *%s*", n.Game)}},
+			})
+		}
+	} else {
+		msg.Text = fmt.Sprintf("%s has gone offline.", n.Streamer)
+		msg.Blocks = append(msg.Blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: fmt.Sprintf(":black_circle: *<%s|%s>* has gone offline.", n.URL, n.Streamer)},
+		})
+	}
+
+	var failed []string
+	for _, url := range webhooks {
+		err := postJSON(url, msg, nil)
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("slack: %d of %d webhooks failed: %v", len(failed), len(webhooks), failed)
+	}
+	return nil
+}
+
+// alert posts the message to the global webhooks.
+func (s *slackNotifier) alert(message string) error {
+	msg := slackMessage{
+		Text:   message,
+		Blocks: []slackBlock{{Type: "section", Text: &slackText{Type: "mrkdwn", Text: message}}},
+	}
+	var failed []string
+	for _, url := range s.webhooks {
+		err := postJSON(url, msg, nil)
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("slack: %d of %d webhooks failed: %v", len(failed), len(s.webhooks), failed)
+	}
+	return nil
+}
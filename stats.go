@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statsWindows are the periods hours streamed are totalled over, with the
+// headings they are rendered under.
+var statsWindows = []struct {
+	heading string
+	period  time.Duration
+}{
+	{"Last 7 days", 7 * 24 * time.Hour},
+	{"Last 30 days", 30 * 24 * time.Hour},
+}
+
+// statsHistory is how far back events are read to find the sessions in the
+// longest window, allowing for streams that started before it.
+const statsHistory = 31 * 24 * time.Hour
+
+// streamSession is a period a streamer was live.
+type streamSession struct {
+	login    string
+	streamer string
+	start    time.Time
+	end      time.Time
+}
+
+// streamHours is the time a streamer was live during a window.
+type streamHours struct {
+	// login is in lower case.
+	login    string
+	streamer string
+	hours    float64
+}
+
+// buildSessions pairs each streamer's online and offline events, oldest
+// first, into sessions. A session without an offline event yet ends now.
+func buildSessions(events []historyEvent, now time.Time) []streamSession {
+	var sessions []streamSession
+	open := map[string]*streamSession{}
+	for _, e := range events {
+		login := strings.ToLower(e.Login)
+		if e.Type == "stream.online" {
+			if open[login] == nil {
+				open[login] = &streamSession{login: login, streamer: e.Streamer, start: e.QueuedAt}
+			}
+			continue
+		}
+		if s := open[login]; s != nil {
+			s.end = e.QueuedAt
+			sessions = append(sessions, *s)
+			delete(open, login)
+		}
+	}
+	for _, s := range open {
+		s.end = now
+		sessions = append(sessions, *s)
+	}
+	return sessions
+}
+
+// hoursStreamed totals the time each streamer was live between from and to,
+// most hours first.
+func hoursStreamed(sessions []streamSession, from, to time.Time) []streamHours {
+	totals := map[string]time.Duration{}
+	names := map[string]string{}
+	for _, s := range sessions {
+		start, end := s.start, s.end
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		totals[s.login] += end.Sub(start)
+		names[s.login] = s.streamer
+	}
+	var hours []streamHours
+	for login, total := range totals {
+		hours = append(hours, streamHours{login: login, streamer: names[login], hours: total.Hours()})
+	}
+	sort.Slice(hours, func(i, j int) bool {
+		if hours[i].hours != hours[j].hours {
+			return hours[i].hours > hours[j].hours
+		}
+		return strings.ToLower(hours[i].streamer) < strings.ToLower(hours[j].streamer)
+	})
+	return hours
+}
+
+// renderStats renders the stats page with a table of hours streamed for each
+// window ending now.
+func renderStats(sessions []streamSession, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("# Hours streamed\n\n")
+	fmt.Fprintf(&b, "Updated %s.\n", now.UTC().Format("2006-01-02 15:04 MST"))
+	for _, w := range statsWindows {
+		fmt.Fprintf(&b, "\n## %s\n\n", w.heading)
+		hours := hoursStreamed(sessions, now.Add(-w.period), now)
+		if len(hours) == 0 {
+			b.WriteString("Nobody has streamed.\n")
+			continue
+		}
+		b.WriteString("Streamer | Hours\n--- | ---\n")
+		for _, h := range hours {
+			fmt.Fprintf(&b, "`%s` | %.1f\n", h.streamer, h.hours)
+		}
+	}
+	return b.String()
+}
+
+// writeStats renders the stats page from the event history and the changes
+// being applied, and writes it to the worktree.
+func (q *updateQueue) writeStats(repo *StreamersRepo) error {
+	now := time.Now()
+	events, err := q.statuses.updatedEvents(now.Add(-statsHistory))
+	if err != nil {
+		return err
+	}
+	// The changes being applied are only recorded once they are pushed.
+	for _, n := range repo.applied {
+		eventType := "stream.offline"
+		if n.Online {
+			eventType = "stream.online"
+		}
+		events = append(events, historyEvent{Login: n.Login, Streamer: n.Streamer, Type: eventType, QueuedAt: now})
+	}
+	return repo.writeRepoFile(repo.statsFilePath, renderStats(buildSessions(events, now), now))
+}
@@ -0,0 +1,5 @@
+// Package statusapi is the gRPC API of StreamStatus, generated from
+// statusapi.proto.
+package statusapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative statusapi.proto
@@ -0,0 +1,277 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: statusapi.proto
+
+package statusapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// StreamStatusClient is the client API for StreamStatus service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type StreamStatusClient interface {
+	ListStatuses(ctx context.Context, in *ListStatusesRequest, opts ...grpc.CallOption) (*ListStatusesResponse, error)
+	WatchStatuses(ctx context.Context, in *WatchStatusesRequest, opts ...grpc.CallOption) (StreamStatus_WatchStatusesClient, error)
+	AddStreamer(ctx context.Context, in *AddStreamerRequest, opts ...grpc.CallOption) (*StreamerResponse, error)
+	RemoveStreamer(ctx context.Context, in *RemoveStreamerRequest, opts ...grpc.CallOption) (*StreamerResponse, error)
+	Reconcile(ctx context.Context, in *ReconcileRequest, opts ...grpc.CallOption) (*ReconcileResponse, error)
+}
+
+type streamStatusClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewStreamStatusClient(cc grpc.ClientConnInterface) StreamStatusClient {
+	return &streamStatusClient{cc}
+}
+
+func (c *streamStatusClient) ListStatuses(ctx context.Context, in *ListStatusesRequest, opts ...grpc.CallOption) (*ListStatusesResponse, error) {
+	out := new(ListStatusesResponse)
+	err := c.cc.Invoke(ctx, "/streamstatus.v1.StreamStatus/ListStatuses", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streamStatusClient) WatchStatuses(ctx context.Context, in *WatchStatusesRequest, opts ...grpc.CallOption) (StreamStatus_WatchStatusesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &StreamStatus_ServiceDesc.Streams[0], "/streamstatus.v1.StreamStatus/WatchStatuses", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &streamStatusWatchStatusesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type StreamStatus_WatchStatusesClient interface {
+	Recv() (*StreamerStatus, error)
+	grpc.ClientStream
+}
+
+type streamStatusWatchStatusesClient struct {
+	grpc.ClientStream
+}
+
+func (x *streamStatusWatchStatusesClient) Recv() (*StreamerStatus, error) {
+	m := new(StreamerStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *streamStatusClient) AddStreamer(ctx context.Context, in *AddStreamerRequest, opts ...grpc.CallOption) (*StreamerResponse, error) {
+	out := new(StreamerResponse)
+	err := c.cc.Invoke(ctx, "/streamstatus.v1.StreamStatus/AddStreamer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streamStatusClient) RemoveStreamer(ctx context.Context, in *RemoveStreamerRequest, opts ...grpc.CallOption) (*StreamerResponse, error) {
+	out := new(StreamerResponse)
+	err := c.cc.Invoke(ctx, "/streamstatus.v1.StreamStatus/RemoveStreamer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *streamStatusClient) Reconcile(ctx context.Context, in *ReconcileRequest, opts ...grpc.CallOption) (*ReconcileResponse, error) {
+	out := new(ReconcileResponse)
+	err := c.cc.Invoke(ctx, "/streamstatus.v1.StreamStatus/Reconcile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StreamStatusServer is the server API for StreamStatus service.
+// All implementations must embed UnimplementedStreamStatusServer
+// for forward compatibility
+type StreamStatusServer interface {
+	ListStatuses(context.Context, *ListStatusesRequest) (*ListStatusesResponse, error)
+	WatchStatuses(*WatchStatusesRequest, StreamStatus_WatchStatusesServer) error
+	AddStreamer(context.Context, *AddStreamerRequest) (*StreamerResponse, error)
+	RemoveStreamer(context.Context, *RemoveStreamerRequest) (*StreamerResponse, error)
+	Reconcile(context.Context, *ReconcileRequest) (*ReconcileResponse, error)
+	mustEmbedUnimplementedStreamStatusServer()
+}
+
+// UnimplementedStreamStatusServer must be embedded to have forward compatible implementations.
+type UnimplementedStreamStatusServer struct {
+}
+
+func (UnimplementedStreamStatusServer) ListStatuses(context.Context, *ListStatusesRequest) (*ListStatusesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListStatuses not implemented")
+}
+func (UnimplementedStreamStatusServer) WatchStatuses(*WatchStatusesRequest, StreamStatus_WatchStatusesServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStatuses not implemented")
+}
+func (UnimplementedStreamStatusServer) AddStreamer(context.Context, *AddStreamerRequest) (*StreamerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddStreamer not implemented")
+}
+func (UnimplementedStreamStatusServer) RemoveStreamer(context.Context, *RemoveStreamerRequest) (*StreamerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveStreamer not implemented")
+}
+func (UnimplementedStreamStatusServer) Reconcile(context.Context, *ReconcileRequest) (*ReconcileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reconcile not implemented")
+}
+func (UnimplementedStreamStatusServer) mustEmbedUnimplementedStreamStatusServer() {}
+
+// UnsafeStreamStatusServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to StreamStatusServer will
+// result in compilation errors.
+type UnsafeStreamStatusServer interface {
+	mustEmbedUnimplementedStreamStatusServer()
+}
+
+func RegisterStreamStatusServer(s grpc.ServiceRegistrar, srv StreamStatusServer) {
+	s.RegisterService(&StreamStatus_ServiceDesc, srv)
+}
+
+func _StreamStatus_ListStatuses_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListStatusesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamStatusServer).ListStatuses(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streamstatus.v1.StreamStatus/ListStatuses",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamStatusServer).ListStatuses(ctx, req.(*ListStatusesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreamStatus_WatchStatuses_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatusesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StreamStatusServer).WatchStatuses(m, &streamStatusWatchStatusesServer{stream})
+}
+
+type StreamStatus_WatchStatusesServer interface {
+	Send(*StreamerStatus) error
+	grpc.ServerStream
+}
+
+type streamStatusWatchStatusesServer struct {
+	grpc.ServerStream
+}
+
+func (x *streamStatusWatchStatusesServer) Send(m *StreamerStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _StreamStatus_AddStreamer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddStreamerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamStatusServer).AddStreamer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streamstatus.v1.StreamStatus/AddStreamer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamStatusServer).AddStreamer(ctx, req.(*AddStreamerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreamStatus_RemoveStreamer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveStreamerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamStatusServer).RemoveStreamer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streamstatus.v1.StreamStatus/RemoveStreamer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamStatusServer).RemoveStreamer(ctx, req.(*RemoveStreamerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _StreamStatus_Reconcile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReconcileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StreamStatusServer).Reconcile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/streamstatus.v1.StreamStatus/Reconcile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StreamStatusServer).Reconcile(ctx, req.(*ReconcileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// StreamStatus_ServiceDesc is the grpc.ServiceDesc for StreamStatus service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var StreamStatus_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "streamstatus.v1.StreamStatus",
+	HandlerType: (*StreamStatusServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListStatuses",
+			Handler:    _StreamStatus_ListStatuses_Handler,
+		},
+		{
+			MethodName: "AddStreamer",
+			Handler:    _StreamStatus_AddStreamer_Handler,
+		},
+		{
+			MethodName: "RemoveStreamer",
+			Handler:    _StreamStatus_RemoveStreamer_Handler,
+		},
+		{
+			MethodName: "Reconcile",
+			Handler:    _StreamStatus_Reconcile_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStatuses",
+			Handler:       _StreamStatus_WatchStatuses_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "statusapi.proto",
+}
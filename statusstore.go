@@ -0,0 +1,312 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// statusSchema creates the table of each streamer's last known status.
+const statusSchema = `
+CREATE TABLE IF NOT EXISTS streamer_status (
+	user_id    TEXT PRIMARY KEY,
+	login      TEXT NOT NULL,
+	streamer   TEXT NOT NULL,
+	online     INTEGER NOT NULL,
+	changed_at DATETIME NOT NULL,
+	event_id   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS event_history (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id     TEXT NOT NULL,
+	user_id      TEXT NOT NULL,
+	login        TEXT NOT NULL,
+	streamer     TEXT NOT NULL,
+	type         TEXT NOT NULL,
+	queued_at    TEXT NOT NULL,
+	processed_at TEXT NOT NULL,
+	outcome      TEXT NOT NULL,
+	error        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS event_history_processed_at ON event_history (processed_at);
+CREATE TABLE IF NOT EXISTS revoked_authorizations (
+	user_id    TEXT PRIMARY KEY,
+	login      TEXT NOT NULL,
+	streamer   TEXT NOT NULL,
+	revoked_at DATETIME NOT NULL,
+	event_id   TEXT NOT NULL
+)`
+
+// historyTimeFormat stores history times as fixed width UTC text, so they
+// sort and compare in order.
+const historyTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// Outcomes of processing an event recorded in its history.
+const (
+	outcomeUpdated    = "updated"
+	outcomeNoChange   = "no_change"
+	outcomeNotFound   = "not_found"
+	outcomeSuperseded = "superseded"
+	outcomeUnverified = "unverified"
+	outcomeRetrying   = "retrying"
+	outcomeFailed     = "failed"
+	outcomePushFailed = "push_failed"
+)
+
+// statusStore persists the last known status of each streamer, and the
+// history of processed events, in SQLite so they survive restarts.
+type statusStore struct {
+	db *sql.DB
+}
+
+// streamerStatus is the last status change applied for a streamer.
+type streamerStatus struct {
+	UserID    string    `json:"user_id"`
+	Login     string    `json:"login"`
+	Streamer  string    `json:"streamer"`
+	Online    bool      `json:"online"`
+	ChangedAt time.Time `json:"changed_at"`
+	EventID   string    `json:"event_id"`
+}
+
+// historyEvent is the outcome of processing a status change.
+type historyEvent struct {
+	EventID     string    `json:"event_id"`
+	UserID      string    `json:"user_id"`
+	Login       string    `json:"login"`
+	Streamer    string    `json:"streamer"`
+	Type        string    `json:"type"`
+	QueuedAt    time.Time `json:"queued_at"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Outcome     string    `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// revocation is a streamer revoking the app's authorization.
+type revocation struct {
+	UserID    string    `json:"user_id"`
+	Login     string    `json:"login"`
+	Streamer  string    `json:"streamer"`
+	RevokedAt time.Time `json:"revoked_at"`
+	EventID   string    `json:"event_id"`
+}
+
+// newStatusStore opens the status database at the configured path, or returns
+// nil when no path is configured.
+func newStatusStore(cfg *config) (*statusStore, error) {
+	if cfg.StatusDBPath == "" {
+		return nil, nil
+	}
+	db, err := sql.Open("sqlite", cfg.StatusDBPath)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time.
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(statusSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &statusStore{db: db}, nil
+}
+
+// record stores c as the streamer's last known status.
+func (s *statusStore) record(c statusChange) error {
+	_, err := s.db.Exec(`
+INSERT INTO streamer_status (user_id, login, streamer, online, changed_at, event_id)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET
+	login = excluded.login,
+	streamer = excluded.streamer,
+	online = excluded.online,
+	changed_at = excluded.changed_at,
+	event_id = excluded.event_id`,
+		c.userID, c.login, c.streamer, c.online, c.queuedAt.UTC(), c.id)
+	return err
+}
+
+// get returns the last known status of the streamer with the user ID, and
+// false if there is none.
+func (s *statusStore) get(userID string) (streamerStatus, bool, error) {
+	row := s.db.QueryRow(`
+SELECT user_id, login, streamer, online, changed_at, event_id
+FROM streamer_status WHERE user_id = ?`, userID)
+	var st streamerStatus
+	err := row.Scan(&st.UserID, &st.Login, &st.Streamer, &st.Online, &st.ChangedAt, &st.EventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return st, false, nil
+	}
+	return st, err == nil, err
+}
+
+// all returns the last known status of every streamer, by login.
+func (s *statusStore) all() ([]streamerStatus, error) {
+	rows, err := s.db.Query(`
+SELECT user_id, login, streamer, online, changed_at, event_id
+FROM streamer_status ORDER BY login`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var statuses []streamerStatus
+	for rows.Next() {
+		var st streamerStatus
+		err = rows.Scan(&st.UserID, &st.Login, &st.Streamer, &st.Online, &st.ChangedAt, &st.EventID)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, rows.Err()
+}
+
+// recordEvent adds the outcome of processing c, and the error that caused it
+// if any, to the event history.
+func (s *statusStore) recordEvent(c statusChange, outcome string, reason error) error {
+	var message string
+	if reason != nil {
+		message = reason.Error()
+	}
+	_, err := s.db.Exec(`
+INSERT INTO event_history (event_id, user_id, login, streamer, type, queued_at, processed_at, outcome, error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.id, c.userID, c.login, c.streamer, c.eventType(),
+		c.queuedAt.UTC().Format(historyTimeFormat), time.Now().UTC().Format(historyTimeFormat),
+		outcome, message)
+	return err
+}
+
+// history returns up to limit events processed since the given time, newest
+// first, only for the streamer when it isn't empty.
+func (s *statusStore) history(streamer string, since time.Time, limit int) ([]historyEvent, error) {
+	rows, err := s.db.Query(`
+SELECT event_id, user_id, login, streamer, type, queued_at, processed_at, outcome, error
+FROM event_history
+WHERE processed_at >= ? AND (? = '' OR lower(login) = lower(?) OR lower(streamer) = lower(?))
+ORDER BY id DESC LIMIT ?`,
+		since.UTC().Format(historyTimeFormat), streamer, streamer, streamer, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanHistory(rows)
+}
+
+// updatedEvents returns the events that changed index.md since the given
+// time, oldest first.
+func (s *statusStore) updatedEvents(since time.Time) ([]historyEvent, error) {
+	rows, err := s.db.Query(`
+SELECT event_id, user_id, login, streamer, type, queued_at, processed_at, outcome, error
+FROM event_history
+WHERE processed_at >= ? AND outcome = ?
+ORDER BY queued_at`,
+		since.UTC().Format(historyTimeFormat), outcomeUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return scanHistory(rows)
+}
+
+// firstSeen returns when each streamer, by lower case login, first changed
+// index.md.
+func (s *statusStore) firstSeen() (map[string]time.Time, error) {
+	rows, err := s.db.Query(`
+SELECT lower(login), min(queued_at) FROM event_history
+WHERE outcome = ? GROUP BY lower(login)`, outcomeUpdated)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	seen := map[string]time.Time{}
+	for rows.Next() {
+		var login, first string
+		err := rows.Scan(&login, &first)
+		if err != nil {
+			return nil, err
+		}
+		seen[login], err = time.Parse(historyTimeFormat, first)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return seen, rows.Err()
+}
+
+// rename changes the login and display name stored for the user ID, in its
+// status and its event history.
+func (s *statusStore) rename(userID, login, streamer string) error {
+	_, err := s.db.Exec(`UPDATE streamer_status SET login = ?, streamer = ? WHERE user_id = ?`,
+		login, streamer, userID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`UPDATE event_history SET login = ?, streamer = ? WHERE user_id = ?`,
+		login, streamer, userID)
+	return err
+}
+
+// recordRevocation stores that a streamer revoked the app's authorization,
+// replacing any earlier revocation of theirs.
+func (s *statusStore) recordRevocation(r revocation) error {
+	_, err := s.db.Exec(`
+INSERT INTO revoked_authorizations (user_id, login, streamer, revoked_at, event_id)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET
+	login = excluded.login,
+	streamer = excluded.streamer,
+	revoked_at = excluded.revoked_at,
+	event_id = excluded.event_id`,
+		r.UserID, r.Login, r.Streamer, r.RevokedAt.UTC(), r.EventID)
+	return err
+}
+
+// revocations returns the streamers who revoked the app's authorization,
+// newest first.
+func (s *statusStore) revocations() ([]revocation, error) {
+	rows, err := s.db.Query(`
+SELECT user_id, login, streamer, revoked_at, event_id
+FROM revoked_authorizations ORDER BY revoked_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revoked := []revocation{}
+	for rows.Next() {
+		var r revocation
+		err = rows.Scan(&r.UserID, &r.Login, &r.Streamer, &r.RevokedAt, &r.EventID)
+		if err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, r)
+	}
+	return revoked, rows.Err()
+}
+
+// scanHistory reads the history events from rows and closes them.
+func scanHistory(rows *sql.Rows) ([]historyEvent, error) {
+	defer rows.Close()
+	events := []historyEvent{}
+	for rows.Next() {
+		var e historyEvent
+		var queuedAt, processedAt string
+		err := rows.Scan(&e.EventID, &e.UserID, &e.Login, &e.Streamer, &e.Type, &queuedAt, &processedAt, &e.Outcome, &e.Error)
+		if err != nil {
+			return nil, err
+		}
+		if e.QueuedAt, err = time.Parse(historyTimeFormat, queuedAt); err != nil {
+			return nil, err
+		}
+		if e.ProcessedAt, err = time.Parse(historyTimeFormat, processedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// close closes the status database.
+func (s *statusStore) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/infosecstreams/StreamStatus/internal/render"
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+	"github.com/nicklaw5/helix"
+)
+
+// addStreamer subscribes the webhook at callback to the user's stream events
+// and commits a row for them to index.md, so they're listed from then on. The
+// subscriptions are deleted again if the row can't be committed.
+func (q *updateQueue) addStreamer(user helix.User, callback, secret string) error {
+	repo := q.repo
+	if q.twitch == nil || repo.contents != nil {
+		return fmt.Errorf("adding streamers needs the Twitch app credentials and the git backend")
+	}
+	err := q.twitch.subscribe(user.ID, callback, secret, repo.logger)
+	if err != nil {
+		return err
+	}
+	err = q.commitTask("add-"+user.ID, func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		added, err := repo.addRow(notification{Login: user.Login, Streamer: user.DisplayName, UserID: user.ID})
+		if err != nil {
+			return "", err
+		}
+		if !added {
+			return "", &NoChangeNeededError{err: user.Login + " already has a row"}
+		}
+		repo.indexMdText = q.currentRoster().setLinks(repo.indexMdText)
+		repo.logger.Printf("adding %s to %s\n", user.DisplayName, repo.indexFilePath)
+		return fmt.Sprintf("➕ Added %s", user.DisplayName), repo.writefile(repo.indexMdText)
+	}, repo.indexFilePath)
+	// A streamer who already has a row keeps their subscriptions.
+	if err != nil && !errors.Is(err, ErrNoChangeNeeded) {
+		_, unsubscribeErr := q.twitch.unsubscribe(user.ID, repo.logger)
+		if unsubscribeErr != nil {
+			repo.logger.Printf("error deleting subscriptions for %s: %s\n", user.DisplayName, unsubscribeErr)
+		}
+	}
+	return err
+}
+
+// removeStreamer deletes the user's EventSub subscriptions and commits the
+// removal of their rows, or moves their row to the inactive page when archive
+// is set so it's kept.
+func (q *updateQueue) removeStreamer(user helix.User, archive bool) error {
+	repo := q.repo
+	if q.twitch == nil || repo.contents != nil {
+		return fmt.Errorf("removing streamers needs the Twitch app credentials and the git backend")
+	}
+	if archive && repo.inactiveFilePath == "" {
+		return fmt.Errorf("archiving streamers needs SS_INACTIVE_FILE")
+	}
+	removed, err := q.twitch.unsubscribe(user.ID, repo.logger)
+	if err != nil {
+		return err
+	}
+	repo.logger.Printf("removed %d subscriptions for %s\n", removed, user.DisplayName)
+	return q.commitTask("remove-"+user.ID, func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		var message string
+		if archive {
+			if !repo.moveToInactive(user.Login) {
+				return "", &NoChangeNeededError{err: "no row for " + user.Login + " in " + repo.indexFilePath, cause: ErrStreamerNotFound}
+			}
+			repo.logger.Printf("moving %s to %s\n", user.DisplayName, repo.inactiveFilePath)
+			message = fmt.Sprintf("🗃️ Moved %s to %s", user.DisplayName, repo.inactiveFilePath)
+		} else {
+			var ok, okInactive bool
+			repo.indexMdText, _, ok = render.RemoveRow(repo.indexMdText, user.Login)
+			repo.inactiveMdText, _, okInactive = render.RemoveRow(repo.inactiveMdText, user.Login)
+			if !ok && !okInactive {
+				return "", &NoChangeNeededError{err: "no row for " + user.Login, cause: ErrStreamerNotFound}
+			}
+			repo.logger.Printf("removing %s\n", user.DisplayName)
+			message = fmt.Sprintf("➖ Removed %s", user.DisplayName)
+		}
+		err = repo.writeFiles()
+		if err != nil {
+			return "", err
+		}
+		err = repo.addFile(repo.indexFilePath)
+		if err == nil && repo.hasInactivePage() {
+			err = repo.addFile(repo.inactiveFilePath)
+		}
+		return message, err
+	})
+}
+
+// staleSubscriptions returns the app's EventSub subscriptions that have
+// failed, or are for stream events of broadcasters without a row in index.md
+// or the inactive page, and deletes them unless dryRun is set.
+func (q *updateQueue) staleSubscriptions(dryRun bool) ([]helix.EventSubSubscription, error) {
+	repo := q.repo
+	if q.twitch == nil || repo.contents != nil {
+		return nil, fmt.Errorf("pruning subscriptions needs the Twitch app credentials and the git backend")
+	}
+	err := repo.withCloneLock(func() error {
+		err := repo.retry.do(repo.logger, "sync", repo.syncRepo)
+		if err != nil {
+			return err
+		}
+		return repo.readFile()
+	})
+	if err != nil {
+		return nil, err
+	}
+	logins := append(rosterLogins(repo.indexMdText), rosterLogins(repo.inactiveMdText)...)
+	if len(logins) == 0 {
+		// Better to keep everything than to unsubscribe from everyone.
+		return nil, fmt.Errorf("no streamers found in %s", repo.indexFilePath)
+	}
+	users, err := q.twitch.getUsersByLogin(logins, repo.logger)
+	if err != nil {
+		return nil, err
+	}
+	listed := map[string]bool{}
+	for _, u := range users {
+		listed[u.ID] = true
+	}
+	subscriptions, _, _, err := q.twitch.subscriptions(repo.logger)
+	if err != nil {
+		return nil, err
+	}
+	var stale []helix.EventSubSubscription
+	for _, s := range subscriptions {
+		failed := !twitch.IsActive(s)
+		unlisted := twitch.IsStreamerEvent(s.Type) && !listed[twitch.SubscriptionUserID(s)]
+		if !failed && !unlisted {
+			continue
+		}
+		if !dryRun {
+			err = q.twitch.removeSubscription(s.ID, repo.logger)
+			if err != nil {
+				return stale, err
+			}
+		}
+		stale = append(stale, s)
+	}
+	return stale, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// week is the period each summary covers.
+const week = 7 * 24 * time.Hour
+
+// summaryTopStreamers is how many of the most active streamers are named.
+const summaryTopStreamers = 3
+
+// parseWeekday returns the day of the week named by s, such as monday.
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), s) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day of the week: %s", s)
+}
+
+// nextSummary returns when the first summary after now is due, at midnight
+// UTC at the start of day.
+func nextSummary(now time.Time, day time.Weekday) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	next = next.AddDate(0, 0, (int(day)-int(next.Weekday())+7)%7)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
+
+// renderSummary renders the summary of the week before end from the event
+// history: the total hours streamed, the most active streamers and the
+// streamers who went live for the first time.
+func (q *updateQueue) renderSummary(end time.Time) (string, error) {
+	start := end.Add(-week)
+	// Read back further to find streams that started before the week.
+	events, err := q.statuses.updatedEvents(start.Add(-week))
+	if err != nil {
+		return "", err
+	}
+	var inWeek []historyEvent
+	for _, e := range events {
+		if e.QueuedAt.Before(end) {
+			inWeek = append(inWeek, e)
+		}
+	}
+	hours := hoursStreamed(buildSessions(inWeek, end), start, end)
+	seen, err := q.statuses.firstSeen()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Week of %s\n\n", start.Format("2 January 2006"))
+	if len(hours) == 0 {
+		b.WriteString("- Nobody streamed.\n")
+		return b.String(), nil
+	}
+	var total float64
+	var newStreamers []string
+	for _, h := range hours {
+		total += h.hours
+		first := seen[h.login]
+		if !first.Before(start) && first.Before(end) {
+			newStreamers = append(newStreamers, fmt.Sprintf("`%s`", h.streamer))
+		}
+	}
+	fmt.Fprintf(&b, "- %.1f hours streamed by %d streamers.\n", total, len(hours))
+	var top []string
+	for i, h := range hours {
+		if i == summaryTopStreamers {
+			break
+		}
+		top = append(top, fmt.Sprintf("`%s` (%.1f hours)", h.streamer, h.hours))
+	}
+	fmt.Fprintf(&b, "- Most active: %s.\n", strings.Join(top, ", "))
+	if len(newStreamers) > 0 {
+		fmt.Fprintf(&b, "- New this week: %s.\n", strings.Join(newStreamers, ", "))
+	}
+	return b.String(), nil
+}
+
+// commitSummary writes the summary of the week before end to the summary
+// file, then commits and pushes it.
+func (q *updateQueue) commitSummary(end time.Time) error {
+	text, err := q.renderSummary(end)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("📊 Weekly summary for the week of %s", end.Add(-week).Format("2 January 2006"))
+	return q.commitTask("weekly-summary", func() (string, error) {
+		return message, q.repo.writeRepoFile(q.summaryFilePath, text)
+	}, q.summaryFilePath)
+}
+
+// runSummaries schedules a summary commit at the start of day every week
+// until the queue is done. With a shared queue only the instance taking
+// changes commits it, as it has the history.
+func (q *updateQueue) runSummaries(day time.Weekday) {
+	for {
+		due := nextSummary(time.Now(), day)
+		select {
+		case <-q.done:
+			return
+		case <-time.After(time.Until(due)):
+		}
+		q.scheduleTask("weekly summary", func() error {
+			return q.commitSummary(due)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infosecstreams/StreamStatus/internal/twitch"
+	log "github.com/sirupsen/logrus"
+)
+
+// teamRoster is a Twitch team whose members are added to index.md, and the
+// webhook their stream events are subscribed to.
+type teamRoster struct {
+	name string
+	// callbackURL is the public URL of the webhook handler, or empty to leave
+	// subscribing to the members' events to the operator.
+	callbackURL string
+	interval    time.Duration
+	secret      string
+}
+
+// teamMember is a member of a Twitch team.
+type teamMember struct {
+	UserID    string `json:"user_id"`
+	UserLogin string `json:"user_login"`
+	UserName  string `json:"user_name"`
+}
+
+// getTeamMembers returns the members of the team with the name.
+func (t *twitchClient) getTeamMembers(name string, logger *log.Entry) ([]teamMember, error) {
+	var resp struct {
+		Data []struct {
+			Users []teamMember `json:"users"`
+		} `json:"data"`
+	}
+	err := t.helixGet(logger, "twitch team lookup", "/teams", url.Values{"name": {name}}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, &helixPermanentError{message: "no team named " + name}
+	}
+	return resp.Data[0].Users, nil
+}
+
+// syncTeam adds rows for the members of the team missing from index.md, then
+// subscribes to the stream events of every member missing a subscription.
+func (q *updateQueue) syncTeam() error {
+	repo := q.repo
+	members, err := q.twitch.getTeamMembers(q.team.name, repo.logger)
+	if err != nil {
+		return err
+	}
+	var added []teamMember
+	err = q.commitTask("team-roster", func() (string, error) {
+		err := repo.readFile()
+		if err != nil {
+			return "", err
+		}
+		added = nil
+		var names []string
+		for _, m := range members {
+			ok, err := repo.addRow(notification{Login: m.UserLogin, Streamer: m.UserName, UserID: m.UserID})
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				added = append(added, m)
+				names = append(names, m.UserName)
+			}
+		}
+		if len(added) == 0 {
+			return "", &NoChangeNeededError{err: "no new members of the " + q.team.name + " team"}
+		}
+		repo.logger.Printf("adding %s from the %s team\n", strings.Join(names, ", "), q.team.name)
+		message := fmt.Sprintf("👥 Added %s from the %s team", strings.Join(names, ", "), q.team.name)
+		return message, repo.writefile(repo.indexMdText)
+	}, repo.indexFilePath)
+	if errors.Is(err, ErrNoChangeNeeded) {
+		// Members already on the page may still be missing subscriptions.
+		subscribeErr := q.subscribeMembers(members)
+		if subscribeErr != nil {
+			return subscribeErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return q.subscribeMembers(members)
+}
+
+// subscribeMembers subscribes the webhook to the stream events of the members
+// without an active subscription to each of them, recreating those that
+// failed. Members that can't be subscribed are tried again on the next sync.
+func (q *updateQueue) subscribeMembers(members []teamMember) error {
+	if q.team.callbackURL == "" {
+		return nil
+	}
+	logger := q.repo.logger
+	subscriptions, _, _, err := q.twitch.subscriptions(logger)
+	if err != nil {
+		return err
+	}
+	isMember := map[string]bool{}
+	for _, m := range members {
+		isMember[m.UserID] = true
+	}
+	active := map[string]bool{}
+	for _, s := range subscriptions {
+		userID := twitch.SubscriptionUserID(s)
+		if !isMember[userID] || !twitch.IsStreamerEvent(s.Type) {
+			continue
+		}
+		if twitch.IsActive(s) {
+			active[userID+" "+s.Type] = true
+			continue
+		}
+		err = q.twitch.removeSubscription(s.ID, logger)
+		if err != nil {
+			logger.Printf("error removing failed %s subscription of %s: %s\n", s.Type, userID, err)
+		}
+	}
+	for _, m := range members {
+		subscribed := true
+		for _, eventType := range twitch.StreamerEventTypes {
+			subscribed = subscribed && active[m.UserID+" "+eventType]
+		}
+		if subscribed {
+			continue
+		}
+		err = q.twitch.subscribe(m.UserID, q.team.callbackURL, q.team.secret, logger)
+		if err != nil {
+			logger.Printf("error subscribing to events for %s: %s\n", m.UserName, err)
+			continue
+		}
+		logger.Printf("subscribed to events for %s\n", m.UserName)
+	}
+	return nil
+}
+
+// runTeamSync adds new members of the team now and then every interval until
+// the queue is done.
+func (q *updateQueue) runTeamSync() {
+	ticker := time.NewTicker(q.team.interval)
+	defer ticker.Stop()
+	for {
+		q.scheduleTask("team roster", q.syncTeam)
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	// telegramAPI is the Telegram Bot API base URL.
+	telegramAPI = "https://api.telegram.org"
+	// defaultTelegramTemplate is the message sent when no template is configured.
+	defaultTelegramTemplate = "🔴 {{.Streamer}} is live!\n{{if .Title}}{{.Title}}\n{{end}}{{if .Game}}Playing {{.Game}}\n{{end}}{{.URL}}"
+)
+
+// telegramNotifier sends go-live messages to Telegram chats via a bot.
+type telegramNotifier struct {
+	token    string
+	chats    []string
+	disabled map[string]bool
+	template *template.Template
+}
+
+// newTelegramNotifier returns a notifier for the configured bot and chats,
+// or nil if none are configured.
+func newTelegramNotifier(cfg *config) (*telegramNotifier, error) {
+	if cfg.TelegramToken == "" || len(cfg.TelegramChats) == 0 {
+		return nil, nil
+	}
+	text := cfg.TelegramTemplate
+	if text == "" {
+		text = defaultTelegramTemplate
+	}
+	tmpl, err := template.New("telegram").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing telegram template: %s", err)
+	}
+	t := &telegramNotifier{
+		token:    cfg.TelegramToken,
+		chats:    cfg.TelegramChats,
+		disabled: map[string]bool{},
+		template: tmpl,
+	}
+	for login, sc := range cfg.Streamers {
+		if sc.Telegram != nil && !*sc.Telegram {
+			t.disabled[strings.ToLower(login)] = true
+		}
+	}
+	return t, nil
+}
+
+// telegramMessage is the body of a Bot API sendMessage request.
+type telegramMessage struct {
+	ChatID string `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+// notify sends the rendered template to each chat when the streamer goes live.
+func (t *telegramNotifier) notify(n notification) error {
+	if !n.Online || t.disabled[strings.ToLower(n.Login)] {
+		return nil
+	}
+	text, err := renderTemplate(t.template, n)
+	if err != nil {
+		return err
+	}
+	return t.send(text)
+}
+
+// alert sends the message to each chat.
+func (t *telegramNotifier) alert(message string) error {
+	return t.send(message)
+}
+
+// send sends text to each chat. The bot token is in the URL, so it's redacted
+// from the errors.
+func (t *telegramNotifier) send(text string) error {
+	var failed []string
+	for _, chat := range t.chats {
+		err := postJSON(telegramAPI+"/bot"+t.token+"/sendMessage", telegramMessage{ChatID: chat, Text: text}, nil)
+		err = redactURL(err, t.token)
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("telegram: %d of %d chats failed: %v", len(failed), len(t.chats), failed)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newCertManager returns an autocert manager which obtains and renews
+// Let's Encrypt certificates for the configured domains.
+func newCertManager(cfg *config) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.TLSCacheDir),
+		Email:      cfg.TLSEmail,
+		HostPolicy: autocert.HostWhitelist(cfg.TLSDomains...),
+	}
+}
+
+// newChallengeServer returns a plain HTTP server that answers ACME http-01
+// challenges and redirects everything else to HTTPS.
+func newChallengeServer(cfg *config, m *autocert.Manager) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.TLSHTTPPort,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// trovoAPIURL is Trovo's open platform API.
+const trovoAPIURL = "https://open-api.trovo.live/openplatform"
+
+// trovoSource polls the Trovo API for live channels.
+type trovoSource struct {
+	clientID string
+	retry    retryPolicy
+}
+
+// newTrovoSource returns a source using the configured Trovo client ID, or
+// nil when none is configured.
+func newTrovoSource(cfg *config, retry retryPolicy) *trovoSource {
+	if cfg.TrovoClientID == "" {
+		return nil
+	}
+	return &trovoSource{clientID: cfg.TrovoClientID, retry: retry}
+}
+
+// platform returns the platform the source polls.
+func (t *trovoSource) platform() string {
+	return platformTrovo
+}
+
+// live reports whether the channel of the Trovo user with the username is
+// live.
+func (t *trovoSource) live(channel string, logger *log.Entry) (bool, error) {
+	body, err := json.Marshal(map[string]string{"username": channel})
+	if err != nil {
+		return false, err
+	}
+	var resp struct {
+		IsLive bool `json:"is_live"`
+	}
+	err = t.retry.do(logger, "trovo channel request", func() error {
+		req, err := http.NewRequest(http.MethodPost, trovoAPIURL+"/channels/id", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Client-ID", t.clientID)
+		return doRequest(req, &resp)
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.IsLive, nil
+}
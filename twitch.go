@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nicklaw5/helix"
+	log "github.com/sirupsen/logrus"
+)
+
+// twitchClient wraps the Helix API client used to look up stream details.
+type twitchClient struct {
+	// apiURL and clientID are used for endpoints the Helix client lacks.
+	apiURL   string
+	client   *helix.Client
+	clientID string
+	retry    retryPolicy
+	// tokenMu guards refreshing the app access token, which expires at
+	// tokenExpires.
+	tokenMu      sync.Mutex
+	tokenExpires time.Time
+	// costWarning is the percentage of the EventSub cost limit at which to
+	// warn, or 0 not to, and usage is the cost at the last check.
+	costWarning int
+	usageMu     sync.Mutex
+	usage       subscriptionUsage
+	// users caches each user ID's canonical names and profile image, so
+	// they're looked up at most once every userCacheTTL.
+	mu    sync.Mutex
+	users map[string]cachedUser
+}
+
+// tokenRefreshMargin is how long before the app access token expires that a
+// new one is requested.
+const tokenRefreshMargin = time.Hour
+
+// userCacheTTL is how long looked up users are cached, so profile image
+// changes are picked up.
+const userCacheTTL = 24 * time.Hour
+
+// cachedUser is a looked up user and when they were looked up.
+type cachedUser struct {
+	user    helix.User
+	fetched time.Time
+}
+
+// newTwitchClient returns a client authenticated with an app access token,
+// or nil when no Twitch client credentials are configured. Helix requests are
+// retried according to retry.
+func newTwitchClient(cfg *config, retry retryPolicy) (*twitchClient, error) {
+	if cfg.TwitchClientID == "" || cfg.TwitchClientSecret == "" {
+		return nil, nil
+	}
+	client, err := helix.NewClient(&helix.Options{
+		ClientID:     cfg.TwitchClientID,
+		ClientSecret: cfg.TwitchClientSecret,
+	})
+	if err != nil {
+		return nil, err
+	}
+	t := &twitchClient{
+		apiURL:   helix.DefaultAPIBaseURL,
+		client:   client,
+		clientID: cfg.TwitchClientID,
+		retry:    retry,
+		users:    map[string]cachedUser{},
+	}
+	err = t.refreshToken(log.NewEntry(log.StandardLogger()))
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// refreshToken requests a new app access token with the client credentials
+// and uses it from then on.
+func (t *twitchClient) refreshToken(logger *log.Entry) error {
+	var token *helix.AppAccessTokenResponse
+	err := t.retry.do(logger, "twitch token request", func() error {
+		var err error
+		token, err = t.client.RequestAppAccessToken(nil)
+		if err != nil {
+			return err
+		}
+		return helixError(token.StatusCode, "error requesting app access token", token.ErrorMessage)
+	})
+	if err != nil {
+		return err
+	}
+	t.client.SetAppAccessToken(token.Data.AccessToken)
+	t.tokenExpires = time.Now().Add(time.Duration(token.Data.ExpiresIn) * time.Second)
+	return nil
+}
+
+// do runs a Helix request, retried according to the retry policy, with a
+// valid app access token. The token is refreshed when it's about to expire,
+// and once if it's rejected, such as after being revoked.
+func (t *twitchClient) do(logger *log.Entry, operation string, fn func() error) error {
+	t.tokenMu.Lock()
+	var err error
+	if !t.tokenExpires.IsZero() && time.Until(t.tokenExpires) < tokenRefreshMargin {
+		logger.Println("app access token expiring, requesting a new one")
+		err = t.refreshToken(logger)
+	}
+	t.tokenMu.Unlock()
+	if err != nil {
+		return err
+	}
+	err = t.retry.do(logger, operation, fn)
+	if !isUnauthorized(err) {
+		return err
+	}
+	logger.Warnf("app access token rejected, requesting a new one")
+	t.tokenMu.Lock()
+	err = t.refreshToken(logger)
+	t.tokenMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return t.retry.do(logger, operation, fn)
+}
+
+// isUnauthorized reports whether err is a Helix response rejecting the app
+// access token.
+func isUnauthorized(err error) bool {
+	var e *helixPermanentError
+	if errors.As(err, &e) {
+		return e.status == http.StatusUnauthorized
+	}
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// getStream returns the broadcaster's live stream or nil if they are offline.
+func (t *twitchClient) getStream(userID string, logger *log.Entry) (*helix.Stream, error) {
+	var resp *helix.StreamsResponse
+	err := t.do(logger, "twitch stream lookup", func() error {
+		var err error
+		resp, err = t.client.GetStreams(&helix.StreamsParams{
+			UserIDs: []string{userID},
+		})
+		if err != nil {
+			return err
+		}
+		return helixError(resp.StatusCode, "error getting stream for "+userID, resp.ErrorMessage)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data.Streams) == 0 {
+		return nil, nil
+	}
+	return &resp.Data.Streams[0], nil
+}
+
+// getUser returns the user with the ID, with their canonical login, display
+// name and profile image, looking them up unless they're cached.
+func (t *twitchClient) getUser(userID string, logger *log.Entry) (helix.User, error) {
+	t.mu.Lock()
+	cached, ok := t.users[userID]
+	t.mu.Unlock()
+	if ok && time.Since(cached.fetched) < userCacheTTL {
+		return cached.user, nil
+	}
+	var user helix.User
+	var resp *helix.UsersResponse
+	err := t.do(logger, "twitch user lookup", func() error {
+		var err error
+		resp, err = t.client.GetUsers(&helix.UsersParams{
+			IDs: []string{userID},
+		})
+		if err != nil {
+			return err
+		}
+		return helixError(resp.StatusCode, "error getting user "+userID, resp.ErrorMessage)
+	})
+	if err != nil {
+		return user, err
+	}
+	if len(resp.Data.Users) == 0 {
+		return user, &helixPermanentError{message: "no user with ID " + userID}
+	}
+	user = resp.Data.Users[0]
+	t.mu.Lock()
+	t.users[userID] = cachedUser{user: user, fetched: time.Now()}
+	t.mu.Unlock()
+	return user, nil
+}
+
+// forgetUser drops the cached names of the user with the ID after a rename.
+func (t *twitchClient) forgetUser(userID string) {
+	t.mu.Lock()
+	delete(t.users, userID)
+	t.mu.Unlock()
+}
+
+// helixGet requests path from the Helix API with the app access token, for
+// endpoints the Helix client doesn't support, and decodes the response into
+// out.
+func (t *twitchClient) helixGet(logger *log.Entry, operation, path string, query url.Values, out interface{}) error {
+	return t.do(logger, operation, func() error {
+		req, err := http.NewRequest(http.MethodGet, t.apiURL+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Client-Id", t.clientID)
+		req.Header.Set("Authorization", "Bearer "+t.client.GetAppAccessToken())
+		return doRequest(req, out)
+	})
+}
+
+// helixPermanentError is a Helix error response that retrying won't fix.
+type helixPermanentError struct {
+	message string
+	status  int
+}
+
+// Error returns the Helix error message.
+func (e *helixPermanentError) Error() string {
+	return e.message
+}
+
+// helixError returns nil if message is empty, otherwise an error prefixed with
+// context. Client errors other than rate limiting are permanent.
+func helixError(status int, context, message string) error {
+	if message == "" {
+		return nil
+	}
+	err := fmt.Errorf("%s: %s", context, message)
+	if status >= 400 && status < 500 && status != http.StatusTooManyRequests {
+		return &helixPermanentError{message: err.Error(), status: status}
+	}
+	return err
+}
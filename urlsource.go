@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// urlSource polls a URL per channel and reads whether the channel is live
+// from a field of the JSON response, covering platforms such as self-hosted
+// Owncast servers without code of their own.
+type urlSource struct {
+	name      string
+	url       string
+	liveField string
+	liveValue string
+	retry     retryPolicy
+}
+
+// newURLSources returns a source for each URL source configured.
+func newURLSources(cfg *config, retry retryPolicy) []*urlSource {
+	var sources []*urlSource
+	for _, c := range cfg.URLSources {
+		sources = append(sources, &urlSource{
+			name:      c.Platform,
+			url:       c.URL,
+			liveField: c.LiveField,
+			liveValue: c.LiveValue,
+			retry:     retry,
+		})
+	}
+	return sources
+}
+
+// platform returns the platform the source polls.
+func (u *urlSource) platform() string {
+	return u.name
+}
+
+// live reports whether the channel is live, requesting the source's URL with
+// {channel} replaced by the channel and looking up the live field in the
+// response.
+func (u *urlSource) live(channel string, logger *log.Entry) (bool, error) {
+	var resp interface{}
+	err := u.retry.do(logger, u.name+" status request", func() error {
+		req, err := http.NewRequest(http.MethodGet, strings.ReplaceAll(u.url, "{channel}", channel), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		return doRequest(req, &resp)
+	})
+	if err != nil {
+		return false, err
+	}
+	value, ok := lookupField(resp, u.liveField)
+	if !ok {
+		return false, fmt.Errorf("no %s in the %s response", u.liveField, u.name)
+	}
+	if u.liveValue != "" {
+		return fmt.Sprint(value) == u.liveValue, nil
+	}
+	live, ok := value.(bool)
+	return ok && live, nil
+}
+
+// lookupField returns the value at the dot separated path in decoded JSON.
+func lookupField(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}